@@ -0,0 +1,83 @@
+package m3u8
+
+/*
+ Part of M3U8 parser & generator library.
+ This file defines ordering of custom tags.
+
+ Copyright 2013-2019 The Project Developers.
+ See the AUTHORS and LICENSE files at the top-level directory of this distribution
+ and at https://github.com/grafov/m3u8/
+
+ ॐ तारे तुत्तारे तुरे स्व
+*/
+
+import "sort"
+
+// customOrder keeps names of custom tags in the order they were
+// decoded or set. The tags are stored in Custom maps for the lookup by
+// TagName.
+type customOrder []string
+
+// CustomTags returns custom tags of the master playlist in the order
+// they were decoded or set by SetCustomTag. Tags added to the Custom
+// map directly follow them sorted by names.
+func (p *MasterPlaylist) CustomTags() []CustomTag {
+	return p.customOrder.tags(p.Custom)
+}
+
+// CustomTags returns custom tags of the media playlist in the order
+// they were decoded or set by SetCustomTag. Tags added to the Custom
+// map directly follow them sorted by names.
+func (p *MediaPlaylist) CustomTags() []CustomTag {
+	return p.customOrder.tags(p.Custom)
+}
+
+// CustomTags returns custom tags of the segment in the order they were
+// decoded or set by SetCustomSegmentTag. Tags added to the Custom map
+// directly follow them sorted by names.
+func (seg *MediaSegment) CustomTags() []CustomTag {
+	return seg.customOrder.tags(seg.Custom)
+}
+
+// set stores the tag in the map. A new name is added to the end of
+// the order, replaced tags keep their positions.
+func (o *customOrder) set(custom map[string]CustomTag, name string, tag CustomTag) {
+	custom[name] = tag
+	for _, n := range *o {
+		if n == name {
+			return
+		}
+	}
+	*o = append(*o, name)
+}
+
+// tags returns the tags of the map in the order of names. Tags
+// missing in the order are appended sorted by names so the result
+// is always the same for the same map.
+func (o customOrder) tags(custom map[string]CustomTag) []CustomTag {
+	if len(custom) == 0 {
+		return nil
+	}
+	tags := make([]CustomTag, 0, len(custom))
+	seen := make(map[string]bool, len(custom))
+	for _, name := range o {
+		if tag, ok := custom[name]; ok && !seen[name] {
+			seen[name] = true
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) == len(custom) {
+		return tags
+	}
+	rest := make([]string, 0, len(custom)-len(tags))
+	for name := range custom {
+		if !seen[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	for _, name := range rest {
+		tags = append(tags, custom[name])
+	}
+	return tags
+}
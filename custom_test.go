@@ -0,0 +1,117 @@
+package m3u8
+
+/*
+ Custom tags ordering tests.
+
+ Copyright 2013-2019 The Project Developers.
+ See the AUTHORS and LICENSE files at the top-level directory of this distribution
+ and at https://github.com/grafov/m3u8/
+
+ ॐ तारे तुत्तारे तुरे स्व
+*/
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// lineCustomTag encodes the decoded line as is.
+type lineCustomTag struct {
+	name    string
+	segment bool
+	line    string
+}
+
+func (t *lineCustomTag) TagName() string { return t.name }
+
+func (t *lineCustomTag) Decode(line string) (CustomTag, error) {
+	return &lineCustomTag{name: t.name, segment: t.segment, line: line}, nil
+}
+
+func (t *lineCustomTag) Encode() *bytes.Buffer { return bytes.NewBufferString(t.line) }
+
+func (t *lineCustomTag) String() string { return t.line }
+
+func (t *lineCustomTag) SegmentTag() bool { return t.segment }
+
+func TestMediaPlaylistCustomTagsDecodeOrder(t *testing.T) {
+	playlist := `#EXTM3U
+#EXT-X-VERSION:3
+#Z-PLAYLIST:1
+#M-PLAYLIST:2
+#A-PLAYLIST:3
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-TARGETDURATION:10
+#Z-SEGMENT:1
+#A-SEGMENT:2
+#M-SEGMENT:3
+#EXTINF:10.000,
+seg0.ts
+#EXT-X-ENDLIST
+`
+	decoders := []CustomDecoder{
+		&lineCustomTag{name: "#A-PLAYLIST:"},
+		&lineCustomTag{name: "#M-PLAYLIST:"},
+		&lineCustomTag{name: "#Z-PLAYLIST:"},
+		&lineCustomTag{name: "#A-SEGMENT:", segment: true},
+		&lineCustomTag{name: "#M-SEGMENT:", segment: true},
+		&lineCustomTag{name: "#Z-SEGMENT:", segment: true},
+	}
+	p, _ := NewMediaPlaylist(1, 1)
+	p.WithCustomDecoders(decoders)
+	if err := p.DecodeFrom(strings.NewReader(playlist), true); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.Custom["#M-PLAYLIST:"]; !ok {
+		t.Error("Expected lookup of the tag by name")
+	}
+	// WriteTo doesn't use the cache so each run encodes the tags again
+	for i := 0; i < 20; i++ {
+		var buf bytes.Buffer
+		if _, err := p.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != playlist {
+			t.Fatalf("Expected custom tags in the decode order, got:\n%s", buf.String())
+		}
+	}
+}
+
+func TestMasterPlaylistCustomTagsOrder(t *testing.T) {
+	p := NewMasterPlaylist()
+	p.SetCustomTag(&MockCustomTag{name: "#Z-TAG", encodedString: "#Z-TAG:1"})
+	p.SetCustomTag(&MockCustomTag{name: "#M-TAG", encodedString: "#M-TAG"})
+	p.SetCustomTag(&MockCustomTag{name: "#A-TAG", encodedString: "#A-TAG"})
+	// replaced tag keeps its position
+	p.SetCustomTag(&MockCustomTag{name: "#Z-TAG", encodedString: "#Z-TAG:2"})
+	// tags added to the map directly follow sorted by names
+	p.Custom["#Y-TAG"] = &MockCustomTag{name: "#Y-TAG", encodedString: "#Y-TAG"}
+	p.Custom["#B-TAG"] = &MockCustomTag{name: "#B-TAG", encodedString: "#B-TAG"}
+	delete(p.Custom, "#M-TAG")
+
+	var names []string
+	for _, tag := range p.CustomTags() {
+		names = append(names, tag.String())
+	}
+	if strings.Join(names, " ") != "#Z-TAG:2 #A-TAG #B-TAG #Y-TAG" {
+		t.Errorf("Unexpected order of custom tags: %v", names)
+	}
+	if !strings.Contains(p.String(), "#Z-TAG:2\n#A-TAG\n#B-TAG\n#Y-TAG\n") {
+		t.Errorf("Unexpected order of encoded custom tags:\n%s", p)
+	}
+}
+
+func TestMediaSegmentCustomTagsOrder(t *testing.T) {
+	p, _ := NewMediaPlaylist(1, 1)
+	p.Append("seg0.ts", 10, "")
+	for _, name := range []string{"#C-TAG", "#B-TAG", "#A-TAG"} {
+		p.SetCustomSegmentTag(&MockCustomTag{name: name, segment: true, encodedString: name})
+	}
+	if !strings.Contains(p.String(), "#C-TAG\n#B-TAG\n#A-TAG\n#EXTINF") {
+		t.Errorf("Expected segment tags in the insertion order:\n%s", p)
+	}
+	if tags := new(MediaSegment).CustomTags(); tags != nil {
+		t.Errorf("Expected no tags, got %v", tags)
+	}
+}
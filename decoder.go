@@ -0,0 +1,186 @@
+package m3u8
+
+/*
+ Part of M3U8 parser & generator library.
+ This file defines decoder of playlists configurable with options.
+
+ Copyright 2013-2019 The Project Developers.
+ See the AUTHORS and LICENSE files at the top-level directory of this distribution
+ and at https://github.com/grafov/m3u8/
+
+ ॐ तारे तुत्तारे तुरे स्व
+*/
+
+import (
+	"errors"
+	"io"
+	"net/url"
+	"time"
+)
+
+// ErrTooManySegments is returned by decoders when the media playlist
+// has more segments than allowed by WithMaxSegments option.
+var ErrTooManySegments = errors.New("too many segments")
+
+// Strictness is the level of checks done by decoders.
+type Strictness uint8
+
+const (
+	// Lenient decoding skips malformed tags and returns them with
+	// other recovered problems.
+	Lenient Strictness = iota
+	// Strict decoding returns the first syntax error.
+	Strict
+	// Pedantic decoding returns the first syntax error or the first
+	// unknown tag, orphan URI or duplicate tag.
+	Pedantic
+)
+
+// UnknownTagPolicy defines what decoders do with tags and comments
+// they don't recognise.
+type UnknownTagPolicy uint8
+
+const (
+	DropUnknownTags UnknownTagPolicy = iota // unknown tags and comments are ignored
+	KeepUnknownTags                         // unknown tags and comments are kept, see PreserveUnknownTags
+)
+
+// decodeOptions are set by DecodeOption functions.
+type decodeOptions struct {
+	strictness     Strictness
+	customDecoders []CustomDecoder
+	timeParse      func(value string) (time.Time, error)
+	baseURL        *url.URL
+	maxSegments    int
+	unknownTags    UnknownTagPolicy
+}
+
+// strictOptions returns options of decoders accepting `strict`
+// parameter.
+func strictOptions(strict bool) *decodeOptions {
+	if strict {
+		return &decodeOptions{strictness: Strict}
+	}
+	return &decodeOptions{strictness: Lenient}
+}
+
+// configure sets custom decoders and unknown tags policy of the
+// options to the playlist.
+func (p *MasterPlaylist) configure(opts *decodeOptions) {
+	if opts.customDecoders != nil {
+		p.WithCustomDecoders(opts.customDecoders)
+	}
+	if opts.unknownTags == KeepUnknownTags {
+		p.PreserveUnknownTags(true)
+	}
+}
+
+// configure sets custom decoders and unknown tags policy of the
+// options to the playlist.
+func (p *MediaPlaylist) configure(opts *decodeOptions) {
+	if opts.customDecoders != nil {
+		p.WithCustomDecoders(opts.customDecoders)
+	}
+	if opts.unknownTags == KeepUnknownTags {
+		p.PreserveUnknownTags(true)
+	}
+}
+
+// DecodeOption configures Decoder.
+type DecodeOption func(*decodeOptions)
+
+// WithStrictness sets the level of checks done by the decoder. The
+// default level is Lenient.
+func WithStrictness(strictness Strictness) DecodeOption {
+	return func(o *decodeOptions) {
+		o.strictness = strictness
+	}
+}
+
+// WithCustomDecoders sets decoders of custom tags. They are used
+// instead of decoders set by WithCustomDecoders of the playlist.
+func WithCustomDecoders(customDecoders ...CustomDecoder) DecodeOption {
+	return func(o *decodeOptions) {
+		o.customDecoders = customDecoders
+	}
+}
+
+// WithTimeParser sets the parser of EXT-X-PROGRAM-DATE-TIME and
+// EXT-X-DATERANGE dates, for example StrictTimeParse or
+// FullTimeParse. Global TimeParse is used by default.
+func WithTimeParser(parse func(value string) (time.Time, error)) DecodeOption {
+	return func(o *decodeOptions) {
+		o.timeParse = parse
+	}
+}
+
+// WithBaseURL sets the URL of the playlist. Relative URIs of the
+// decoded playlist are resolved against it, see ResolveURIs.
+func WithBaseURL(base *url.URL) DecodeOption {
+	return func(o *decodeOptions) {
+		o.baseURL = base
+	}
+}
+
+// WithMaxSegments limits the number of segments of media playlists.
+// Decoding of longer playlists fails with ErrTooManySegments. Zero
+// means no limit.
+func WithMaxSegments(max int) DecodeOption {
+	return func(o *decodeOptions) {
+		o.maxSegments = max
+	}
+}
+
+// WithUnknownTags sets the policy for tags and comments not recognised
+// by the decoder. They are dropped by default.
+func WithUnknownTags(policy UnknownTagPolicy) DecodeOption {
+	return func(o *decodeOptions) {
+		o.unknownTags = policy
+	}
+}
+
+// Decoder decodes master and media playlists with the same options.
+// It may be used concurrently by several goroutines.
+type Decoder struct {
+	opts decodeOptions
+}
+
+// NewDecoder creates a decoder configured with the options.
+func NewDecoder(options ...DecodeOption) *Decoder {
+	d := new(Decoder)
+	for _, option := range options {
+		option(&d.opts)
+	}
+	return d
+}
+
+// Decode detects type of playlist and decodes it. Problems recovered
+// in Lenient mode are returned with the playlist, the playlist decoded
+// up to the failed line is returned together with the error.
+func (d *Decoder) Decode(reader io.Reader) (Playlist, ListType, []*DecodeError, error) {
+	data, err := readAll(reader)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	return decode(data, &d.opts)
+}
+
+// DecodeMaster decodes the master playlist. Problems recovered in
+// Lenient mode are returned.
+func (d *Decoder) DecodeMaster(p *MasterPlaylist, reader io.Reader) ([]*DecodeError, error) {
+	data, err := readAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	return p.decode(data, &d.opts)
+}
+
+// DecodeMedia decodes the media playlist. Problems recovered in
+// Lenient mode are returned.
+func (d *Decoder) DecodeMedia(p *MediaPlaylist, reader io.Reader) ([]*DecodeError, error) {
+	data, err := readAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	return p.decode(data, &d.opts)
+}
@@ -0,0 +1,166 @@
+package m3u8
+
+/*
+ Decoder options tests.
+
+ Copyright 2013-2019 The Project Developers.
+ See the AUTHORS and LICENSE files at the top-level directory of this distribution
+ and at https://github.com/grafov/m3u8/
+
+ ॐ तारे तुत्तारे तुरे स्व
+*/
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecoderStrictness(t *testing.T) {
+	data, err := ioutil.ReadFile("sample-playlists/media-playlist-damaged.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, listType, problems, err := NewDecoder().Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if listType != MEDIA || p.(*MediaPlaylist).Count() != 3 {
+		t.Errorf("Expected media playlist with 3 segments")
+	}
+	if len(problems) != 5 {
+		t.Errorf("Expected 5 problems, got %d: %v", len(problems), problems)
+	}
+
+	var decodeErr *DecodeError
+	_, _, _, err = NewDecoder(WithStrictness(Strict)).Decode(bytes.NewReader(data))
+	if !errors.As(err, &decodeErr) || decodeErr.Line != 11 {
+		t.Errorf("Expected error of EXT-X-BYTERANGE at line 11, got %v", err)
+	}
+
+	pp, _ := NewMediaPlaylist(3, 3)
+	_, err = NewDecoder(WithStrictness(Pedantic)).DecodeMedia(pp, bytes.NewReader(data))
+	if !errors.Is(err, ErrUnknownTag) || !errors.As(err, &decodeErr) || decodeErr.Line != 5 {
+		t.Errorf("Expected unknown tag at line 5, got %v", err)
+	}
+}
+
+func TestDecoderWithCustomDecoders(t *testing.T) {
+	f, err := os.Open("sample-playlists/media-playlist-with-custom-tags.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDecoder(
+		WithStrictness(Strict),
+		WithCustomDecoders(
+			&MockCustomTag{name: "#CUSTOM-PLAYLIST-TAG:", encodedString: "#CUSTOM-PLAYLIST-TAG:42"},
+			&MockCustomTag{name: "#CUSTOM-SEGMENT-TAG:", segment: true, encodedString: "#CUSTOM-SEGMENT-TAG:NAME=\"Yoda\",JEDI=YES"},
+		),
+	)
+	p, _ := NewMediaPlaylist(4, 4)
+	if _, err = d.DecodeMedia(p, f); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.Custom["#CUSTOM-PLAYLIST-TAG:"]; !ok {
+		t.Error("Expected playlist custom tag")
+	}
+	if _, ok := p.Segments[1].Custom["#CUSTOM-SEGMENT-TAG:"]; !ok {
+		t.Error("Expected custom tag of the second segment")
+	}
+}
+
+func TestDecoderWithTimeParser(t *testing.T) {
+	playlist := "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXT-X-PROGRAM-DATE-TIME:2018-12-31T09:47:22+0800\n#EXTINF:10,\nseg0.ts\n"
+	p, _ := NewMediaPlaylist(1, 1)
+	if _, err := NewDecoder(WithStrictness(Strict), WithTimeParser(FullTimeParse)).DecodeMedia(p, strings.NewReader(playlist)); err != nil {
+		t.Fatal(err)
+	}
+	expected := time.Date(2018, 12, 31, 1, 47, 22, 0, time.UTC)
+	if !p.Segments[0].ProgramDateTime.Equal(expected) {
+		t.Errorf("Expected %v, got %v", expected, p.Segments[0].ProgramDateTime)
+	}
+	p, _ = NewMediaPlaylist(1, 1)
+	if _, err := NewDecoder(WithStrictness(Strict), WithTimeParser(StrictTimeParse)).DecodeMedia(p, strings.NewReader(playlist)); err == nil {
+		t.Error("Expected error of StrictTimeParse")
+	}
+}
+
+func TestDecoderWithBaseURL(t *testing.T) {
+	base, _ := url.Parse("https://example.com/live/master.m3u8")
+	f, err := os.Open("sample-playlists/master-with-alternatives.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewMasterPlaylist()
+	if _, err = NewDecoder(WithBaseURL(base)).DecodeMaster(p, f); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range p.Variants {
+		if !strings.HasPrefix(v.URI, "https://example.com/") {
+			t.Errorf("Expected absolute URI, got %s", v.URI)
+		}
+		for _, alt := range v.Alternatives {
+			if alt.URI != "" && !strings.HasPrefix(alt.URI, "https://example.com/") {
+				t.Errorf("Expected absolute URI, got %s", alt.URI)
+			}
+		}
+	}
+
+	playlist := "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXT-X-KEY:METHOD=AES-128,URI=\"../keys/key1\"\n#EXTINF:10,\nseg0.ts\n#EXTINF:10,\nhttp://cdn.example.com/seg1.ts\n"
+	pl, _, _, err := NewDecoder(WithBaseURL(base)).Decode(strings.NewReader(playlist))
+	if err != nil {
+		t.Fatal(err)
+	}
+	media := pl.(*MediaPlaylist)
+	if media.Segments[0].URI != "https://example.com/live/seg0.ts" {
+		t.Errorf("Unexpected URI of the first segment: %s", media.Segments[0].URI)
+	}
+	if media.Segments[1].URI != "http://cdn.example.com/seg1.ts" {
+		t.Errorf("Unexpected URI of the second segment: %s", media.Segments[1].URI)
+	}
+	if media.Segments[0].Key.URI != "https://example.com/keys/key1" {
+		t.Errorf("Unexpected URI of the key: %s", media.Segments[0].Key.URI)
+	}
+}
+
+func TestDecoderWithMaxSegments(t *testing.T) {
+	data, err := ioutil.ReadFile("sample-playlists/media-playlist-with-unknown-tags.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, _, err = NewDecoder(WithMaxSegments(1)).Decode(bytes.NewReader(data))
+	var decodeErr *DecodeError
+	if !errors.Is(err, ErrTooManySegments) || !errors.As(err, &decodeErr) || decodeErr.Line != 11 {
+		t.Errorf("Expected too many segments at line 11, got %v", err)
+	}
+	p, _ := NewMediaPlaylist(2, 2)
+	if _, err = NewDecoder(WithMaxSegments(2)).DecodeMedia(p, bytes.NewReader(data)); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestDecoderWithUnknownTags(t *testing.T) {
+	data, err := ioutil.ReadFile("sample-playlists/media-playlist-with-unknown-tags.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _, _, err := NewDecoder(WithUnknownTags(KeepUnknownTags)).Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.String() != string(data) {
+		t.Errorf("Encoded playlist differs from the source:\n%s", p)
+	}
+	p, _, _, err = NewDecoder().Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(p.String(), "TWITCH") {
+		t.Errorf("Unexpected unknown tags in the playlist:\n%s", p)
+	}
+}
@@ -0,0 +1,227 @@
+package m3u8
+
+/*
+ Part of M3U8 parser & generator library.
+ This file defines streaming encoder of playlists and its options.
+
+ Copyright 2013-2019 The Project Developers.
+ See the AUTHORS and LICENSE files at the top-level directory of this distribution
+ and at https://github.com/grafov/m3u8/
+
+ ॐ तारे तुत्तारे तुरे स्व
+*/
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AttributeOrder defines the order of attributes in attribute lists
+// of encoded tags.
+type AttributeOrder uint8
+
+const (
+	EncoderAttributeOrder AttributeOrder = iota // attributes are written in the order of the encoder
+	SortedAttributeOrder                        // attributes are sorted by names
+)
+
+// EncodeOptions change the output of Encode and WriteTo. The zero
+// value keeps the default output.
+type EncodeOptions struct {
+	// FloatPrecision is the number of digits after the decimal point
+	// of durations, frame rates and other decimal-floating-point
+	// values. Negative precision means the smallest number of digits
+	// necessary to represent the value. Nil keeps the defaults: three
+	// digits of EXTINF durations and frame rates and the smallest
+	// number of digits of other values.
+	FloatPrecision *int
+	// LineEnding terminates lines of the playlist, "\n" by default.
+	LineEnding string
+	// AttributeOrder is the order of attributes of EXT-X-STREAM-INF,
+	// EXT-X-MEDIA, EXT-X-KEY and other tags with attribute lists.
+	AttributeOrder AttributeOrder
+}
+
+// SetEncodeOptions sets options of the encoder. This operation does
+// reset playlist cache.
+func (p *MasterPlaylist) SetEncodeOptions(opts EncodeOptions) {
+	p.encodeOpts = opts
+	p.buf.Reset()
+}
+
+// SetEncodeOptions sets options of the encoder. This operation does
+// reset playlist cache.
+func (p *MediaPlaylist) SetEncodeOptions(opts EncodeOptions) {
+	p.encodeOpts = opts
+	p.buf.Reset()
+}
+
+// WriteTo writes the master playlist in M3U8 format to the writer. It
+// implements io.WriterTo. Unlike Encode it doesn't use the cache of
+// the playlist: variants are written one by one.
+func (p *MasterPlaylist) WriteTo(w io.Writer) (int64, error) {
+	e := p.newEncoder(new(bytes.Buffer), w)
+	p.encode(e)
+	return e.n, e.err
+}
+
+// WriteTo writes the media playlist in M3U8 format to the writer. It
+// implements io.WriterTo. Unlike Encode it doesn't use the cache of
+// the playlist: segments are written one by one so memory usage
+// doesn't depend on the length of the playlist.
+func (p *MediaPlaylist) WriteTo(w io.Writer) (int64, error) {
+	e := p.newEncoder(new(bytes.Buffer), w)
+	p.encode(e)
+	return e.n, e.err
+}
+
+// encoder keeps the encoded part of the playlist in the buffer. The
+// part is written on flush if the writer is set, otherwise the buffer
+// collects the whole playlist for the cache.
+type encoder struct {
+	buf    *bytes.Buffer
+	w      io.Writer
+	opts   *EncodeOptions
+	expand bool              // expand variable references of the values
+	vars   map[string]string // values of the variables of the playlist
+	tag    string            // tag of the attribute list written by end
+	refs   *varRefs          // raw values of the attributes of the tag
+	attrs  []attribute
+	n      int64
+	err    error
+}
+
+// attribute of the tag with attribute list.
+type attribute struct {
+	name   string
+	value  string
+	quoted bool
+}
+
+func (p *MasterPlaylist) newEncoder(buf *bytes.Buffer, w io.Writer) *encoder {
+	e := &encoder{buf: buf, w: w, opts: &p.encodeOpts, expand: p.expandVars}
+	if len(p.Defines) > 0 {
+		e.vars = p.Variables()
+	}
+	return e
+}
+
+func (p *MediaPlaylist) newEncoder(buf *bytes.Buffer, w io.Writer) *encoder {
+	e := &encoder{buf: buf, w: w, opts: &p.encodeOpts, expand: p.expandVars}
+	if len(p.Defines) > 0 {
+		e.vars = p.Variables()
+	}
+	return e
+}
+
+// flush writes the encoded lines to the writer.
+func (e *encoder) flush() {
+	if e.w == nil || e.err != nil {
+		return
+	}
+	n, err := e.w.Write(e.buf.Bytes())
+	e.n += int64(n)
+	e.err = err
+	e.buf.Reset()
+}
+
+// newline terminates the line with the line ending of the options.
+func (e *encoder) newline() {
+	if e.opts.LineEnding == "" {
+		e.buf.WriteByte('\n')
+	} else {
+		e.buf.WriteString(e.opts.LineEnding)
+	}
+}
+
+// line writes the line without attribute list.
+func (e *encoder) line(text string) {
+	e.buf.WriteString(text)
+	e.newline()
+}
+
+// value returns the value of the attribute or of the URI line to
+// write. The raw value with variable references is written back while
+// it expands to the value. Expanding encoder expands references of the
+// value instead.
+func (e *encoder) value(refs *varRefs, name, value string) string {
+	if len(e.vars) == 0 {
+		return value
+	}
+	if e.expand {
+		if strings.Contains(value, "{$") {
+			value, _ = expandVariables(value, e.vars)
+		}
+		return value
+	}
+	if refs != nil {
+		if raw, ok := refs.raw[name]; ok {
+			if expanded, err := expandVariables(raw, e.vars); err == nil && expanded == value {
+				return raw
+			}
+		}
+	}
+	return value
+}
+
+// begin starts the tag with attribute list. Attributes are collected
+// by attr and quoted and written by end in the order of the options.
+// Raw values of the attributes with variable references are taken
+// from `refs`.
+func (e *encoder) begin(tag string, refs *varRefs) {
+	e.tag = tag
+	e.refs = refs
+	e.attrs = e.attrs[:0]
+}
+
+// attr adds the attribute written as is (enumerated string, decimal
+// integer or float, hexadecimal sequence).
+func (e *encoder) attr(name, value string) {
+	e.attrs = append(e.attrs, attribute{name: name, value: e.value(e.refs, name, value)})
+}
+
+// quoted adds the quoted-string attribute.
+func (e *encoder) quoted(name, value string) {
+	e.attrs = append(e.attrs, attribute{name: name, value: e.value(e.refs, name, value), quoted: true})
+}
+
+// end writes the tag with the collected attributes.
+func (e *encoder) end() {
+	if e.opts.AttributeOrder == SortedAttributeOrder {
+		sort.SliceStable(e.attrs, func(i, j int) bool {
+			return e.attrs[i].name < e.attrs[j].name
+		})
+	}
+	buf := e.buf
+	buf.WriteString(e.tag)
+	for i, a := range e.attrs {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(a.name)
+		buf.WriteByte('=')
+		if a.quoted {
+			buf.WriteByte('"')
+			buf.WriteString(a.value)
+			buf.WriteByte('"')
+		} else {
+			buf.WriteString(a.value)
+		}
+	}
+	e.newline()
+}
+
+// float formats the value with the precision of the options or with
+// the default precision `prec`.
+func (e *encoder) float(value float64, prec, bitSize int) string {
+	if e.opts.FloatPrecision != nil {
+		prec = *e.opts.FloatPrecision
+		if prec < 0 {
+			prec = -1
+		}
+	}
+	return strconv.FormatFloat(value, 'f', prec, bitSize)
+}
@@ -0,0 +1,210 @@
+package m3u8
+
+/*
+ Streaming encoder tests.
+
+ Copyright 2013-2019 The Project Developers.
+ See the AUTHORS and LICENSE files at the top-level directory of this distribution
+ and at https://github.com/grafov/m3u8/
+
+ ॐ तारे तुत्तारे तुरे स्व
+*/
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWriteToLikeEncode(t *testing.T) {
+	for _, name := range []string{
+		"master.m3u8",
+		"master-with-alternatives.m3u8",
+		"media-playlist-large.m3u8",
+		"media-playlist-low-latency.m3u8",
+		"media-playlist-with-oatcls-scte35.m3u8",
+	} {
+		f, err := os.Open("sample-playlists/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, _, err := DecodeFrom(f, true)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var buf bytes.Buffer
+		n, err := p.(io.WriterTo).WriteTo(&buf)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if n != int64(buf.Len()) {
+			t.Errorf("%s: %d bytes reported, %d written", name, n, buf.Len())
+		}
+		if buf.String() != p.String() {
+			t.Errorf("%s: WriteTo output differs from Encode:\n%s", name, buf.String())
+		}
+	}
+}
+
+func TestWriteToWithVariables(t *testing.T) {
+	f, err := os.Open("sample-playlists/master-with-define.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewMasterPlaylist()
+	p.SetQueryParams(url.Values{"token": {"abc"}})
+	if err = p.DecodeFrom(f, true); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err = p.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "{$host}") || buf.String() != p.String() {
+		t.Errorf("Expected variable references in the output:\n%s", buf.String())
+	}
+}
+
+func TestWriteToDoesNotUseCache(t *testing.T) {
+	p, _ := NewMediaPlaylist(3, 3)
+	p.Append("test01.ts", 10, "")
+	p.Append("test02.ts", 10, "")
+	var buf bytes.Buffer
+	if _, err := p.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if p.buf.Len() != 0 {
+		t.Error("Expected empty cache after WriteTo")
+	}
+	// the output doesn't share memory with the playlist
+	out := buf.Bytes()
+	copy(out, "#EXTM4U")
+	if !strings.HasPrefix(p.String(), "#EXTM3U") {
+		t.Error("Playlist changed by the output of WriteTo")
+	}
+}
+
+func TestWriteToConcurrent(t *testing.T) {
+	p, _ := NewMediaPlaylist(3, 3)
+	p.Append("test01.ts", 10, "")
+	p.SetVersion(7)
+	p.SetAutoVersion(true)
+	expected := p.String()
+	p.ResetCache()
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			var buf bytes.Buffer
+			_, err := p.WriteTo(&buf)
+			if err == nil && buf.String() != expected {
+				err = errors.New("unexpected output: " + buf.String())
+			}
+			errs <- err
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+	if p.ver != 7 {
+		t.Errorf("Expected version kept by WriteTo: 7, got: %v", p.ver)
+	}
+}
+
+type failingWriter struct {
+	writes int
+}
+
+func (w *failingWriter) Write(data []byte) (int, error) {
+	w.writes++
+	return 0, errors.New("write failed")
+}
+
+func TestWriteToError(t *testing.T) {
+	p, _ := NewMediaPlaylist(0, 100)
+	for i := 0; i < 100; i++ {
+		p.Append("test.ts", 10, "")
+	}
+	w := new(failingWriter)
+	if _, err := p.WriteTo(w); err == nil || err.Error() != "write failed" {
+		t.Errorf("Expected write error, got %v", err)
+	}
+	if w.writes != 1 {
+		t.Errorf("Expected single write, got %d", w.writes)
+	}
+}
+
+func TestEncodeOptions(t *testing.T) {
+	p, _ := NewMediaPlaylist(2, 2)
+	p.Append("test01.ts", 9.5, "")
+	p.Append("test02.ts", 10, "")
+	p.SetDefaultKey("AES-128", "https://example.com/key", "0x1", "", "")
+
+	one, zero, shortest := 1, 0, -1
+	p.SetEncodeOptions(EncodeOptions{FloatPrecision: &one})
+	if out := p.String(); !strings.Contains(out, "#EXTINF:9.5,\n") || !strings.Contains(out, "#EXTINF:10.0,\n") {
+		t.Errorf("Expected durations with single digit after the point:\n%s", out)
+	}
+	p.SetEncodeOptions(EncodeOptions{FloatPrecision: &zero})
+	if out := p.String(); !strings.Contains(out, "#EXTINF:10,\ntest01.ts") || !strings.Contains(out, "#EXTINF:10,\ntest02.ts") {
+		t.Errorf("Expected durations without digits after the point:\n%s", out)
+	}
+	p.SetEncodeOptions(EncodeOptions{FloatPrecision: &shortest})
+	if out := p.String(); !strings.Contains(out, "#EXTINF:9.5,\n") || !strings.Contains(out, "#EXTINF:10,\n") {
+		t.Errorf("Expected shortest durations:\n%s", out)
+	}
+
+	p.SetEncodeOptions(EncodeOptions{LineEnding: "\r\n"})
+	out := p.String()
+	if strings.Count(out, "\r\n") != strings.Count(out, "\n") {
+		t.Errorf("Expected CRLF line endings:\n%q", out)
+	}
+	var buf bytes.Buffer
+	if _, err := p.WriteTo(&buf); err != nil || buf.String() != out {
+		t.Errorf("Expected the same output of WriteTo, got %q: %v", buf.String(), err)
+	}
+
+	p.SetEncodeOptions(EncodeOptions{AttributeOrder: SortedAttributeOrder})
+	if out := p.String(); !strings.Contains(out, "#EXT-X-KEY:IV=0x1,METHOD=AES-128,URI=\"https://example.com/key\"\n") {
+		t.Errorf("Expected sorted attributes of the key:\n%s", out)
+	}
+}
+
+func TestEncodeOptionsOfMasterPlaylist(t *testing.T) {
+	p := NewMasterPlaylist()
+	p.Append("chunklist.m3u8", nil, VariantParams{Bandwidth: 300000, Codecs: "avc1.42c015,mp4a.40.2", Audio: "aac", FrameRate: 25})
+	p.SetEncodeOptions(EncodeOptions{AttributeOrder: SortedAttributeOrder, LineEnding: "\r\n"})
+	expected := "#EXT-X-STREAM-INF:AUDIO=\"aac\",BANDWIDTH=300000,CODECS=\"avc1.42c015,mp4a.40.2\",FRAME-RATE=25.000,PROGRAM-ID=0\r\nchunklist.m3u8\r\n"
+	if out := p.String(); !strings.HasSuffix(out, expected) {
+		t.Errorf("Expected sorted attributes of the variant:\n%q", out)
+	}
+	var buf bytes.Buffer
+	if _, err := p.WriteTo(&buf); err != nil || buf.String() != p.String() {
+		t.Errorf("Expected the same output of WriteTo, got %q: %v", buf.String(), err)
+	}
+}
+
+func BenchmarkMediaPlaylistWriteTo(b *testing.B) {
+	data, err := ioutil.ReadFile("sample-playlists/media-playlist-large.m3u8")
+	if err != nil {
+		b.Fatal(err)
+	}
+	p, _ := NewMediaPlaylist(50000, 50000)
+	if err = p.DecodeFrom(bytes.NewReader(data), true); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.WriteTo(ioutil.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,883 @@
+package m3u8
+
+/*
+ Part of M3U8 parser & generator library.
+ This file defines JSON and text marshalling of playlists.
+
+ Copyright 2013-2019 The Project Developers.
+ See the AUTHORS and LICENSE files at the top-level directory of this distribution
+ and at https://github.com/grafov/m3u8/
+
+ ॐ तारे तुत्तारे तुरे स्व
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// JSON schema of playlists. Keys are named after the tags and
+// attributes of the M3U8 format in snake case. Empty optional values
+// are omitted. Times are formatted as RFC 3339 strings. Custom tags
+// are kept as the lines written by Encode and decoded back by custom
+// decoders of the playlist. Widevine tags are not included.
+
+// maxJSONCapacity limits the capacity of the media playlist decoded
+// from JSON beyond its segments so a small input can't force a huge
+// allocation.
+const maxJSONCapacity = 1 << 20
+
+type mediaPlaylistJSON struct {
+	Version            uint8              `json:"version"`
+	TargetDuration     float64            `json:"target_duration"`
+	SeqNo              uint64             `json:"media_sequence"`
+	DiscontinuitySeq   uint64             `json:"discontinuity_sequence,omitempty"`
+	MediaType          string             `json:"playlist_type,omitempty"` // EVENT or VOD
+	Iframe             bool               `json:"i_frames_only,omitempty"`
+	Closed             bool               `json:"closed,omitempty"`
+	StartTime          float64            `json:"start_time_offset,omitempty"`
+	StartTimePrecise   bool               `json:"start_precise,omitempty"`
+	WinSize            uint               `json:"window_size"`
+	Capacity           uint               `json:"capacity"`
+	DurationAsInt      bool               `json:"duration_as_int,omitempty"`
+	Args               string             `json:"args,omitempty"`
+	Defines            []*Define          `json:"defines,omitempty"`
+	Key                *Key               `json:"key,omitempty"`
+	Map                *Map               `json:"map,omitempty"`
+	DateRanges         []*DateRange       `json:"date_ranges,omitempty"`
+	ServerControl      *ServerControl     `json:"server_control,omitempty"`
+	PartTargetDuration float64            `json:"part_target_duration,omitempty"`
+	Skip               *Skip              `json:"skip,omitempty"`
+	Segments           []*MediaSegment    `json:"segments"` // from the oldest to the newest segment
+	PendingParts       []*PartialSegment  `json:"pending_parts,omitempty"`
+	PendingDateRanges  []*DateRange       `json:"pending_date_ranges,omitempty"`
+	PreloadHints       []*PreloadHint     `json:"preload_hints,omitempty"`
+	RenditionReports   []*RenditionReport `json:"rendition_reports,omitempty"`
+	CustomTags         []string           `json:"custom_tags,omitempty"`
+	UnknownTags        []string           `json:"unknown_tags,omitempty"`
+	TrailingTags       []string           `json:"trailing_tags,omitempty"`
+}
+
+type masterPlaylistJSON struct {
+	Version             uint8            `json:"version"`
+	IndependentSegments bool             `json:"independent_segments,omitempty"`
+	Args                string           `json:"args,omitempty"`
+	CypherVersion       string           `json:"cypher_version,omitempty"`
+	Defines             []*Define        `json:"defines,omitempty"`
+	SessionData         []*SessionData   `json:"session_data,omitempty"`
+	SessionKeys         []*Key           `json:"session_keys,omitempty"`
+	ContentSteering     *ContentSteering `json:"content_steering,omitempty"`
+	Variants            []*Variant       `json:"variants"`
+	CustomTags          []string         `json:"custom_tags,omitempty"`
+	UnknownTags         []string         `json:"unknown_tags,omitempty"`
+	TrailingTags        []string         `json:"trailing_tags,omitempty"`
+}
+
+type variantJSON struct {
+	URI         string         `json:"uri"`
+	Chunklist   *MediaPlaylist `json:"chunklist,omitempty"`
+	UnknownTags []string       `json:"unknown_tags,omitempty"`
+	variantParamsJSON
+}
+
+type variantParamsJSON struct {
+	ProgramId          uint32         `json:"program_id"`
+	Bandwidth          uint32         `json:"bandwidth"`
+	AverageBandwidth   uint32         `json:"average_bandwidth,omitempty"`
+	Codecs             string         `json:"codecs,omitempty"`
+	Resolution         string         `json:"resolution,omitempty"`
+	Audio              string         `json:"audio,omitempty"`
+	Video              string         `json:"video,omitempty"`
+	Subtitles          string         `json:"subtitles,omitempty"`
+	Captions           string         `json:"closed_captions,omitempty"`
+	Name               string         `json:"name,omitempty"`
+	Iframe             bool           `json:"i_frame,omitempty"`
+	VideoRange         string         `json:"video_range,omitempty"`
+	HDCPLevel          string         `json:"hdcp_level,omitempty"`
+	FrameRate          float64        `json:"frame_rate,omitempty"`
+	Alternatives       []*Alternative `json:"alternatives,omitempty"`
+	PathwayID          string         `json:"pathway_id,omitempty"`
+	StableVariantID    string         `json:"stable_variant_id,omitempty"`
+	Score              float64        `json:"score,omitempty"`
+	SupplementalCodecs string         `json:"supplemental_codecs,omitempty"`
+	AllowedCPC         string         `json:"allowed_cpc,omitempty"`
+	ReqVideoLayout     string         `json:"req_video_layout,omitempty"`
+}
+
+type alternativeJSON struct {
+	Type              string `json:"type"`
+	GroupId           string `json:"group_id"`
+	Name              string `json:"name"`
+	URI               string `json:"uri,omitempty"`
+	Language          string `json:"language,omitempty"`
+	AssocLanguage     string `json:"assoc_language,omitempty"`
+	Default           bool   `json:"default,omitempty"`
+	Autoselect        string `json:"autoselect,omitempty"`
+	Forced            string `json:"forced,omitempty"`
+	InstreamId        string `json:"instream_id,omitempty"`
+	Characteristics   string `json:"characteristics,omitempty"`
+	Channels          string `json:"channels,omitempty"`
+	BitDepth          uint32 `json:"bit_depth,omitempty"`
+	SampleRate        uint32 `json:"sample_rate,omitempty"`
+	Subtitles         string `json:"subtitles,omitempty"`
+	StableRenditionID string `json:"stable_rendition_id,omitempty"`
+}
+
+type mediaSegmentJSON struct {
+	SeqId           uint64            `json:"sequence"`
+	URI             string            `json:"uri"`
+	Duration        float64           `json:"duration"`
+	Title           string            `json:"title,omitempty"`
+	Limit           int64             `json:"byterange_length,omitempty"`
+	Offset          int64             `json:"byterange_offset,omitempty"`
+	Key             *Key              `json:"key,omitempty"`
+	Map             *Map              `json:"map,omitempty"`
+	Discontinuity   bool              `json:"discontinuity,omitempty"`
+	SCTE            *SCTE             `json:"scte35,omitempty"`
+	ProgramDateTime *time.Time        `json:"program_date_time,omitempty"`
+	Parts           []*PartialSegment `json:"parts,omitempty"`
+	DateRanges      []*DateRange      `json:"date_ranges,omitempty"`
+	Gap             bool              `json:"gap,omitempty"`
+	Bitrate         int64             `json:"bitrate,omitempty"`
+	CustomTags      []string          `json:"custom_tags,omitempty"`
+	UnknownTags     []string          `json:"unknown_tags,omitempty"`
+}
+
+// segmentJSON decodes the media segment keeping lines of its custom
+// tags for custom decoders of the playlist.
+type segmentJSON struct {
+	seg        *MediaSegment
+	customTags []string
+}
+
+type scteJSON struct {
+	Syntax  string  `json:"syntax"`   // 67-2014 or OATCLS
+	CueType string  `json:"cue_type"` // start, mid or end
+	Cue     string  `json:"cue,omitempty"`
+	ID      string  `json:"id,omitempty"`
+	Time    float64 `json:"time,omitempty"`
+	Elapsed float64 `json:"elapsed,omitempty"`
+}
+
+type dateRangeJSON struct {
+	ID              string            `json:"id"`
+	Class           string            `json:"class,omitempty"`
+	StartDate       *time.Time        `json:"start_date,omitempty"`
+	EndDate         *time.Time        `json:"end_date,omitempty"`
+	Duration        *float64          `json:"duration,omitempty"`
+	PlannedDuration float64           `json:"planned_duration,omitempty"`
+	EndOnNext       bool              `json:"end_on_next,omitempty"`
+	SCTE35Cmd       string            `json:"scte35_cmd,omitempty"`
+	SCTE35Out       string            `json:"scte35_out,omitempty"`
+	SCTE35In        string            `json:"scte35_in,omitempty"`
+	X               map[string]string `json:"x,omitempty"`
+}
+
+type defineJSON struct {
+	Name  string `json:"name"`
+	Value string `json:"value,omitempty"`
+	Type  string `json:"type"` // VALUE, IMPORT or QUERYPARAM
+}
+
+// The types below have the same fields as the types of the package
+// so they are converted directly.
+
+type keyJSON struct {
+	Method            string `json:"method"`
+	URI               string `json:"uri,omitempty"`
+	IV                string `json:"iv,omitempty"`
+	Keyformat         string `json:"keyformat,omitempty"`
+	Keyformatversions string `json:"keyformatversions,omitempty"`
+	vars              *varRefs
+}
+
+type mapJSON struct {
+	URI    string `json:"uri"`
+	Limit  int64  `json:"byterange_length,omitempty"`
+	Offset int64  `json:"byterange_offset,omitempty"`
+	vars   *varRefs
+}
+
+type partialSegmentJSON struct {
+	URI         string  `json:"uri"`
+	Duration    float64 `json:"duration"`
+	Independent bool    `json:"independent,omitempty"`
+	Limit       int64   `json:"byterange_length,omitempty"`
+	Offset      int64   `json:"byterange_offset,omitempty"`
+	Gap         bool    `json:"gap,omitempty"`
+	vars        *varRefs
+}
+
+type serverControlJSON struct {
+	CanBlockReload    bool    `json:"can_block_reload,omitempty"`
+	CanSkipUntil      float64 `json:"can_skip_until,omitempty"`
+	CanSkipDateRanges bool    `json:"can_skip_dateranges,omitempty"`
+	HoldBack          float64 `json:"hold_back,omitempty"`
+	PartHoldBack      float64 `json:"part_hold_back,omitempty"`
+}
+
+type preloadHintJSON struct {
+	Type   string `json:"type"`
+	URI    string `json:"uri"`
+	Offset int64  `json:"byterange_start,omitempty"`
+	Limit  int64  `json:"byterange_length,omitempty"`
+	vars   *varRefs
+}
+
+type renditionReportJSON struct {
+	URI      string `json:"uri"`
+	LastMSN  uint64 `json:"last_msn"`
+	LastPart *int64 `json:"last_part,omitempty"`
+	vars     *varRefs
+}
+
+type skipJSON struct {
+	SkippedSegments           uint64   `json:"skipped_segments"`
+	RecentlyRemovedDateRanges []string `json:"recently_removed_dateranges,omitempty"`
+	SkippedDateRanges         bool     `json:"skipped_dateranges,omitempty"`
+}
+
+type sessionDataJSON struct {
+	DataID   string `json:"data_id"`
+	Value    string `json:"value,omitempty"`
+	URI      string `json:"uri,omitempty"`
+	Format   string `json:"format,omitempty"`
+	Language string `json:"language,omitempty"`
+	vars     *varRefs
+}
+
+type contentSteeringJSON struct {
+	ServerURI string `json:"server_uri"`
+	PathwayID string `json:"pathway_id,omitempty"`
+	vars      *varRefs
+}
+
+var (
+	mediaTypeNames  = map[MediaType]string{EVENT: "EVENT", VOD: "VOD"}
+	defineTypeNames = map[DefineType]string{DefineValue: "VALUE", DefineImport: "IMPORT", DefineQueryParam: "QUERYPARAM"}
+	scteSyntaxNames = map[SCTE35Syntax]string{SCTE35_67_2014: "67-2014", SCTE35_OATCLS: "OATCLS"}
+	scteCueNames    = map[SCTE35CueType]string{SCTE35Cue_Start: "start", SCTE35Cue_Mid: "mid", SCTE35Cue_End: "end"}
+)
+
+// MarshalJSON encodes the media playlist as a JSON object. Segments
+// are listed from the oldest to the newest one regardless of the
+// window size. State of the playlist required to append segments
+// (window size and capacity) is kept so the decoded playlist may be
+// used as the source one.
+func (p *MediaPlaylist) MarshalJSON() ([]byte, error) {
+	v := mediaPlaylistJSON{
+		Version:            p.ver,
+		TargetDuration:     p.TargetDuration,
+		SeqNo:              p.SeqNo,
+		DiscontinuitySeq:   p.DiscontinuitySeq,
+		MediaType:          mediaTypeNames[p.MediaType],
+		Iframe:             p.Iframe,
+		Closed:             p.Closed,
+		StartTime:          p.StartTime,
+		StartTimePrecise:   p.StartTimePrecise,
+		WinSize:            p.winsize,
+		Capacity:           p.capacity,
+		DurationAsInt:      p.durationAsInt,
+		Args:               p.Args,
+		Defines:            p.Defines,
+		Key:                p.Key,
+		Map:                p.Map,
+		DateRanges:         p.DateRanges,
+		ServerControl:      p.ServerControl,
+		PartTargetDuration: p.PartTargetDuration,
+		Skip:               p.Skip,
+		Segments:           make([]*MediaSegment, 0, p.count),
+		PendingParts:       p.PendingParts,
+		PendingDateRanges:  p.PendingDateRanges,
+		PreloadHints:       p.PreloadHints,
+		RenditionReports:   p.RenditionReports,
+		CustomTags:         encodeCustomTags(p.CustomTags()),
+		UnknownTags:        p.UnknownTags,
+		TrailingTags:       p.TrailingTags,
+	}
+	for i, n := p.head, uint(0); n < p.count; i, n = (i+1)%p.capacity, n+1 {
+		if p.Segments[i] != nil {
+			v.Segments = append(v.Segments, p.Segments[i])
+		}
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON decodes the media playlist from JSON object created by
+// MarshalJSON. The content of the playlist is replaced, custom
+// decoders and encode options are kept. Custom tags are decoded by
+// the custom decoders, a custom tag without the decoder is an error.
+func (p *MediaPlaylist) UnmarshalJSON(data []byte) error {
+	var v struct {
+		mediaPlaylistJSON
+		Segments []*segmentJSON `json:"segments"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	segments := make([]*MediaSegment, 0, len(v.Segments))
+	for _, s := range v.Segments {
+		if s == nil {
+			continue
+		}
+		if len(s.customTags) > 0 {
+			s.seg.Custom = make(map[string]CustomTag)
+			if err := decodeCustomTags(s.customTags, p.customDecoders, s.seg.Custom, &s.seg.customOrder); err != nil {
+				return err
+			}
+		}
+		segments = append(segments, s.seg)
+	}
+	capacity := v.Capacity
+	if capacity < uint(len(segments)) {
+		capacity = uint(len(segments))
+	} else if capacity > maxJSONCapacity {
+		return fmt.Errorf("capacity %d exceeds the limit %d", capacity, maxJSONCapacity)
+	}
+	pl, err := NewMediaPlaylist(v.WinSize, capacity)
+	if err != nil {
+		return err
+	}
+	if v.Version > 0 {
+		pl.ver = v.Version
+	}
+	if v.MediaType != "" {
+		if pl.MediaType, err = parseMediaType(v.MediaType); err != nil {
+			return err
+		}
+	}
+	pl.TargetDuration = v.TargetDuration
+	pl.SeqNo = v.SeqNo
+	pl.DiscontinuitySeq = v.DiscontinuitySeq
+	pl.Iframe = v.Iframe
+	pl.Closed = v.Closed
+	pl.StartTime = v.StartTime
+	pl.StartTimePrecise = v.StartTimePrecise
+	pl.durationAsInt = v.DurationAsInt
+	pl.Args = v.Args
+	pl.Defines = v.Defines
+	pl.Key = v.Key
+	pl.Map = v.Map
+	pl.DateRanges = v.DateRanges
+	pl.ServerControl = v.ServerControl
+	pl.PartTargetDuration = v.PartTargetDuration
+	pl.Skip = v.Skip
+	pl.PendingParts = v.PendingParts
+	pl.PendingDateRanges = v.PendingDateRanges
+	pl.PreloadHints = v.PreloadHints
+	pl.RenditionReports = v.RenditionReports
+	pl.UnknownTags = v.UnknownTags
+	pl.TrailingTags = v.TrailingTags
+	copy(pl.Segments, segments)
+	pl.count = uint(len(segments))
+	if capacity > 0 {
+		pl.tail = pl.count % capacity
+	}
+	pl.configure(p.textOptions())
+	if len(v.CustomTags) > 0 {
+		if pl.Custom == nil {
+			pl.Custom = make(map[string]CustomTag)
+		}
+		if err := decodeCustomTags(v.CustomTags, p.customDecoders, pl.Custom, &pl.customOrder); err != nil {
+			return err
+		}
+	}
+	pl.encodeOpts = p.encodeOpts
+	*p = *pl
+	return nil
+}
+
+// MarshalText encodes the media playlist in M3U8 format.
+func (p *MediaPlaylist) MarshalText() ([]byte, error) {
+	return append([]byte(nil), p.Encode().Bytes()...), nil
+}
+
+// UnmarshalText decodes the media playlist in M3U8 format in strict
+// mode. The content of the playlist is replaced, custom decoders and
+// encode options are kept. The capacity of the playlist is extended
+// to fit all segments.
+func (p *MediaPlaylist) UnmarshalText(text []byte) error {
+	pl, _, err := decodeMediaPlaylist(string(text), p.textOptions())
+	if err != nil {
+		return err
+	}
+	pl.encodeOpts = p.encodeOpts
+	*p = *pl
+	return nil
+}
+
+// MarshalJSON encodes the master playlist as a JSON object. Media
+// playlists linked to variants are included as `chunklist` objects.
+func (p *MasterPlaylist) MarshalJSON() ([]byte, error) {
+	v := masterPlaylistJSON{
+		Version:             p.ver,
+		IndependentSegments: p.independentSegments,
+		Args:                p.Args,
+		CypherVersion:       p.CypherVersion,
+		Defines:             p.Defines,
+		SessionData:         p.SessionData,
+		SessionKeys:         p.SessionKeys,
+		ContentSteering:     p.ContentSteering,
+		Variants:            p.Variants,
+		CustomTags:          encodeCustomTags(p.CustomTags()),
+		UnknownTags:         p.UnknownTags,
+		TrailingTags:        p.TrailingTags,
+	}
+	if v.Variants == nil {
+		v.Variants = []*Variant{}
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON decodes the master playlist from JSON object created
+// by MarshalJSON. The content of the playlist is replaced, custom
+// decoders and encode options are kept. Custom tags are decoded by
+// the custom decoders, a custom tag without the decoder is an error.
+func (p *MasterPlaylist) UnmarshalJSON(data []byte) error {
+	var v masterPlaylistJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	pl := NewMasterPlaylist()
+	if v.Version > 0 {
+		pl.ver = v.Version
+	}
+	pl.independentSegments = v.IndependentSegments
+	pl.Args = v.Args
+	pl.CypherVersion = v.CypherVersion
+	pl.Defines = v.Defines
+	pl.SessionData = v.SessionData
+	pl.SessionKeys = v.SessionKeys
+	pl.ContentSteering = v.ContentSteering
+	pl.Variants = v.Variants
+	pl.UnknownTags = v.UnknownTags
+	pl.TrailingTags = v.TrailingTags
+	pl.configure(p.textOptions())
+	if len(v.CustomTags) > 0 {
+		if pl.Custom == nil {
+			pl.Custom = make(map[string]CustomTag)
+		}
+		if err := decodeCustomTags(v.CustomTags, p.customDecoders, pl.Custom, &pl.customOrder); err != nil {
+			return err
+		}
+	}
+	pl.encodeOpts = p.encodeOpts
+	*p = *pl
+	return nil
+}
+
+// MarshalText encodes the master playlist in M3U8 format.
+func (p *MasterPlaylist) MarshalText() ([]byte, error) {
+	return append([]byte(nil), p.Encode().Bytes()...), nil
+}
+
+// UnmarshalText decodes the master playlist in M3U8 format in strict
+// mode. The content of the playlist is replaced, custom decoders and
+// encode options are kept.
+func (p *MasterPlaylist) UnmarshalText(text []byte) error {
+	pl := NewMasterPlaylist()
+	if _, err := pl.decode(string(text), p.textOptions()); err != nil {
+		return err
+	}
+	pl.encodeOpts = p.encodeOpts
+	*p = *pl
+	return nil
+}
+
+// MarshalJSON encodes the variant with its parameters and
+// alternatives as a JSON object.
+func (v Variant) MarshalJSON() ([]byte, error) {
+	return json.Marshal(variantJSON{
+		URI:               v.URI,
+		Chunklist:         v.Chunklist,
+		UnknownTags:       v.UnknownTags,
+		variantParamsJSON: variantParamsJSON(v.VariantParams),
+	})
+}
+
+// UnmarshalJSON decodes the variant from JSON object.
+func (v *Variant) UnmarshalJSON(data []byte) error {
+	var w variantJSON
+	if err := json.Unmarshal(data, &w); err != nil {
+		return err
+	}
+	v.URI, v.Chunklist, v.UnknownTags = w.URI, w.Chunklist, w.UnknownTags
+	v.VariantParams = VariantParams(w.variantParamsJSON)
+	return nil
+}
+
+// MarshalJSON encodes the alternative rendition as a JSON object.
+func (a Alternative) MarshalJSON() ([]byte, error) {
+	v := alternativeJSON{
+		Type:              a.Type,
+		GroupId:           a.GroupId,
+		Name:              a.Name,
+		URI:               a.URI,
+		Language:          a.Language,
+		AssocLanguage:     a.AssocLanguage,
+		Default:           a.Default,
+		Autoselect:        a.Autoselect,
+		Forced:            a.Forced,
+		InstreamId:        a.InstreamId,
+		Characteristics:   a.Characteristics,
+		BitDepth:          a.BitDepth,
+		SampleRate:        a.SampleRate,
+		Subtitles:         a.Subtitles,
+		StableRenditionID: a.StableRenditionID,
+	}
+	if a.Channels != nil {
+		v.Channels = a.Channels.String()
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON decodes the alternative rendition from JSON object.
+func (a *Alternative) UnmarshalJSON(data []byte) error {
+	var v alternativeJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*a = Alternative{
+		Type:              v.Type,
+		GroupId:           v.GroupId,
+		Name:              v.Name,
+		URI:               v.URI,
+		Language:          v.Language,
+		AssocLanguage:     v.AssocLanguage,
+		Default:           v.Default,
+		Autoselect:        v.Autoselect,
+		Forced:            v.Forced,
+		InstreamId:        v.InstreamId,
+		Characteristics:   v.Characteristics,
+		BitDepth:          v.BitDepth,
+		SampleRate:        v.SampleRate,
+		Subtitles:         v.Subtitles,
+		StableRenditionID: v.StableRenditionID,
+	}
+	if v.Channels != "" {
+		channels, err := decodeChannels(v.Channels)
+		if err != nil {
+			return err
+		}
+		a.Channels = channels
+	}
+	return nil
+}
+
+// MarshalJSON encodes the media segment as a JSON object.
+func (seg MediaSegment) MarshalJSON() ([]byte, error) {
+	return json.Marshal(mediaSegmentJSON{
+		SeqId:           seg.SeqId,
+		URI:             seg.URI,
+		Duration:        seg.Duration,
+		Title:           seg.Title,
+		Limit:           seg.Limit,
+		Offset:          seg.Offset,
+		Key:             seg.Key,
+		Map:             seg.Map,
+		Discontinuity:   seg.Discontinuity,
+		SCTE:            seg.SCTE,
+		ProgramDateTime: timeOrNil(seg.ProgramDateTime),
+		Parts:           seg.Parts,
+		DateRanges:      seg.DateRanges,
+		Gap:             seg.Gap,
+		Bitrate:         seg.Bitrate,
+		CustomTags:      encodeCustomTags(seg.CustomTags()),
+		UnknownTags:     seg.UnknownTags,
+	})
+}
+
+// UnmarshalJSON decodes the media segment from JSON object. Custom
+// tags are decoded only by UnmarshalJSON of the media playlist with
+// the custom decoders, the segment with custom tags is an error here.
+func (seg *MediaSegment) UnmarshalJSON(data []byte) error {
+	customTags, err := seg.unmarshalJSON(data)
+	if err != nil {
+		return err
+	}
+	return decodeCustomTags(customTags, nil, nil, nil)
+}
+
+// UnmarshalJSON decodes the media segment and lines of its custom tags.
+func (s *segmentJSON) UnmarshalJSON(data []byte) (err error) {
+	s.seg = new(MediaSegment)
+	s.customTags, err = s.seg.unmarshalJSON(data)
+	return err
+}
+
+func (seg *MediaSegment) unmarshalJSON(data []byte) ([]string, error) {
+	var v mediaSegmentJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	*seg = MediaSegment{
+		SeqId:         v.SeqId,
+		URI:           v.URI,
+		Duration:      v.Duration,
+		Title:         v.Title,
+		Limit:         v.Limit,
+		Offset:        v.Offset,
+		Key:           v.Key,
+		Map:           v.Map,
+		Discontinuity: v.Discontinuity,
+		SCTE:          v.SCTE,
+		Parts:         v.Parts,
+		DateRanges:    v.DateRanges,
+		Gap:           v.Gap,
+		Bitrate:       v.Bitrate,
+		UnknownTags:   v.UnknownTags,
+	}
+	if v.ProgramDateTime != nil {
+		seg.ProgramDateTime = *v.ProgramDateTime
+	}
+	return v.CustomTags, nil
+}
+
+// MarshalJSON encodes the SCTE-35 cue as a JSON object.
+func (s SCTE) MarshalJSON() ([]byte, error) {
+	return json.Marshal(scteJSON{
+		Syntax:  scteSyntaxNames[s.Syntax],
+		CueType: scteCueNames[s.CueType],
+		Cue:     s.Cue,
+		ID:      s.ID,
+		Time:    s.Time,
+		Elapsed: s.Elapsed,
+	})
+}
+
+// UnmarshalJSON decodes the SCTE-35 cue from JSON object.
+func (s *SCTE) UnmarshalJSON(data []byte) error {
+	var v scteJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*s = SCTE{Cue: v.Cue, ID: v.ID, Time: v.Time, Elapsed: v.Elapsed}
+	var ok bool
+	if s.Syntax, ok = scteSyntaxByName(v.Syntax); !ok {
+		return fmt.Errorf("unknown SCTE-35 syntax %q", v.Syntax)
+	}
+	if s.CueType, ok = scteCueByName(v.CueType); !ok {
+		return fmt.Errorf("unknown SCTE-35 cue type %q", v.CueType)
+	}
+	return nil
+}
+
+// MarshalJSON encodes the date range as a JSON object.
+func (dr DateRange) MarshalJSON() ([]byte, error) {
+	return json.Marshal(dateRangeJSON{
+		ID:              dr.ID,
+		Class:           dr.Class,
+		StartDate:       timeOrNil(dr.StartDate),
+		EndDate:         timeOrNil(dr.EndDate),
+		Duration:        dr.Duration,
+		PlannedDuration: dr.PlannedDuration,
+		EndOnNext:       dr.EndOnNext,
+		SCTE35Cmd:       dr.SCTE35Cmd,
+		SCTE35Out:       dr.SCTE35Out,
+		SCTE35In:        dr.SCTE35In,
+		X:               dr.X,
+	})
+}
+
+// UnmarshalJSON decodes the date range from JSON object.
+func (dr *DateRange) UnmarshalJSON(data []byte) error {
+	var v dateRangeJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*dr = DateRange{
+		ID:              v.ID,
+		Class:           v.Class,
+		Duration:        v.Duration,
+		PlannedDuration: v.PlannedDuration,
+		EndOnNext:       v.EndOnNext,
+		SCTE35Cmd:       v.SCTE35Cmd,
+		SCTE35Out:       v.SCTE35Out,
+		SCTE35In:        v.SCTE35In,
+		X:               v.X,
+	}
+	if v.StartDate != nil {
+		dr.StartDate = *v.StartDate
+	}
+	if v.EndDate != nil {
+		dr.EndDate = *v.EndDate
+	}
+	return nil
+}
+
+// MarshalJSON encodes the variable definition as a JSON object.
+func (d Define) MarshalJSON() ([]byte, error) {
+	return json.Marshal(defineJSON{Name: d.Name, Value: d.Value, Type: defineTypeNames[d.Type]})
+}
+
+// UnmarshalJSON decodes the variable definition from JSON object.
+func (d *Define) UnmarshalJSON(data []byte) error {
+	var v defineJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	for t, name := range defineTypeNames {
+		if name == v.Type {
+			*d = Define{Name: v.Name, Value: v.Value, Type: t}
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown type of variable definition %q", v.Type)
+}
+
+// MarshalJSON encodes the key as a JSON object.
+func (k Key) MarshalJSON() ([]byte, error) { return json.Marshal(keyJSON(k)) }
+
+// UnmarshalJSON decodes the key from JSON object.
+func (k *Key) UnmarshalJSON(data []byte) error { return json.Unmarshal(data, (*keyJSON)(k)) }
+
+// MarshalJSON encodes the map as a JSON object.
+func (m Map) MarshalJSON() ([]byte, error) { return json.Marshal(mapJSON(m)) }
+
+// UnmarshalJSON decodes the map from JSON object.
+func (m *Map) UnmarshalJSON(data []byte) error { return json.Unmarshal(data, (*mapJSON)(m)) }
+
+// MarshalJSON encodes the partial segment as a JSON object.
+func (p PartialSegment) MarshalJSON() ([]byte, error) { return json.Marshal(partialSegmentJSON(p)) }
+
+// UnmarshalJSON decodes the partial segment from JSON object.
+func (p *PartialSegment) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, (*partialSegmentJSON)(p))
+}
+
+// MarshalJSON encodes the server control as a JSON object.
+func (s ServerControl) MarshalJSON() ([]byte, error) { return json.Marshal(serverControlJSON(s)) }
+
+// UnmarshalJSON decodes the server control from JSON object.
+func (s *ServerControl) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, (*serverControlJSON)(s))
+}
+
+// MarshalJSON encodes the preload hint as a JSON object.
+func (h PreloadHint) MarshalJSON() ([]byte, error) { return json.Marshal(preloadHintJSON(h)) }
+
+// UnmarshalJSON decodes the preload hint from JSON object.
+func (h *PreloadHint) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, (*preloadHintJSON)(h))
+}
+
+// MarshalJSON encodes the rendition report as a JSON object.
+func (r RenditionReport) MarshalJSON() ([]byte, error) { return json.Marshal(renditionReportJSON(r)) }
+
+// UnmarshalJSON decodes the rendition report from JSON object.
+func (r *RenditionReport) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, (*renditionReportJSON)(r))
+}
+
+// MarshalJSON encodes the skip tag as a JSON object.
+func (s Skip) MarshalJSON() ([]byte, error) { return json.Marshal(skipJSON(s)) }
+
+// UnmarshalJSON decodes the skip tag from JSON object.
+func (s *Skip) UnmarshalJSON(data []byte) error { return json.Unmarshal(data, (*skipJSON)(s)) }
+
+// MarshalJSON encodes the session data as a JSON object.
+func (sd SessionData) MarshalJSON() ([]byte, error) { return json.Marshal(sessionDataJSON(sd)) }
+
+// UnmarshalJSON decodes the session data from JSON object.
+func (sd *SessionData) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, (*sessionDataJSON)(sd))
+}
+
+// MarshalJSON encodes the content steering tag as a JSON object.
+func (cs ContentSteering) MarshalJSON() ([]byte, error) {
+	return json.Marshal(contentSteeringJSON(cs))
+}
+
+// UnmarshalJSON decodes the content steering tag from JSON object.
+func (cs *ContentSteering) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, (*contentSteeringJSON)(cs))
+}
+
+// textOptions returns options of the strict decoder keeping custom
+// decoders and unknown tags policy of the playlist.
+func (p *MasterPlaylist) textOptions() *decodeOptions {
+	return textOptions(p.customDecoders, p.preserveUnknown)
+}
+
+func (p *MediaPlaylist) textOptions() *decodeOptions {
+	return textOptions(p.customDecoders, p.preserveUnknown)
+}
+
+func textOptions(customDecoders []CustomDecoder, preserveUnknown bool) *decodeOptions {
+	opts := strictOptions(true)
+	opts.customDecoders = customDecoders
+	if preserveUnknown {
+		opts.unknownTags = KeepUnknownTags
+	}
+	return opts
+}
+
+// encodeCustomTags returns the lines of custom tags written by Encode.
+func encodeCustomTags(tags []CustomTag) []string {
+	var lines []string
+	for _, tag := range tags {
+		if buf := tag.Encode(); buf != nil {
+			lines = append(lines, buf.String())
+		}
+	}
+	return lines
+}
+
+// decodeCustomTags decodes the lines of custom tags by the first
+// decoder matching the tag name and stores the tags in the map.
+func decodeCustomTags(lines []string, decoders []CustomDecoder, custom map[string]CustomTag, order *customOrder) error {
+	for _, line := range lines {
+		var decoder CustomDecoder
+		for _, d := range decoders {
+			if strings.HasPrefix(line, d.TagName()) {
+				decoder = d
+				break
+			}
+		}
+		if decoder == nil {
+			return fmt.Errorf("no custom decoder for tag %q", line)
+		}
+		t, err := decoder.Decode(line)
+		if err != nil {
+			return err
+		}
+		order.set(custom, t.TagName(), t)
+	}
+	return nil
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func parseMediaType(name string) (MediaType, error) {
+	for t, n := range mediaTypeNames {
+		if n == name {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown playlist type %q", name)
+}
+
+func scteSyntaxByName(name string) (SCTE35Syntax, bool) {
+	for syntax, n := range scteSyntaxNames {
+		if n == name {
+			return syntax, true
+		}
+	}
+	return 0, false
+}
+
+func scteCueByName(name string) (SCTE35CueType, bool) {
+	for cue, n := range scteCueNames {
+		if n == name {
+			return cue, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,270 @@
+package m3u8
+
+/*
+ JSON and text marshalling tests.
+
+ Copyright 2013-2019 The Project Developers.
+ See the AUTHORS and LICENSE files at the top-level directory of this distribution
+ and at https://github.com/grafov/m3u8/
+
+ ॐ तारे तुत्तारे तुरे स्व
+*/
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+var (
+	_ json.Marshaler           = (*MediaPlaylist)(nil)
+	_ json.Unmarshaler         = (*MediaPlaylist)(nil)
+	_ encoding.TextMarshaler   = (*MasterPlaylist)(nil)
+	_ encoding.TextUnmarshaler = (*MasterPlaylist)(nil)
+)
+
+func TestMasterPlaylistJSONRoundTrip(t *testing.T) {
+	for _, name := range []string{
+		"master.m3u8",
+		"master-with-alternatives.m3u8",
+		"master-with-closed-captions-eq-none.m3u8",
+		"master-with-content-steering.m3u8",
+		"master-with-independent-segments.m3u8",
+		"master-with-media-attributes.m3u8",
+		"master-with-session-data.m3u8",
+		"master-with-stream-inf-v12.m3u8",
+	} {
+		data, err := ioutil.ReadFile("sample-playlists/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := NewMasterPlaylist()
+		if err = p.UnmarshalText(data); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		out, err := json.Marshal(p)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		decoded := NewMasterPlaylist()
+		if err = json.Unmarshal(out, decoded); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if decoded.String() != p.String() {
+			t.Errorf("%s: playlist differs after JSON round trip:\n%s", name, decoded)
+		}
+	}
+}
+
+func TestMediaPlaylistJSONRoundTrip(t *testing.T) {
+	for _, name := range []string{
+		"media-playlist-delta-update.m3u8",
+		"media-playlist-low-latency.m3u8",
+		"media-playlist-with-byterange.m3u8",
+		"media-playlist-with-daterange.m3u8",
+		"media-playlist-with-discontinuity-seq.m3u8",
+		"media-playlist-with-gap-and-bitrate.m3u8",
+		"media-playlist-with-oatcls-scte35.m3u8",
+		"media-playlist-with-program-date-time.m3u8",
+		"media-playlist-with-scte35.m3u8",
+		"media-playlist-with-start-time.m3u8",
+		"wowza-vod-chunklist.m3u8",
+	} {
+		data, err := ioutil.ReadFile("sample-playlists/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := new(MediaPlaylist)
+		if err = p.UnmarshalText(data); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		out, err := json.Marshal(p)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		decoded := new(MediaPlaylist)
+		if err = json.Unmarshal(out, decoded); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if decoded.String() != p.String() {
+			t.Errorf("%s: playlist differs after JSON round trip:\n%s", name, decoded)
+		}
+	}
+}
+
+func TestMediaPlaylistJSONSlidingWindow(t *testing.T) {
+	p, _ := NewMediaPlaylist(3, 4)
+	for i := 0; i < 6; i++ {
+		if err := p.Append(fmt.Sprintf("test%d.ts", i), 10, ""); err != nil {
+			p.Remove()
+			p.Append(fmt.Sprintf("test%d.ts", i), 10, "")
+		}
+	}
+	out, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v struct {
+		Segments []struct {
+			URI string `json:"uri"`
+		} `json:"segments"`
+	}
+	if err = json.Unmarshal(out, &v); err != nil {
+		t.Fatal(err)
+	}
+	var uris []string
+	for _, seg := range v.Segments {
+		uris = append(uris, seg.URI)
+	}
+	if strings.Join(uris, " ") != "test2.ts test3.ts test4.ts test5.ts" {
+		t.Errorf("Unexpected order of segments: %v", uris)
+	}
+
+	decoded := new(MediaPlaylist)
+	if err = json.Unmarshal(out, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.String() != p.String() {
+		t.Errorf("Playlist differs after JSON round trip:\n%s", decoded)
+	}
+	// the decoded playlist keeps sliding
+	decoded.Slide("test6.ts", 10, "")
+	p.Slide("test6.ts", 10, "")
+	if decoded.String() != p.String() {
+		t.Errorf("Playlist differs after sliding:\n%s", decoded)
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	for _, tc := range []struct {
+		value    interface{}
+		expected string
+	}{
+		{Key{Method: "AES-128", URI: "key.bin", IV: "0x1"}, `{"method":"AES-128","uri":"key.bin","iv":"0x1"}`},
+		{Map{URI: "init.mp4", Limit: 720, Offset: 0}, `{"uri":"init.mp4","byterange_length":720}`},
+		{SCTE{Syntax: SCTE35_OATCLS, CueType: SCTE35Cue_Mid, Time: 15, Elapsed: 5}, `{"syntax":"OATCLS","cue_type":"mid","time":15,"elapsed":5}`},
+		{Define{Name: "host", Type: DefineImport}, `{"name":"host","type":"IMPORT"}`},
+		{MediaSegment{SeqId: 1, URI: "seg.ts", Duration: 10, Key: &Key{Method: "NONE"}}, `{"sequence":1,"uri":"seg.ts","duration":10,"key":{"method":"NONE"}}`},
+	} {
+		out, err := json.Marshal(tc.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != tc.expected {
+			t.Errorf("Expected %s, got %s", tc.expected, out)
+		}
+	}
+}
+
+func TestJSONUnknownValues(t *testing.T) {
+	var scte SCTE
+	if err := json.Unmarshal([]byte(`{"syntax":"OATCLS","cue_type":"pause"}`), &scte); err == nil {
+		t.Error("Expected error on unknown cue type")
+	}
+	p := new(MediaPlaylist)
+	if err := json.Unmarshal([]byte(`{"playlist_type":"LIVE","segments":[]}`), p); err == nil {
+		t.Error("Expected error on unknown playlist type")
+	}
+	if err := json.Unmarshal([]byte(`{"capacity":4000000000,"window_size":3,"segments":[]}`), p); err == nil {
+		t.Error("Expected error on capacity over the limit")
+	}
+	if err := json.Unmarshal([]byte(`{"capacity":1,"window_size":0,"segments":[{"uri":"a.ts","duration":4},{"uri":"b.ts","duration":4}]}`), p); err != nil || p.Count() != 2 {
+		t.Errorf("Expected capacity extended to the segments, got %d segments: %v", p.Count(), err)
+	}
+}
+
+func TestJSONCustomTags(t *testing.T) {
+	playlist := `#EXTM3U
+#EXT-X-VERSION:3
+#Z-PLAYLIST:1
+#A-PLAYLIST:2
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-TARGETDURATION:10
+#Z-SEGMENT:1
+#A-SEGMENT:2
+#EXTINF:10.000,
+seg0.ts
+#EXT-X-ENDLIST
+`
+	decoders := []CustomDecoder{
+		&lineCustomTag{name: "#A-PLAYLIST:"},
+		&lineCustomTag{name: "#Z-PLAYLIST:"},
+		&lineCustomTag{name: "#A-SEGMENT:", segment: true},
+		&lineCustomTag{name: "#Z-SEGMENT:", segment: true},
+	}
+	p, _ := NewMediaPlaylist(1, 1)
+	p.WithCustomDecoders(decoders)
+	if err := p.DecodeFrom(strings.NewReader(playlist), true); err != nil {
+		t.Fatal(err)
+	}
+	out, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `"custom_tags":["#Z-PLAYLIST:1","#A-PLAYLIST:2"]`) ||
+		!strings.Contains(string(out), `"custom_tags":["#Z-SEGMENT:1","#A-SEGMENT:2"]`) {
+		t.Errorf("Expected custom tags in JSON: %s", out)
+	}
+	decoded := new(MediaPlaylist)
+	decoded.WithCustomDecoders(decoders)
+	if err = json.Unmarshal(out, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.String() != playlist {
+		t.Errorf("Playlist differs after JSON round trip:\n%s", decoded)
+	}
+	if err = json.Unmarshal(out, new(MediaPlaylist)); err == nil {
+		t.Error("Expected error on custom tags without decoders")
+	}
+	var seg MediaSegment
+	if err = json.Unmarshal([]byte(`{"uri":"seg0.ts","duration":10,"custom_tags":["#A-SEGMENT:2"]}`), &seg); err == nil {
+		t.Error("Expected error on custom tags of the segment without the playlist")
+	}
+
+	m := NewMasterPlaylist()
+	m.WithCustomDecoders(decoders)
+	m.SetCustomTag(&lineCustomTag{name: "#A-PLAYLIST:", line: "#A-PLAYLIST:1"})
+	m.Append("low.m3u8", nil, VariantParams{Bandwidth: 1280000})
+	if out, err = json.Marshal(m); err != nil {
+		t.Fatal(err)
+	}
+	decodedMaster := new(MasterPlaylist)
+	decodedMaster.WithCustomDecoders(decoders)
+	if err = json.Unmarshal(out, decodedMaster); err != nil {
+		t.Fatal(err)
+	}
+	if decodedMaster.String() != m.String() {
+		t.Errorf("Master playlist differs after JSON round trip:\n%s", decodedMaster)
+	}
+}
+
+func TestMediaPlaylistTextRoundTrip(t *testing.T) {
+	data, err := ioutil.ReadFile("sample-playlists/media-playlist-large.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := new(MediaPlaylist)
+	if err = p.UnmarshalText(data); err != nil {
+		t.Fatal(err)
+	}
+	if p.Count() < 1000 {
+		t.Errorf("Expected all segments, got %d", p.Count())
+	}
+	text, err := p.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := new(MediaPlaylist)
+	if err = decoded.UnmarshalText(text); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.String() != string(text) {
+		t.Error("Playlist differs after text round trip")
+	}
+	if err = decoded.UnmarshalText([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:x\n")); err == nil {
+		t.Error("Expected error on invalid playlist")
+	}
+}
@@ -0,0 +1,151 @@
+package m3u8
+
+/*
+ Part of M3U8 parser & generator library.
+ This file defines live media playlist safe for concurrent use.
+
+ Copyright 2013-2019 The Project Developers.
+ See the AUTHORS and LICENSE files at the top-level directory of this distribution
+ and at https://github.com/grafov/m3u8/
+
+ ॐ तारे तुत्तारे तुरे स्व
+*/
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// LivePlaylist wraps the media playlist of a live stream which is
+// updated and encoded from different goroutines, for example segments
+// are appended by a packager while HTTP handlers serve the playlist.
+// All methods are safe for concurrent use. Readers get immutable
+// snapshots of the playlist so they never block each other and the
+// playlist is encoded once per change.
+type LivePlaylist struct {
+	mu   sync.RWMutex
+	p    *MediaPlaylist
+	snap *LiveSnapshot // nil after the change of the playlist
+}
+
+// LiveSnapshot is the state of the live playlist at some moment. It is
+// never changed so it may be shared by any number of goroutines.
+type LiveSnapshot struct {
+	data  []byte
+	seqNo uint64
+	count uint
+}
+
+// NewLivePlaylist creates a new live playlist with the sliding window
+// of `winsize` segments and the buffer of `capacity` segments.
+func NewLivePlaylist(winsize, capacity uint) (*LivePlaylist, error) {
+	p, err := NewMediaPlaylist(winsize, capacity)
+	if err != nil {
+		return nil, err
+	}
+	return &LivePlaylist{p: p}, nil
+}
+
+// Slide appends the segment and removes the oldest one if the window
+// is full, see MediaPlaylist.Slide.
+func (l *LivePlaylist) Slide(uri string, duration float64, title string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.p.Slide(uri, duration, title)
+	l.snap = nil
+}
+
+// AppendSegment appends the segment to the playlist, see
+// MediaPlaylist.AppendSegment. Snapshots hold the encoded playlist
+// but the wrapped playlist keeps the pointer to the segment and the
+// next Snapshot encodes it again, so the segment must not be changed
+// after appending.
+func (l *LivePlaylist) AppendSegment(seg *MediaSegment) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.p.AppendSegment(seg); err != nil {
+		return err
+	}
+	l.snap = nil
+	return nil
+}
+
+// Update calls the function with the wrapped playlist for changes not
+// covered by other methods, such as setting keys, partial segments or
+// closing the playlist. The playlist must not be used after the
+// function returns.
+func (l *LivePlaylist) Update(update func(p *MediaPlaylist)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	update(l.p)
+	l.p.ResetCache()
+	l.snap = nil
+}
+
+// Snapshot returns the current state of the playlist. The snapshot is
+// created once after each change and shared by all callers.
+func (l *LivePlaylist) Snapshot() *LiveSnapshot {
+	l.mu.RLock()
+	snap := l.snap
+	l.mu.RUnlock()
+	if snap != nil {
+		return snap
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.snap == nil {
+		l.snap = &LiveSnapshot{
+			data:  append([]byte(nil), l.p.Encode().Bytes()...),
+			seqNo: l.p.SeqNo,
+			count: l.p.Count(),
+		}
+	}
+	return l.snap
+}
+
+// Encode returns the current playlist in M3U8 format. The buffer is
+// owned by the caller.
+func (l *LivePlaylist) Encode() *bytes.Buffer {
+	return bytes.NewBuffer(l.Snapshot().Bytes())
+}
+
+// WriteTo writes the current playlist in M3U8 format to the writer.
+// It implements io.WriterTo.
+func (l *LivePlaylist) WriteTo(w io.Writer) (int64, error) {
+	return l.Snapshot().WriteTo(w)
+}
+
+// String returns the current playlist in M3U8 format.
+func (l *LivePlaylist) String() string {
+	return l.Snapshot().String()
+}
+
+// Bytes returns a copy of the playlist in M3U8 format.
+func (s *LiveSnapshot) Bytes() []byte {
+	return append([]byte(nil), s.data...)
+}
+
+// WriteTo writes the playlist in M3U8 format to the writer without
+// copying. It implements io.WriterTo.
+func (s *LiveSnapshot) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(s.data)
+	return int64(n), err
+}
+
+// String returns the playlist in M3U8 format.
+func (s *LiveSnapshot) String() string {
+	return string(s.data)
+}
+
+// SeqNo returns the media sequence number of the playlist
+// (EXT-X-MEDIA-SEQUENCE).
+func (s *LiveSnapshot) SeqNo() uint64 {
+	return s.seqNo
+}
+
+// Count returns the number of segments in the playlist.
+func (s *LiveSnapshot) Count() uint {
+	return s.count
+}
@@ -0,0 +1,148 @@
+package m3u8
+
+/*
+ Live playlist tests. Run them with -race flag.
+
+ Copyright 2013-2019 The Project Developers.
+ See the AUTHORS and LICENSE files at the top-level directory of this distribution
+ and at https://github.com/grafov/m3u8/
+
+ ॐ तारे तुत्तारे तुरे स्व
+*/
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestNewLivePlaylist(t *testing.T) {
+	if _, err := NewLivePlaylist(5, 3); err == nil {
+		t.Error("Expected error on window size greater than capacity")
+	}
+	l, err := NewLivePlaylist(3, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap := l.Snapshot(); snap.Count() != 0 || !strings.HasPrefix(snap.String(), "#EXTM3U\n") {
+		t.Errorf("Unexpected snapshot of the empty playlist:\n%s", snap)
+	}
+}
+
+func TestLivePlaylistSnapshot(t *testing.T) {
+	l, _ := NewLivePlaylist(3, 3)
+	for i := 0; i < 5; i++ {
+		l.Slide(fmt.Sprintf("test%d.ts", i), 10, "")
+	}
+	snap := l.Snapshot()
+	if snap != l.Snapshot() {
+		t.Error("Expected the same snapshot without changes")
+	}
+	if snap.SeqNo() != 2 || snap.Count() != 3 {
+		t.Errorf("Unexpected sequence number %d or count %d", snap.SeqNo(), snap.Count())
+	}
+	expected := snap.String()
+
+	// snapshots are not affected by later changes and by their users
+	if err := l.AppendSegment(&MediaSegment{URI: "test5.ts", Duration: 10}); err != ErrPlaylistFull {
+		t.Errorf("Expected full playlist, got %v", err)
+	}
+	l.Slide("test5.ts", 10, "")
+	out := snap.Bytes()
+	copy(out, "#EXTM4U")
+	l.Encode().Reset()
+	if snap.String() != expected || strings.Contains(expected, "test5.ts") {
+		t.Errorf("Snapshot changed:\n%s", snap)
+	}
+	if l.Snapshot() == snap || !strings.Contains(l.String(), "test5.ts") {
+		t.Errorf("Expected new snapshot after the change:\n%s", l)
+	}
+
+	var buf bytes.Buffer
+	if _, err := l.WriteTo(&buf); err != nil || buf.String() != l.Encode().String() {
+		t.Errorf("Unexpected output of WriteTo: %v\n%s", err, buf.String())
+	}
+
+	l.Update(func(p *MediaPlaylist) {
+		p.SetDefaultKey("AES-128", "https://example.com/key", "", "", "")
+		p.Close()
+	})
+	if out := l.String(); !strings.Contains(out, "#EXT-X-KEY:METHOD=AES-128") || !strings.HasSuffix(out, "#EXT-X-ENDLIST\n") {
+		t.Errorf("Expected the key and the end of the playlist:\n%s", out)
+	}
+}
+
+func TestLivePlaylistConcurrentUse(t *testing.T) {
+	const segments = 500
+	l, _ := NewLivePlaylist(5, 10)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < segments; i++ {
+			if i%2 == 0 {
+				l.Slide(fmt.Sprintf("test%d.ts", i), 6, "")
+				continue
+			}
+			l.Update(func(p *MediaPlaylist) {
+				if p.Count() >= 5 {
+					p.Remove()
+				}
+			})
+			if err := l.AppendSegment(&MediaSegment{URI: fmt.Sprintf("test%d.ts", i), Duration: 6}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var last uint64
+			for i := 0; i < segments; i++ {
+				snap := l.Snapshot()
+				if snap.SeqNo() < last {
+					t.Errorf("Media sequence number decreased from %d to %d", last, snap.SeqNo())
+					return
+				}
+				last = snap.SeqNo()
+				if snap.Count() > 5 || !strings.Contains(snap.String(), fmt.Sprintf("#EXT-X-MEDIA-SEQUENCE:%d\n", last)) {
+					t.Errorf("Inconsistent snapshot:\n%s", snap)
+					return
+				}
+				if _, err := l.WriteTo(ioutil.Discard); err != nil {
+					t.Error(err)
+					return
+				}
+				l.Encode()
+			}
+		}()
+	}
+	wg.Wait()
+
+	snap := l.Snapshot()
+	if snap.SeqNo() != segments-5 || snap.Count() != 5 {
+		t.Errorf("Unexpected sequence number %d or count %d", snap.SeqNo(), snap.Count())
+	}
+	if !strings.Contains(snap.String(), fmt.Sprintf("test%d.ts\n", segments-1)) {
+		t.Errorf("Expected the last segment:\n%s", snap)
+	}
+}
+
+func BenchmarkLivePlaylistSnapshot(b *testing.B) {
+	l, _ := NewLivePlaylist(10, 10)
+	for i := 0; i < 10; i++ {
+		l.Slide(fmt.Sprintf("test%d.ts", i), 6, "")
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			l.Snapshot().WriteTo(ioutil.Discard)
+		}
+	})
+}
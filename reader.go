@@ -16,13 +16,23 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/grafov/m3u8/scte35"
+)
+
+var reKeyValue = regexp.MustCompile(`([a-zA-Z0-9_-]+)=("[^"]*"|[^",]+)`)
+
+var (
+	reVariableRef  = regexp.MustCompile(`\{\$([a-zA-Z0-9_-]+)\}`)
+	reVariableName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
 )
 
-var reKeyValue = regexp.MustCompile(`([a-zA-Z0-9_-]+)=("[^"]+"|[^",]+)`)
+var reInstreamId = regexp.MustCompile(`^(CC[1-4]|SERVICE([1-9]|[1-5][0-9]|6[0-3]))$`)
 
 // TimeParse allows globally apply and/or override Time Parser function.
 // Available variants:
@@ -30,22 +40,180 @@ var reKeyValue = regexp.MustCompile(`([a-zA-Z0-9_-]+)=("[^"]+"|[^",]+)`)
 //   - StrictTimeParse - implements only RFC3339 Nanoseconds format
 var TimeParse func(value string) (time.Time, error) = FullTimeParse
 
+// DecodeError is returned by decoders when a line of the playlist
+// can't be parsed. Line is the line number starting from 1, Raw is
+// the line without the line ending, Tag is the name of the tag
+// (empty for URI lines) and Err is the cause of the error.
+type DecodeError struct {
+	Line int
+	Raw  string
+	Tag  string
+	Err  error
+}
+
+// Error returns description of the error prefixed with the position
+// in the playlist, for example "line 412: #EXT-X-BYTERANGE: invalid
+// offset".
+func (e *DecodeError) Error() string {
+	if e.Tag == "" {
+		return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("line %d: %s: %v", e.Line, e.Tag, e.Err)
+}
+
+// Unwrap returns the cause of the error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Errors of problems recovered by DecodeLenient. They are wrapped by
+// DecodeError with position of the problem.
+var (
+	ErrUnknownTag   = errors.New("unknown tag")
+	ErrOrphanURI    = errors.New("URI is not described by any tag")
+	ErrDuplicateTag = errors.New("duplicate tag")
+)
+
+// uniqueTags must not appear more than once in a playlist.
+var uniqueTags = map[string]bool{
+	"#EXTM3U":                       true,
+	"#EXT-X-VERSION":                true,
+	"#EXT-X-INDEPENDENT-SEGMENTS":   true,
+	"#EXT-X-START":                  true,
+	"#EXT-X-CONTENT-STEERING":       true,
+	"#EXT-X-TARGETDURATION":         true,
+	"#EXT-X-MEDIA-SEQUENCE":         true,
+	"#EXT-X-DISCONTINUITY-SEQUENCE": true,
+	"#EXT-X-PLAYLIST-TYPE":          true,
+	"#EXT-X-I-FRAMES-ONLY":          true,
+	"#EXT-X-ENDLIST":                true,
+	"#EXT-X-SERVER-CONTROL":         true,
+	"#EXT-X-PART-INF":               true,
+	"#EXT-X-SKIP":                   true,
+}
+
+// newDecodeError wraps the error of decoding the line.
+func newDecodeError(lineno int, line string, err error) *DecodeError {
+	raw := strings.TrimRight(line, "\r\n")
+	return &DecodeError{Line: lineno, Raw: raw, Tag: tagName(raw), Err: err}
+}
+
+// tagName returns name of the tag of the line or empty string for
+// URI lines.
+func tagName(line string) string {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "#") {
+		return ""
+	}
+	if i := strings.IndexByte(line, ':'); i >= 0 {
+		return line[:i]
+	}
+	return line
+}
+
+// newDecodingState creates the state of decoding with the options.
+func newDecodingState(opts *decodeOptions) *decodingState {
+	return &decodingState{
+		custom:    make(map[string]CustomTag),
+		timeParse: opts.timeParse,
+	}
+}
+
+// parseTime parses dates with the parser set by the options or with
+// global TimeParse.
+func (s *decodingState) parseTime(value string) (time.Time, error) {
+	if s.timeParse != nil {
+		return s.timeParse(value)
+	}
+	return TimeParse(value)
+}
+
+// check reports whether decoding of the line must be stopped by the
+// error. Errors ignored in non-strict mode are kept in the state.
+func (s *decodingState) check(err error, strict bool) bool {
+	if err == nil || strict {
+		return err != nil
+	}
+	s.errs = append(s.errs, err)
+	return false
+}
+
+// recovered returns errors of the line ignored in non-strict mode
+// and resets them. The error returned by the line decoder `err` is
+// added unless it is recorded already so no error is skipped.
+func (s *decodingState) recovered(lineno int, line string, err error) []*DecodeError {
+	var problems []*DecodeError
+	if err != nil {
+		recorded := false
+		for _, e := range s.errs {
+			if e == err {
+				recorded = true
+				break
+			}
+		}
+		if !recorded {
+			s.errs = append(s.errs, err)
+		}
+	}
+	for _, err := range s.errs {
+		problems = append(problems, newDecodeError(lineno, line, err))
+	}
+	s.errs = nil
+	return problems
+}
+
+// problems checks the line for unknown tags, orphan URIs and
+// duplicates of unique tags. The line is unknown tag or orphan URI
+// when all decoders applied to the line agree about it.
+func (s *decodingState) problems(lineno int, line string, unknown, orphan bool) []*DecodeError {
+	var problems []*DecodeError
+	if unknown {
+		problems = append(problems, newDecodeError(lineno, line, ErrUnknownTag))
+	}
+	if orphan {
+		problems = append(problems, newDecodeError(lineno, line, ErrOrphanURI))
+	}
+	if tag := tagName(line); uniqueTags[tag] {
+		if s.seenTags == nil {
+			s.seenTags = make(map[string]bool)
+		}
+		if s.seenTags[tag] {
+			problems = append(problems, newDecodeError(lineno, line, ErrDuplicateTag))
+		}
+		s.seenTags[tag] = true
+	}
+	return problems
+}
+
 // Decode parses a master playlist passed from the buffer. If `strict`
 // parameter is true then it returns first syntax error.
 func (p *MasterPlaylist) Decode(data bytes.Buffer, strict bool) error {
-	return p.decode(&data, strict)
+	_, err := p.decode(readLines(&data), strictOptions(strict))
+	return err
 }
 
 // DecodeFrom parses a master playlist passed from the io.Reader
 // stream.  If `strict` parameter is true then it returns first syntax
 // error.
 func (p *MasterPlaylist) DecodeFrom(reader io.Reader, strict bool) error {
-	buf := new(bytes.Buffer)
-	_, err := buf.ReadFrom(reader)
+	data, err := readAll(reader)
 	if err != nil {
 		return err
 	}
-	return p.decode(buf, strict)
+	_, err = p.decode(data, strictOptions(strict))
+	return err
+}
+
+// DecodeLenient parses a master playlist passed from the io.Reader
+// stream in non-strict mode. It returns problems recovered during
+// decoding: unknown tags, malformed attributes, URIs without
+// EXT-X-STREAM-INF and duplicate tags.
+func (p *MasterPlaylist) DecodeLenient(reader io.Reader) ([]*DecodeError, error) {
+	data, err := readAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	return p.decode(data, strictOptions(false))
 }
 
 // WithCustomDecoders adds custom tag decoders to the master playlist for decoding
@@ -60,31 +228,45 @@ func (p *MasterPlaylist) WithCustomDecoders(customDecoders []CustomDecoder) Play
 	return p
 }
 
-// Parse master playlist. Internal function.
-func (p *MasterPlaylist) decode(buf *bytes.Buffer, strict bool) error {
+// Parse master playlist. Internal function. Problems recovered in
+// non-strict mode are returned with the error.
+func (p *MasterPlaylist) decode(data string, opts *decodeOptions) ([]*DecodeError, error) {
 	var eof bool
+	var line string
+	var lineno int
+	var problems []*DecodeError
 
-	state := new(decodingState)
+	strict := opts.strictness >= Strict
+	state := newDecodingState(opts)
+	p.configure(opts)
 
 	for !eof {
-		line, err := buf.ReadString('\n')
-		if err == io.EOF {
-			eof = true
-		} else if err != nil {
-			break
-		}
-		err = decodeLineOfMasterPlaylist(p, state, line, strict)
+		line, data, eof = nextLine(data)
+		lineno++
+		err := decodeLineOfMasterPlaylist(p, state, line, strict)
 		if strict && err != nil {
-			return err
+			return nil, newDecodeError(lineno, line, err)
+		}
+		problems = append(problems, state.recovered(lineno, line, err)...)
+		lineProblems := state.problems(lineno, line, state.unknownTag, state.orphanURI)
+		if opts.strictness == Pedantic && len(lineProblems) > 0 {
+			return nil, lineProblems[0]
 		}
+		problems = append(problems, lineProblems...)
 	}
 
 	p.attachRenditionsToVariants(state.alternatives)
+	if len(state.unknownVariant) > 0 {
+		p.TrailingTags = state.unknownVariant
+	}
 
 	if strict && !state.m3u {
-		return errors.New("#EXTM3U absent")
+		return nil, errors.New("#EXTM3U absent")
 	}
-	return nil
+	if opts.baseURL != nil {
+		p.ResolveURIs(opts.baseURL)
+	}
+	return problems, nil
 }
 
 func (p *MasterPlaylist) attachRenditionsToVariants(alternatives []*Alternative) {
@@ -112,19 +294,32 @@ func (p *MasterPlaylist) attachRenditionsToVariants(alternatives []*Alternative)
 // Decode parses a media playlist passed from the buffer. If `strict`
 // parameter is true then return first syntax error.
 func (p *MediaPlaylist) Decode(data bytes.Buffer, strict bool) error {
-	return p.decode(&data, strict)
+	_, err := p.decode(readLines(&data), strictOptions(strict))
+	return err
 }
 
 // DecodeFrom parses a media playlist passed from the io.Reader
 // stream. If `strict` parameter is true then it returns first syntax
 // error.
 func (p *MediaPlaylist) DecodeFrom(reader io.Reader, strict bool) error {
-	buf := new(bytes.Buffer)
-	_, err := buf.ReadFrom(reader)
+	data, err := readAll(reader)
 	if err != nil {
 		return err
 	}
-	return p.decode(buf, strict)
+	_, err = p.decode(data, strictOptions(strict))
+	return err
+}
+
+// DecodeLenient parses a media playlist passed from the io.Reader
+// stream in non-strict mode. It returns problems recovered during
+// decoding: unknown tags, malformed attributes, URIs without EXTINF
+// and duplicate tags.
+func (p *MediaPlaylist) DecodeLenient(reader io.Reader) ([]*DecodeError, error) {
+	data, err := readAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	return p.decode(data, strictOptions(false))
 }
 
 // WithCustomDecoders adds custom tag decoders to the media playlist for decoding
@@ -139,142 +334,396 @@ func (p *MediaPlaylist) WithCustomDecoders(customDecoders []CustomDecoder) Playl
 	return p
 }
 
-func (p *MediaPlaylist) decode(buf *bytes.Buffer, strict bool) error {
+func (p *MediaPlaylist) decode(data string, opts *decodeOptions) ([]*DecodeError, error) {
 	var eof bool
 	var line string
-	var err error
+	var lineno int
+	var problems []*DecodeError
 
-	state := new(decodingState)
+	strict := opts.strictness >= Strict
+	state := newDecodingState(opts)
 	wv := new(WV)
+	p.configure(opts)
 
 	for !eof {
-		if line, err = buf.ReadString('\n'); err == io.EOF {
-			eof = true
-		} else if err != nil {
-			break
-		}
+		line, data, eof = nextLine(data)
+		lineno++
 
-		err = decodeLineOfMediaPlaylist(p, wv, state, line, strict)
-		if strict && err != nil {
-			return err
+		lineProblems, err := decodeMediaLine(p, wv, state, opts, lineno, line)
+		if err != nil {
+			return nil, err
 		}
-
+		if opts.maxSegments > 0 && p.Count() > uint(opts.maxSegments) {
+			return nil, newDecodeError(lineno, line, ErrTooManySegments)
+		}
+		problems = append(problems, lineProblems...)
 	}
 	if state.tagWV {
 		p.WV = wv
 	}
+	if len(state.unknownSegment) > 0 {
+		p.TrailingTags = state.unknownSegment
+	}
 	if strict && !state.m3u {
-		return errors.New("#EXTM3U absent")
+		return nil, errors.New("#EXTM3U absent")
+	}
+	if opts.baseURL != nil {
+		p.ResolveURIs(opts.baseURL)
+	}
+	return problems, nil
+}
+
+// readLines takes the content of the buffer for decoding by lines. The
+// buffer is converted to the string once so the lines and values
+// decoded from them are substrings and don't need own allocations.
+func readLines(buf *bytes.Buffer) string {
+	data := buf.String()
+	buf.Reset()
+	return data
+}
+
+// readAll reads the input for decoding by lines like readLines does.
+// Input of readers reporting their length (bytes.Reader,
+// strings.Reader and others) is copied once to the string of that
+// length, other readers are read through the buffer.
+func readAll(reader io.Reader) (string, error) {
+	if r, ok := reader.(interface{ Len() int }); ok {
+		var b strings.Builder
+		b.Grow(r.Len())
+		_, err := io.Copy(&b, reader)
+		return b.String(), err
+	}
+	buf := new(bytes.Buffer)
+	if _, err := buf.ReadFrom(reader); err != nil {
+		return "", err
 	}
+	return readLines(buf), nil
+}
+
+// nextLine cuts the first line with its line feed from the data. The
+// last line of the data is returned with `eof` set.
+func nextLine(data string) (line, rest string, eof bool) {
+	if i := strings.IndexByte(data, '\n'); i >= 0 {
+		return data[:i+1], data[i+1:], false
+	}
+	return data, "", true
+}
+
+// decodeMediaLine decodes the line of media playlist with the options
+// and returns problems recovered in non-strict mode.
+func decodeMediaLine(p *MediaPlaylist, wv *WV, state *decodingState, opts *decodeOptions, lineno int, line string) ([]*DecodeError, error) {
+	strict := opts.strictness >= Strict
+	err := decodeLineOfMediaPlaylist(p, wv, state, line, strict)
+	if strict && err != nil {
+		return nil, newDecodeError(lineno, line, err)
+	}
+	problems := state.recovered(lineno, line, err)
+	lineProblems := state.problems(lineno, line, state.unknownTag, state.orphanURI)
+	if opts.strictness == Pedantic && len(lineProblems) > 0 {
+		return nil, lineProblems[0]
+	}
+	return append(problems, lineProblems...), nil
+}
+
+// ApplyDelta merges the playlist delta update (the playlist with
+// EXT-X-SKIP tag) into the playlist decoded earlier. Skipped segments
+// are taken from the playlist, the header and the rest of segments
+// are taken from the delta update.
+func (p *MediaPlaylist) ApplyDelta(delta *MediaPlaylist) error {
+	if delta.Skip == nil {
+		return errors.New("playlist is not a delta update")
+	}
+	// Date ranges of the delta update replace date ranges with the
+	// same ID, recently removed date ranges are dropped.
+	removed := make(map[string]bool)
+	for _, id := range delta.Skip.RecentlyRemovedDateRanges {
+		removed[id] = true
+	}
+	for _, dr := range delta.DateRanges {
+		removed[dr.ID] = true
+	}
+	for _, dr := range delta.PendingDateRanges {
+		removed[dr.ID] = true
+	}
+	for i, n := delta.head, uint(0); n < delta.count; i, n = (i+1)%delta.capacity, n+1 {
+		if seg := delta.Segments[i]; seg != nil {
+			for _, dr := range seg.DateRanges {
+				removed[dr.ID] = true
+			}
+		}
+	}
+	keep := func(dateRanges []*DateRange) []*DateRange {
+		// the delta update without skipped date ranges has all of them
+		if !delta.Skip.SkippedDateRanges {
+			return nil
+		}
+		var kept []*DateRange
+		for _, dr := range dateRanges {
+			if !removed[dr.ID] {
+				kept = append(kept, dr)
+			}
+		}
+		return kept
+	}
+
+	var segments []*MediaSegment
+	first, next := delta.SeqNo, delta.SeqNo+delta.Skip.SkippedSegments
+	// date ranges of the segments present in the delta update, the
+	// server may skip them so they are moved to the new segments
+	kept := make(map[uint64][]*DateRange)
+	lastSeqId := next
+	for i, n := p.head, uint(0); n < p.count; i, n = (i+1)%p.capacity, n+1 {
+		seg := p.Segments[i]
+		if seg == nil || seg.SeqId < first {
+			continue
+		}
+		lastSeqId = seg.SeqId + 1
+		if seg.SeqId >= next {
+			kept[seg.SeqId] = keep(seg.DateRanges)
+			continue
+		}
+		if len(seg.DateRanges) > 0 {
+			s := *seg
+			s.DateRanges = keep(seg.DateRanges)
+			seg = &s
+		}
+		segments = append(segments, seg)
+	}
+	if uint64(len(segments)) != delta.Skip.SkippedSegments {
+		return fmt.Errorf("skipped segments %d-%d not found in the playlist", first, next-1)
+	}
+	kept[lastSeqId] = append(kept[lastSeqId], keep(p.PendingDateRanges)...)
+	for i, n := delta.head, uint(0); n < delta.count; i, n = (i+1)%delta.capacity, n+1 {
+		seg := delta.Segments[i]
+		if seg == nil {
+			continue
+		}
+		if dateRanges := kept[seg.SeqId]; len(dateRanges) > 0 {
+			s := *seg
+			s.DateRanges = append(dateRanges, seg.DateRanges...)
+			seg = &s
+			delete(kept, seg.SeqId)
+		}
+		segments = append(segments, seg)
+	}
+	// date ranges of the segments not present in the delta update yet
+	var pending []*DateRange
+	for seqId := next; len(kept) > 0; seqId++ {
+		if dateRanges, ok := kept[seqId]; ok {
+			pending = append(pending, dateRanges...)
+			delete(kept, seqId)
+		}
+	}
+
+	merged := *delta
+	merged.buf = bytes.Buffer{}
+	merged.Skip = nil
+	// the version required by EXT-X-SKIP tag is not needed anymore
+	merged.ver = p.ver
+	version(&merged.ver, merged.MinVersion())
+	merged.DateRanges = append(keep(p.DateRanges), delta.DateRanges...)
+	merged.PendingDateRanges = append(pending, delta.PendingDateRanges...)
+	merged.customDecoders = p.customDecoders
+	merged.capacity = p.capacity
+	if merged.capacity < uint(len(segments)) {
+		merged.capacity = uint(len(segments))
+	}
+	merged.Segments = make([]*MediaSegment, merged.capacity)
+	copy(merged.Segments, segments)
+	merged.head = 0
+	merged.count = uint(len(segments))
+	merged.tail = merged.count % merged.capacity
+	merged.winsize = p.winsize
+	*p = merged
 	return nil
 }
 
+// SpliceInfo decodes base64 encoded splice_info_section of the cue
+// (EXT-OATCLS-SCTE35, EXT-X-CUE-OUT-CONT or EXT-SCTE35 tags).
+func (s *SCTE) SpliceInfo() (*scte35.SpliceInfoSection, error) {
+	if s.Cue == "" {
+		return nil, errors.New("SCTE-35 cue is empty")
+	}
+	return scte35.DecodeBase64(s.Cue)
+}
+
 // Decode detects type of playlist and decodes it. It accepts bytes
-// buffer as input.
+// buffer as input. The playlist decoded up to the failed line is
+// returned together with the error.
 func Decode(data bytes.Buffer, strict bool) (Playlist, ListType, error) {
-	return decode(&data, strict, nil)
+	p, listType, _, err := decode(readLines(&data), strictOptions(strict))
+	return p, listType, err
 }
 
 // DecodeFrom detects type of playlist and decodes it. It accepts data
-// conformed with io.Reader.
+// conformed with io.Reader. The playlist decoded up to the failed line
+// is returned together with the error.
 func DecodeFrom(reader io.Reader, strict bool) (Playlist, ListType, error) {
-	buf := new(bytes.Buffer)
-	_, err := buf.ReadFrom(reader)
+	data, err := readAll(reader)
 	if err != nil {
 		return nil, 0, err
 	}
-	return decode(buf, strict, nil)
+	p, listType, _, err := decode(data, strictOptions(strict))
+	return p, listType, err
 }
 
 // DecodeWith detects the type of playlist and decodes it. It accepts either bytes.Buffer
 // or io.Reader as input. Any custom decoders provided will be used during decoding.
+// The playlist decoded up to the failed line is returned together with the error.
 func DecodeWith(input interface{}, strict bool, customDecoders []CustomDecoder) (Playlist, ListType, error) {
+	opts := strictOptions(strict)
+	opts.customDecoders = customDecoders
+	p, listType, _, err := decodeInput(input, opts)
+	return p, listType, err
+}
+
+// DecodeLenient detects the type of playlist and decodes it in
+// non-strict mode like DecodeWith does. It returns the playlist with
+// problems recovered during decoding: unknown tags, malformed
+// attributes, orphan URIs and duplicate tags. Use errors.Is with
+// ErrUnknownTag, ErrOrphanURI and ErrDuplicateTag to distinguish them.
+func DecodeLenient(input interface{}, customDecoders []CustomDecoder) (Playlist, ListType, []*DecodeError, error) {
+	opts := strictOptions(false)
+	opts.customDecoders = customDecoders
+	return decodeInput(input, opts)
+}
+
+func decodeInput(input interface{}, opts *decodeOptions) (Playlist, ListType, []*DecodeError, error) {
 	switch v := input.(type) {
 	case bytes.Buffer:
-		return decode(&v, strict, customDecoders)
+		return decode(readLines(&v), opts)
 	case io.Reader:
-		buf := new(bytes.Buffer)
-		_, err := buf.ReadFrom(v)
+		data, err := readAll(v)
 		if err != nil {
-			return nil, 0, err
+			return nil, 0, nil, err
 		}
-		return decode(buf, strict, customDecoders)
+		return decode(data, opts)
 	default:
-		return nil, 0, errors.New("input must be bytes.Buffer or io.Reader type")
+		return nil, 0, nil, errors.New("input must be bytes.Buffer or io.Reader type")
 	}
 }
 
 // Detect playlist type and decode it. May be used as decoder for both
-// master and media playlists.
-func decode(buf *bytes.Buffer, strict bool, customDecoders []CustomDecoder) (Playlist, ListType, error) {
-	var eof bool
-	var line string
-	var master *MasterPlaylist
-	var media *MediaPlaylist
-	var listType ListType
-	var err error
-
-	state := new(decodingState)
-	wv := new(WV)
+// master and media playlists. The type is detected before decoding so
+// only the decoder of the detected type parses the lines.
+func decode(data string, opts *decodeOptions) (Playlist, ListType, []*DecodeError, error) {
+	switch detectListType(data) {
+	case MASTER:
+		master := NewMasterPlaylist()
+		problems, err := master.decode(data, opts)
+		if err != nil {
+			return master, MASTER, nil, err
+		}
+		return master, MASTER, problems, nil
+	case MEDIA:
+		media, problems, err := decodeMediaPlaylist(data, opts)
+		if err != nil {
+			return media, MEDIA, nil, err
+		}
+		return media, MEDIA, problems, nil
+	}
+	return nil, 0, nil, errors.New("Can't detect playlist type")
+}
 
-	master = NewMasterPlaylist()
-	media, err = NewMediaPlaylist(8, 1024) // Winsize for VoD will become 0, capacity auto extends
+// decodeMediaPlaylist creates the media playlist of unknown length and
+// decodes it.
+func decodeMediaPlaylist(data string, opts *decodeOptions) (*MediaPlaylist, []*DecodeError, error) {
+	// the ring is sized by the number of segments in the input and it
+	// is still extended on decoding if the guess is wrong
+	winsize, capacity := uint(8), uint(strings.Count(data, "#EXTINF:"))
+	if capacity < winsize {
+		capacity = winsize
+	}
+	if opts.maxSegments > 0 && uint(opts.maxSegments) < capacity {
+		capacity = uint(opts.maxSegments)
+		if capacity < winsize {
+			winsize = capacity
+		}
+	}
+	media, err := NewMediaPlaylist(winsize, capacity) // Winsize for VoD will become 0, capacity auto extends
 	if err != nil {
-		return nil, 0, fmt.Errorf("Create media playlist failed: %s", err)
+		return nil, nil, fmt.Errorf("Create media playlist failed: %s", err)
 	}
+	problems, err := media.decode(data, opts)
+	if err != nil {
+		return media, nil, err
+	}
+	if media.Closed || media.MediaType == EVENT {
+		// VoD and Event's should show the entire playlist
+		media.SetWinSize(0)
+	}
+	return media, problems, nil
+}
 
-	// If we have custom tags to parse
-	if customDecoders != nil {
-		media = media.WithCustomDecoders(customDecoders).(*MediaPlaylist)
-		master = master.WithCustomDecoders(customDecoders).(*MasterPlaylist)
-		state.custom = make(map[string]CustomTag)
+// Tags which are allowed only in master or only in media playlists.
+var (
+	masterTags = []string{
+		"#EXT-X-STREAM-INF:",
+		"#EXT-X-I-FRAME-STREAM-INF:",
+		"#EXT-X-MEDIA:",
+		"#EXT-X-SESSION-DATA:",
+		"#EXT-X-SESSION-KEY:",
+		"#EXT-X-CONTENT-STEERING:",
+	}
+	mediaTags = []string{
+		"#EXTINF:",
+		"#EXT-X-TARGETDURATION:",
+		"#EXT-X-MEDIA-SEQUENCE:",
+		"#EXT-X-DISCONTINUITY", // and EXT-X-DISCONTINUITY-SEQUENCE
+		"#EXT-X-PLAYLIST-TYPE:",
+		"#EXT-X-ENDLIST",
+		"#EXT-X-I-FRAMES-ONLY",
+		"#EXT-X-KEY:",
+		"#EXT-X-MAP:",
+		"#EXT-X-BYTERANGE:",
+		"#EXT-X-PROGRAM-DATE-TIME:",
+		"#EXT-X-DATERANGE:",
+		"#EXT-X-GAP",
+		"#EXT-X-BITRATE:",
+		"#EXT-SCTE35:",
+		"#EXT-X-SERVER-CONTROL:",
+		"#EXT-X-PART-INF:",
+		"#EXT-X-PART:",
+		"#EXT-X-PRELOAD-HINT:",
+		"#EXT-X-RENDITION-REPORT:",
+		"#EXT-X-SKIP:",
 	}
+)
 
-	for !eof {
-		if line, err = buf.ReadString('\n'); err == io.EOF {
-			eof = true
-		} else if err != nil {
-			break
+// detectListType looks through the lines for the first tag allowed
+// only in one type of playlists. EXT-X-VERSION, EXT-X-START and
+// Widevine tags (WV-CYPHER-VERSION is written in master playlists
+// too) may appear in both types so they point to a media playlist
+// unless a tag of master playlist follows. Zero is returned if the
+// type is unknown.
+func detectListType(data string) ListType {
+	var listType ListType
+	for len(data) > 0 {
+		line := data
+		if i := strings.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i], data[i+1:]
+		} else {
+			data = ""
 		}
-
-		// fixes the issues https://github.com/grafov/m3u8/issues/25
-		// TODO: the same should be done in decode functions of both Master- and MediaPlaylists
-		// so some DRYing would be needed.
-		if len(line) < 1 || line == "\r" {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || line[0] != '#' {
 			continue
 		}
-
-		err = decodeLineOfMasterPlaylist(master, state, line, strict)
-		master.attachRenditionsToVariants(state.alternatives)
-		if strict && err != nil {
-			return master, state.listType, err
+		for _, tag := range masterTags {
+			if strings.HasPrefix(line, tag) {
+				return MASTER
+			}
 		}
-
-		err = decodeLineOfMediaPlaylist(media, wv, state, line, strict)
-		if strict && err != nil {
-			return media, state.listType, err
+		for _, tag := range mediaTags {
+			if strings.HasPrefix(line, tag) {
+				return MEDIA
+			}
 		}
-
-	}
-	if state.listType == MEDIA && state.tagWV {
-		media.WV = wv
-	}
-
-	if strict && !state.m3u {
-		return nil, listType, errors.New("#EXTM3U absent")
-	}
-
-	switch state.listType {
-	case MASTER:
-		return master, MASTER, nil
-	case MEDIA:
-		if media.Closed || media.MediaType == EVENT {
-			// VoD and Event's should show the entire playlist
-			media.SetWinSize(0)
+		if strings.HasPrefix(line, "#EXT-X-VERSION:") || strings.HasPrefix(line, "#EXT-X-START:") || strings.HasPrefix(line, "#WV-") {
+			listType = MEDIA
 		}
-		return media, MEDIA, nil
 	}
-	return nil, state.listType, errors.New("Can't detect playlist type")
+	return listType
 }
 
 // DecodeAttributeList turns an attribute list into a key, value map. You should trim
@@ -292,23 +741,213 @@ func decodeParamsLine(line string) map[string]string {
 	return out
 }
 
+// decodeChannels parses CHANNELS attribute of EXT-X-MEDIA tag.
+func decodeChannels(value string) (*Channels, error) {
+	params := strings.Split(value, "/")
+	count, err := strconv.ParseUint(params[0], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("Channels count parsing error: %s", err)
+	}
+	c := &Channels{Count: uint32(count)}
+	if len(params) > 1 && params[1] != "-" {
+		c.Spatial = strings.Split(params[1], ",")
+	}
+	if len(params) > 2 {
+		c.Usage = strings.Split(params[2], ",")
+	}
+	return c, nil
+}
+
+// expandVariables replaces {$name} references in the value by values
+// of the variables. References to undefined variables are kept as is
+// and reported by the error.
+func expandVariables(value string, vars map[string]string) (string, error) {
+	var undefined []string
+	expanded := reVariableRef.ReplaceAllStringFunc(value, func(ref string) string {
+		name := ref[2 : len(ref)-1]
+		if v, ok := vars[name]; ok {
+			return v
+		}
+		undefined = append(undefined, name)
+		return ref
+	})
+	if len(undefined) > 0 {
+		return expanded, fmt.Errorf("undefined variable %q in %q", undefined[0], value)
+	}
+	return expanded, nil
+}
+
+// substituteVariables expands variable references in URI line or in
+// attribute values of the tag line. Raw values of the expanded URI
+// line and attributes are returned for symbolic encoding.
+func substituteVariables(line string, vars map[string]string) (string, *varRefs, error) {
+	if !strings.Contains(line, "{$") || strings.HasPrefix(line, "#EXT-X-DEFINE:") {
+		return line, nil, nil
+	}
+	if !strings.HasPrefix(line, "#") {
+		expanded, err := expandVariables(line, vars)
+		return expanded, &varRefs{raw: map[string]string{"URI": line}}, err
+	}
+	i := strings.IndexByte(line, ':')
+	if !strings.HasPrefix(line, "#EXT") || i < 0 {
+		return line, nil, nil // comments are ignored
+	}
+	var err error
+	refs := &varRefs{raw: make(map[string]string)}
+	attrs := reKeyValue.ReplaceAllStringFunc(line[i+1:], func(kv string) string {
+		j := strings.IndexByte(kv, '=')
+		name, value := kv[:j], kv[j+1:]
+		if !strings.Contains(value, "{$") {
+			return kv
+		}
+		// quoted-string or hexadecimal-sequence value
+		quoted := strings.HasPrefix(value, `"`)
+		if quoted {
+			value = strings.Trim(value, `"`)
+		}
+		expanded, e := expandVariables(value, vars)
+		if e != nil && err == nil {
+			err = e
+		}
+		refs.raw[name] = value
+		if quoted {
+			return name + `="` + expanded + `"`
+		}
+		return name + "=" + expanded
+	})
+	return line[:i+1] + attrs, refs, err
+}
+
+// decodeDefine parses attributes of EXT-X-DEFINE tag. Values of
+// imported variables and query parameters are not resolved here.
+func decodeDefine(line string) (*Define, error) {
+	var d *Define
+	params := decodeParamsLine(line)
+	for _, attr := range []struct {
+		name string
+		typ  DefineType
+	}{{"NAME", DefineValue}, {"IMPORT", DefineImport}, {"QUERYPARAM", DefineQueryParam}} {
+		if name, ok := params[attr.name]; ok {
+			if d != nil {
+				return nil, fmt.Errorf("EXT-X-DEFINE must have only one of NAME, IMPORT or QUERYPARAM: %q", line)
+			}
+			d = &Define{Name: name, Type: attr.typ}
+		}
+	}
+	if d == nil {
+		return nil, fmt.Errorf("EXT-X-DEFINE without NAME, IMPORT or QUERYPARAM: %q", line)
+	}
+	if value, ok := params["VALUE"]; ok {
+		if d.Type != DefineValue {
+			return nil, fmt.Errorf("EXT-X-DEFINE VALUE is allowed only with NAME: %q", line)
+		}
+		d.Value = value
+	} else if d.Type == DefineValue {
+		return nil, fmt.Errorf("EXT-X-DEFINE NAME requires VALUE: %q", line)
+	}
+	return d, nil
+}
+
+// variables returns values of defined variables, unresolved imports
+// and query parameters are skipped.
+func variables(defines []*Define) map[string]string {
+	vars := make(map[string]string, len(defines))
+	for _, d := range defines {
+		if d.Type == DefineValue || d.Value != "" {
+			vars[d.Name] = d.Value
+		}
+	}
+	return vars
+}
+
+// Variables returns values of variables defined by EXT-X-DEFINE tags
+// of the master playlist. Media playlists may import them with
+// MediaPlaylist.ImportVariables.
+func (p *MasterPlaylist) Variables() map[string]string {
+	return variables(p.Defines)
+}
+
+// Variables returns values of variables defined by EXT-X-DEFINE tags
+// of the media playlist.
+func (p *MediaPlaylist) Variables() map[string]string {
+	return variables(p.Defines)
+}
+
+// SetQueryParams sets query parameters of the playlist URI used for
+// resolving of EXT-X-DEFINE:QUERYPARAM variables. It must be called
+// before decoding.
+func (p *MasterPlaylist) SetQueryParams(query url.Values) {
+	p.query = query
+}
+
+// SetQueryParams sets query parameters of the playlist URI used for
+// resolving of EXT-X-DEFINE:QUERYPARAM variables. It must be called
+// before decoding.
+func (p *MediaPlaylist) SetQueryParams(query url.Values) {
+	p.query = query
+}
+
+// PreserveUnknownTags sets whether the decoder keeps tags and comments
+// it doesn't recognise. Lines before the first alternative or variant
+// are kept in UnknownTags of the playlist, lines after them in
+// UnknownTags of the next variant and lines after the last variant in
+// TrailingTags. Encode displays them in the same places. It must be
+// called before decoding.
+func (p *MasterPlaylist) PreserveUnknownTags(preserve bool) {
+	p.preserveUnknown = preserve
+}
+
+// PreserveUnknownTags sets whether the decoder keeps tags and comments
+// it doesn't recognise. Lines before the first EXTINF are kept in
+// UnknownTags of the playlist, lines after them in UnknownTags of the
+// next segment and lines after the last segment in TrailingTags.
+// Encode displays them in the same places. It must be called before
+// decoding.
+func (p *MediaPlaylist) PreserveUnknownTags(preserve bool) {
+	p.preserveUnknown = preserve
+}
+
+// ImportVariables sets variables of the master playlist used for
+// resolving of EXT-X-DEFINE:IMPORT variables. It must be called before
+// decoding.
+func (p *MediaPlaylist) ImportVariables(vars map[string]string) {
+	p.importVars = vars
+}
+
 // Parse one line of master playlist.
 func decodeLineOfMasterPlaylist(p *MasterPlaylist, state *decodingState, line string, strict bool) error {
 	var err error
+	var custom bool
 
 	line = strings.TrimSpace(line)
+	raw := line
+	state.unknownTag, state.orphanURI = false, false
+	state.refs = nil
+
+	if len(p.Defines) > 0 {
+		if state.vars == nil {
+			state.vars = p.Variables()
+		}
+		if line, state.refs, err = substituteVariables(line, state.vars); err != nil {
+			if state.check(err, strict) {
+				return err
+			}
+			err = nil
+		}
+	}
 
 	// check for custom tags first to allow custom parsing of existing tags
 	if p.Custom != nil {
 		for _, v := range p.customDecoders {
 			if strings.HasPrefix(line, v.TagName()) {
+				custom = true
 				t, err := v.Decode(line)
 
-				if strict && err != nil {
+				if state.check(err, strict) {
 					return err
 				}
 
-				p.Custom[t.TagName()] = t
+				p.customOrder.set(p.Custom, t.TagName(), t)
 			}
 		}
 	}
@@ -319,13 +958,89 @@ func decodeLineOfMasterPlaylist(p *MasterPlaylist, state *decodingState, line st
 	case strings.HasPrefix(line, "#EXT-X-VERSION:"): // version tag
 		state.listType = MASTER
 		_, err = fmt.Sscanf(line, "#EXT-X-VERSION:%d", &p.ver)
-		if strict && err != nil {
+		if state.check(err, strict) {
 			return err
 		}
 	case line == "#EXT-X-INDEPENDENT-SEGMENTS":
 		p.SetIndependentSegments(true)
+	case strings.HasPrefix(line, "#EXT-X-SESSION-DATA:"):
+		state.listType = MASTER
+		sd := new(SessionData)
+		for k, v := range decodeParamsLine(line[20:]) {
+			switch k {
+			case "DATA-ID":
+				sd.DataID = v
+			case "VALUE":
+				sd.Value = v
+			case "URI":
+				sd.URI = v
+			case "FORMAT":
+				sd.Format = v
+			case "LANGUAGE":
+				sd.Language = v
+			}
+		}
+		if err = sd.Validate(); state.check(err, strict) {
+			return err
+		}
+		sd.vars = state.refs
+		p.SessionData = append(p.SessionData, sd)
+	case strings.HasPrefix(line, "#EXT-X-DEFINE:"):
+		var d *Define
+		if d, err = decodeDefine(line[14:]); err != nil {
+			if state.check(err, strict) {
+				return err
+			}
+			return nil
+		}
+		if err = p.AppendDefine(d); state.check(err, strict) {
+			return err
+		}
+		state.vars = p.Variables()
+		err = nil
+	case strings.HasPrefix(line, "#EXT-X-CONTENT-STEERING:"):
+		state.listType = MASTER
+		p.ContentSteering = &ContentSteering{vars: state.refs}
+		for k, v := range decodeParamsLine(line[24:]) {
+			switch k {
+			case "SERVER-URI":
+				p.ContentSteering.ServerURI = v
+			case "PATHWAY-ID":
+				p.ContentSteering.PathwayID = v
+			}
+		}
+		if p.ContentSteering.ServerURI == "" {
+			err = errors.New("EXT-X-CONTENT-STEERING requires SERVER-URI attribute")
+			if state.check(err, strict) {
+				return err
+			}
+		}
+	case strings.HasPrefix(line, "#EXT-X-SESSION-KEY:"):
+		state.listType = MASTER
+		key := &Key{vars: state.refs}
+		for k, v := range decodeParamsLine(line[19:]) {
+			switch k {
+			case "METHOD":
+				key.Method = v
+			case "URI":
+				key.URI = v
+			case "IV":
+				key.IV = v
+			case "KEYFORMAT":
+				key.Keyformat = v
+			case "KEYFORMATVERSIONS":
+				key.Keyformatversions = v
+			}
+		}
+		if key.Method == "NONE" {
+			err = errors.New("EXT-X-SESSION-KEY METHOD must not be NONE")
+			if state.check(err, strict) {
+				return err
+			}
+		}
+		p.SessionKeys = append(p.SessionKeys, key)
 	case strings.HasPrefix(line, "#EXT-X-MEDIA:"):
-		var alt Alternative
+		alt := Alternative{vars: state.refs}
 		state.listType = MASTER
 		for k, v := range decodeParamsLine(line[13:]) {
 			switch k {
@@ -342,8 +1057,11 @@ func decodeLineOfMasterPlaylist(p *MasterPlaylist, state *decodingState, line st
 					alt.Default = true
 				} else if strings.ToUpper(v) == "NO" {
 					alt.Default = false
-				} else if strict {
-					return errors.New("value must be YES or NO")
+				} else {
+					err = errors.New("value must be YES or NO")
+					if state.check(err, strict) {
+						return err
+					}
 				}
 			case "AUTOSELECT":
 				alt.Autoselect = v
@@ -355,27 +1073,58 @@ func decodeLineOfMasterPlaylist(p *MasterPlaylist, state *decodingState, line st
 				alt.Subtitles = v
 			case "URI":
 				alt.URI = v
+			case "STABLE-RENDITION-ID":
+				alt.StableRenditionID = v
+			case "ASSOC-LANGUAGE":
+				alt.AssocLanguage = v
+			case "INSTREAM-ID":
+				if !reInstreamId.MatchString(v) {
+					err = fmt.Errorf("invalid INSTREAM-ID: %s", v)
+					if state.check(err, strict) {
+						return err
+					}
+				}
+				alt.InstreamId = v
+			case "CHANNELS":
+				if alt.Channels, err = decodeChannels(v); state.check(err, strict) {
+					return err
+				}
+			case "BIT-DEPTH":
+				var val int
+				val, err = strconv.Atoi(v)
+				if state.check(err, strict) {
+					return err
+				}
+				alt.BitDepth = uint32(val)
+			case "SAMPLE-RATE":
+				var val int
+				val, err = strconv.Atoi(v)
+				if state.check(err, strict) {
+					return err
+				}
+				alt.SampleRate = uint32(val)
 			}
 		}
 		state.alternatives = append(state.alternatives, &alt)
 	case !state.tagStreamInf && strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
 		state.tagStreamInf = true
 		state.listType = MASTER
-		state.variant = new(Variant)
+		state.variant = &Variant{vars: state.refs}
+		state.variant.UnknownTags, state.unknownVariant = state.unknownVariant, nil
 		p.Variants = append(p.Variants, state.variant)
 		for k, v := range decodeParamsLine(line[18:]) {
 			switch k {
 			case "PROGRAM-ID":
 				var val int
 				val, err = strconv.Atoi(v)
-				if strict && err != nil {
+				if state.check(err, strict) {
 					return err
 				}
 				state.variant.ProgramId = uint32(val)
 			case "BANDWIDTH":
 				var val int
 				val, err = strconv.Atoi(v)
-				if strict && err != nil {
+				if state.check(err, strict) {
 					return err
 				}
 				state.variant.Bandwidth = uint32(val)
@@ -396,27 +1145,51 @@ func decodeLineOfMasterPlaylist(p *MasterPlaylist, state *decodingState, line st
 			case "AVERAGE-BANDWIDTH":
 				var val int
 				val, err = strconv.Atoi(v)
-				if strict && err != nil {
+				if state.check(err, strict) {
 					return err
 				}
 				state.variant.AverageBandwidth = uint32(val)
 			case "FRAME-RATE":
-				if state.variant.FrameRate, err = strconv.ParseFloat(v, 64); strict && err != nil {
+				if state.variant.FrameRate, err = strconv.ParseFloat(v, 64); state.check(err, strict) {
+					return err
+				}
+			case "SCORE":
+				if state.variant.Score, err = strconv.ParseFloat(v, 64); state.check(err, strict) {
 					return err
 				}
+			case "SUPPLEMENTAL-CODECS":
+				state.variant.SupplementalCodecs = v
+			case "ALLOWED-CPC":
+				state.variant.AllowedCPC = v
+			case "REQ-VIDEO-LAYOUT":
+				state.variant.ReqVideoLayout = v
 			case "VIDEO-RANGE":
 				state.variant.VideoRange = v
 			case "HDCP-LEVEL":
 				state.variant.HDCPLevel = v
+			case "PATHWAY-ID":
+				state.variant.PathwayID = v
+			case "STABLE-VARIANT-ID":
+				state.variant.StableVariantID = v
 			}
 		}
 	case state.tagStreamInf && !strings.HasPrefix(line, "#"):
 		state.tagStreamInf = false
 		state.variant.URI = line
+		if state.refs != nil {
+			if state.variant.vars == nil {
+				state.variant.vars = &varRefs{raw: make(map[string]string)}
+			}
+			state.variant.vars.raw["URI"] = state.refs.raw["URI"]
+		}
+	case state.tagStreamInf && strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+		// URI of the previous variant is absent
+		state.errs = append(state.errs, ErrDuplicateTag)
 	case strings.HasPrefix(line, "#EXT-X-I-FRAME-STREAM-INF:"):
 		state.listType = MASTER
-		state.variant = new(Variant)
+		state.variant = &Variant{vars: state.refs}
 		state.variant.Iframe = true
+		state.variant.UnknownTags, state.unknownVariant = state.unknownVariant, nil
 		if len(state.alternatives) > 0 {
 			state.variant.Alternatives = state.alternatives
 			state.alternatives = nil
@@ -429,14 +1202,14 @@ func decodeLineOfMasterPlaylist(p *MasterPlaylist, state *decodingState, line st
 			case "PROGRAM-ID":
 				var val int
 				val, err = strconv.Atoi(v)
-				if strict && err != nil {
+				if state.check(err, strict) {
 					return err
 				}
 				state.variant.ProgramId = uint32(val)
 			case "BANDWIDTH":
 				var val int
 				val, err = strconv.Atoi(v)
-				if strict && err != nil {
+				if state.check(err, strict) {
 					return err
 				}
 				state.variant.Bandwidth = uint32(val)
@@ -451,18 +1224,46 @@ func decodeLineOfMasterPlaylist(p *MasterPlaylist, state *decodingState, line st
 			case "AVERAGE-BANDWIDTH":
 				var val int
 				val, err = strconv.Atoi(v)
-				if strict && err != nil {
+				if state.check(err, strict) {
 					return err
 				}
 				state.variant.AverageBandwidth = uint32(val)
+			case "FRAME-RATE":
+				if state.variant.FrameRate, err = strconv.ParseFloat(v, 64); state.check(err, strict) {
+					return err
+				}
+			case "SCORE":
+				if state.variant.Score, err = strconv.ParseFloat(v, 64); state.check(err, strict) {
+					return err
+				}
+			case "SUPPLEMENTAL-CODECS":
+				state.variant.SupplementalCodecs = v
+			case "ALLOWED-CPC":
+				state.variant.AllowedCPC = v
+			case "REQ-VIDEO-LAYOUT":
+				state.variant.ReqVideoLayout = v
 			case "VIDEO-RANGE":
 				state.variant.VideoRange = v
 			case "HDCP-LEVEL":
 				state.variant.HDCPLevel = v
+			case "PATHWAY-ID":
+				state.variant.PathwayID = v
+			case "STABLE-VARIANT-ID":
+				state.variant.StableVariantID = v
 			}
 		}
 	case strings.HasPrefix(line, "#"):
 		// comments are ignored
+		state.unknownTag = strings.HasPrefix(line, "#EXT") && !custom
+		if p.preserveUnknown && !custom {
+			if len(p.Variants) == 0 && len(state.alternatives) == 0 {
+				p.UnknownTags = append(p.UnknownTags, raw)
+			} else {
+				state.unknownVariant = append(state.unknownVariant, raw)
+			}
+		}
+	case line != "":
+		state.orphanURI = true
 	}
 	return err
 }
@@ -470,24 +1271,41 @@ func decodeLineOfMasterPlaylist(p *MasterPlaylist, state *decodingState, line st
 // Parse one line of media playlist.
 func decodeLineOfMediaPlaylist(p *MediaPlaylist, wv *WV, state *decodingState, line string, strict bool) error {
 	var err error
+	var custom bool
 
 	line = strings.TrimSpace(line)
+	raw := line
+	state.unknownTag, state.orphanURI = false, false
+	state.refs = nil
+
+	if len(p.Defines) > 0 {
+		if state.vars == nil {
+			state.vars = p.Variables()
+		}
+		if line, state.refs, err = substituteVariables(line, state.vars); err != nil {
+			if state.check(err, strict) {
+				return err
+			}
+			err = nil
+		}
+	}
 
 	// check for custom tags first to allow custom parsing of existing tags
 	if p.Custom != nil {
 		for _, v := range p.customDecoders {
 			if strings.HasPrefix(line, v.TagName()) {
+				custom = true
 				t, err := v.Decode(line)
 
-				if strict && err != nil {
+				if state.check(err, strict) {
 					return err
 				}
 
 				if v.SegmentTag() {
 					state.tagCustom = true
-					state.custom[v.TagName()] = t
+					state.customOrder.set(state.custom, v.TagName(), t)
 				} else {
-					p.Custom[v.TagName()] = t
+					p.customOrder.set(p.Custom, v.TagName(), t)
 				}
 			}
 		}
@@ -499,14 +1317,14 @@ func decodeLineOfMediaPlaylist(p *MediaPlaylist, wv *WV, state *decodingState, l
 		state.listType = MEDIA
 		sepIndex := strings.Index(line, ",")
 		if sepIndex == -1 {
-			if strict {
-				return fmt.Errorf("could not parse: %q", line)
+			if err = fmt.Errorf("could not parse: %q", line); state.check(err, strict) {
+				return err
 			}
 			sepIndex = len(line)
 		}
 		duration := line[8:sepIndex]
 		if len(duration) > 0 {
-			if state.duration, err = strconv.ParseFloat(duration, 64); strict && err != nil {
+			if state.duration, err = strconv.ParseFloat(duration, 64); state.check(err, strict) {
 				return fmt.Errorf("Duration parsing error: %s", err)
 			}
 		}
@@ -531,34 +1349,53 @@ func decodeLineOfMediaPlaylist(p *MediaPlaylist, wv *WV, state *decodingState, l
 				return err
 			}
 			state.tagInf = false
+			state.segment = true
+			p.Segments[p.last()].vars = state.refs
+			// unrecognised tags appeared before the segment URI link to this segment
+			if len(state.unknownSegment) > 0 {
+				p.Segments[p.last()].UnknownTags = state.unknownSegment
+				state.unknownSegment = nil
+			}
+		} else if line != "" {
+			state.orphanURI = true
+		}
+		// EXT-X-BITRATE applies to all following segments without EXT-X-BYTERANGE
+		if state.bitrate > 0 && !state.tagRange && p.Count() > 0 {
+			p.Segments[p.last()].Bitrate = state.bitrate
+		}
+		if state.tagGap {
+			state.tagGap = false
+			if err = p.SetGap(); state.check(err, strict) {
+				return err
+			}
 		}
 		if state.tagRange {
-			if err = p.SetRange(state.limit, state.offset); strict && err != nil {
+			if err = p.SetRange(state.limit, state.offset); state.check(err, strict) {
 				return err
 			}
 			state.tagRange = false
 		}
 		if state.tagSCTE35 {
 			state.tagSCTE35 = false
-			if err = p.SetSCTE35(state.scte); strict && err != nil {
+			if err = p.SetSCTE35(state.scte); state.check(err, strict) {
 				return err
 			}
 		}
 		if state.tagDiscontinuity {
 			state.tagDiscontinuity = false
-			if err = p.SetDiscontinuity(); strict && err != nil {
+			if err = p.SetDiscontinuity(); state.check(err, strict) {
 				return err
 			}
 		}
 		if state.tagProgramDateTime && p.Count() > 0 {
 			state.tagProgramDateTime = false
-			if err = p.SetProgramDateTime(state.programDateTime); strict && err != nil {
+			if err = p.SetProgramDateTime(state.programDateTime); state.check(err, strict) {
 				return err
 			}
 		}
 		// If EXT-X-KEY appeared before reference to segment (EXTINF) then it linked to this segment
 		if state.tagKey {
-			p.Segments[p.last()].Key = &Key{state.xkey.Method, state.xkey.URI, state.xkey.IV, state.xkey.Keyformat, state.xkey.Keyformatversions}
+			p.Segments[p.last()].Key = &Key{state.xkey.Method, state.xkey.URI, state.xkey.IV, state.xkey.Keyformat, state.xkey.Keyformatversions, state.xkey.vars}
 			// First EXT-X-KEY may appeared in the header of the playlist and linked to first segment
 			// but for convenient playlist generation it also linked as default playlist key
 			if p.Key == nil {
@@ -568,7 +1405,7 @@ func decodeLineOfMediaPlaylist(p *MediaPlaylist, wv *WV, state *decodingState, l
 		}
 		// If EXT-X-MAP appeared before reference to segment (EXTINF) then it linked to this segment
 		if state.tagMap {
-			p.Segments[p.last()].Map = &Map{state.xmap.URI, state.xmap.Limit, state.xmap.Offset}
+			p.Segments[p.last()].Map = &Map{state.xmap.URI, state.xmap.Limit, state.xmap.Offset, state.xmap.vars}
 			// First EXT-X-MAP may appeared in the header of the playlist and linked to first segment
 			// but for convenient playlist generation it also linked as default playlist map
 			if p.Map == nil {
@@ -580,7 +1417,9 @@ func decodeLineOfMediaPlaylist(p *MediaPlaylist, wv *WV, state *decodingState, l
 		// if segment custom tag appeared before EXTINF then it links to this segment
 		if state.tagCustom {
 			p.Segments[p.last()].Custom = state.custom
+			p.Segments[p.last()].customOrder = state.customOrder
 			state.custom = make(map[string]CustomTag)
+			state.customOrder = nil
 			state.tagCustom = false
 		}
 	// start tag first
@@ -591,17 +1430,17 @@ func decodeLineOfMediaPlaylist(p *MediaPlaylist, wv *WV, state *decodingState, l
 		p.Closed = true
 	case strings.HasPrefix(line, "#EXT-X-VERSION:"):
 		state.listType = MEDIA
-		if _, err = fmt.Sscanf(line, "#EXT-X-VERSION:%d", &p.ver); strict && err != nil {
+		if _, err = fmt.Sscanf(line, "#EXT-X-VERSION:%d", &p.ver); state.check(err, strict) {
 			return err
 		}
 	case strings.HasPrefix(line, "#EXT-X-TARGETDURATION:"):
 		state.listType = MEDIA
-		if _, err = fmt.Sscanf(line, "#EXT-X-TARGETDURATION:%f", &p.TargetDuration); strict && err != nil {
+		if _, err = fmt.Sscanf(line, "#EXT-X-TARGETDURATION:%f", &p.TargetDuration); state.check(err, strict) {
 			return err
 		}
 	case strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"):
 		state.listType = MEDIA
-		if _, err = fmt.Sscanf(line, "#EXT-X-MEDIA-SEQUENCE:%d", &p.SeqNo); strict && err != nil {
+		if _, err = fmt.Sscanf(line, "#EXT-X-MEDIA-SEQUENCE:%d", &p.SeqNo); state.check(err, strict) {
 			return err
 		}
 	case strings.HasPrefix(line, "#EXT-X-PLAYLIST-TYPE:"):
@@ -609,7 +1448,7 @@ func decodeLineOfMediaPlaylist(p *MediaPlaylist, wv *WV, state *decodingState, l
 		var playlistType string
 		_, err = fmt.Sscanf(line, "#EXT-X-PLAYLIST-TYPE:%s", &playlistType)
 		if err != nil {
-			if strict {
+			if state.check(err, strict) {
 				return err
 			}
 		} else {
@@ -622,7 +1461,7 @@ func decodeLineOfMediaPlaylist(p *MediaPlaylist, wv *WV, state *decodingState, l
 		}
 	case strings.HasPrefix(line, "#EXT-X-DISCONTINUITY-SEQUENCE:"):
 		state.listType = MEDIA
-		if _, err = fmt.Sscanf(line, "#EXT-X-DISCONTINUITY-SEQUENCE:%d", &p.DiscontinuitySeq); strict && err != nil {
+		if _, err = fmt.Sscanf(line, "#EXT-X-DISCONTINUITY-SEQUENCE:%d", &p.DiscontinuitySeq); state.check(err, strict) {
 			return err
 		}
 	case strings.HasPrefix(line, "#EXT-X-START:"):
@@ -631,7 +1470,7 @@ func decodeLineOfMediaPlaylist(p *MediaPlaylist, wv *WV, state *decodingState, l
 			switch k {
 			case "TIME-OFFSET":
 				st, err := strconv.ParseFloat(v, 64)
-				if err != nil {
+				if state.check(err, strict) {
 					return fmt.Errorf("Invalid TIME-OFFSET: %s: %v", v, err)
 				}
 				p.StartTime = st
@@ -639,9 +1478,198 @@ func decodeLineOfMediaPlaylist(p *MediaPlaylist, wv *WV, state *decodingState, l
 				p.StartTimePrecise = v == "YES"
 			}
 		}
+	case strings.HasPrefix(line, "#EXT-X-DEFINE:"):
+		var d *Define
+		if d, err = decodeDefine(line[14:]); err != nil {
+			if state.check(err, strict) {
+				return err
+			}
+			return nil
+		}
+		if err = p.AppendDefine(d); state.check(err, strict) {
+			return err
+		}
+		state.vars = p.Variables()
+		err = nil
+	case strings.HasPrefix(line, "#EXT-X-SERVER-CONTROL:"):
+		state.listType = MEDIA
+		p.ServerControl = new(ServerControl)
+		for k, v := range decodeParamsLine(line[22:]) {
+			switch k {
+			case "CAN-BLOCK-RELOAD":
+				p.ServerControl.CanBlockReload = v == "YES"
+			case "CAN-SKIP-UNTIL":
+				if p.ServerControl.CanSkipUntil, err = strconv.ParseFloat(v, 64); state.check(err, strict) {
+					return fmt.Errorf("Invalid CAN-SKIP-UNTIL: %s: %v", v, err)
+				}
+			case "CAN-SKIP-DATERANGES":
+				p.ServerControl.CanSkipDateRanges = v == "YES"
+			case "HOLD-BACK":
+				if p.ServerControl.HoldBack, err = strconv.ParseFloat(v, 64); state.check(err, strict) {
+					return fmt.Errorf("Invalid HOLD-BACK: %s: %v", v, err)
+				}
+			case "PART-HOLD-BACK":
+				if p.ServerControl.PartHoldBack, err = strconv.ParseFloat(v, 64); state.check(err, strict) {
+					return fmt.Errorf("Invalid PART-HOLD-BACK: %s: %v", v, err)
+				}
+			}
+		}
+	case strings.HasPrefix(line, "#EXT-X-SKIP:"):
+		state.listType = MEDIA
+		p.Skip = new(Skip)
+		for k, v := range decodeParamsLine(line[12:]) {
+			switch k {
+			case "SKIPPED-SEGMENTS":
+				if p.Skip.SkippedSegments, err = strconv.ParseUint(v, 10, 64); state.check(err, strict) {
+					return fmt.Errorf("Invalid SKIPPED-SEGMENTS: %s: %v", v, err)
+				}
+			case "RECENTLY-REMOVED-DATERANGES":
+				p.Skip.SkippedDateRanges = true
+				if v != "" {
+					p.Skip.RecentlyRemovedDateRanges = strings.Split(v, "\t")
+				}
+			}
+		}
+	case strings.HasPrefix(line, "#EXT-X-PART-INF:"):
+		state.listType = MEDIA
+		for k, v := range decodeParamsLine(line[16:]) {
+			switch k {
+			case "PART-TARGET":
+				if p.PartTargetDuration, err = strconv.ParseFloat(v, 64); state.check(err, strict) {
+					return fmt.Errorf("Invalid PART-TARGET: %s: %v", v, err)
+				}
+			}
+		}
+	case strings.HasPrefix(line, "#EXT-X-PART:"):
+		state.listType = MEDIA
+		part := &PartialSegment{vars: state.refs}
+		for k, v := range decodeParamsLine(line[12:]) {
+			switch k {
+			case "URI":
+				part.URI = v
+			case "DURATION":
+				if part.Duration, err = strconv.ParseFloat(v, 64); state.check(err, strict) {
+					return fmt.Errorf("Partial segment duration parsing error: %s", err)
+				}
+			case "INDEPENDENT":
+				part.Independent = v == "YES"
+			case "GAP":
+				part.Gap = v == "YES"
+			case "BYTERANGE":
+				params := strings.SplitN(v, "@", 2)
+				if part.Limit, err = strconv.ParseInt(params[0], 10, 64); state.check(err, strict) {
+					return fmt.Errorf("Byterange sub-range length value parsing error: %s", err)
+				}
+				if len(params) > 1 {
+					if part.Offset, err = strconv.ParseInt(params[1], 10, 64); state.check(err, strict) {
+						return fmt.Errorf("Byterange sub-range offset value parsing error: %s", err)
+					}
+				} else {
+					part.Offset = -1
+				}
+			}
+		}
+		if part.Offset < 0 {
+			part.Offset = 0
+			if state.part != nil && state.part.URI == part.URI {
+				// the sub-range begins at the next byte following
+				// the sub-range of the previous part
+				part.Offset = state.part.Offset + state.part.Limit
+			}
+		}
+		state.part = part
+		p.AppendPart(part)
+	case strings.HasPrefix(line, "#EXT-X-PRELOAD-HINT:"):
+		state.listType = MEDIA
+		hint := &PreloadHint{vars: state.refs}
+		for k, v := range decodeParamsLine(line[20:]) {
+			switch k {
+			case "TYPE":
+				hint.Type = v
+			case "URI":
+				hint.URI = v
+			case "BYTERANGE-START":
+				if hint.Offset, err = strconv.ParseInt(v, 10, 64); state.check(err, strict) {
+					return fmt.Errorf("Invalid BYTERANGE-START: %s: %v", v, err)
+				}
+			case "BYTERANGE-LENGTH":
+				if hint.Limit, err = strconv.ParseInt(v, 10, 64); state.check(err, strict) {
+					return fmt.Errorf("Invalid BYTERANGE-LENGTH: %s: %v", v, err)
+				}
+			}
+		}
+		p.PreloadHints = append(p.PreloadHints, hint)
+	case strings.HasPrefix(line, "#EXT-X-RENDITION-REPORT:"):
+		state.listType = MEDIA
+		report := &RenditionReport{vars: state.refs}
+		for k, v := range decodeParamsLine(line[24:]) {
+			switch k {
+			case "URI":
+				report.URI = v
+			case "LAST-MSN":
+				if report.LastMSN, err = strconv.ParseUint(v, 10, 64); state.check(err, strict) {
+					return fmt.Errorf("Invalid LAST-MSN: %s: %v", v, err)
+				}
+			case "LAST-PART":
+				var part int64
+				if part, err = strconv.ParseInt(v, 10, 64); state.check(err, strict) {
+					return fmt.Errorf("Invalid LAST-PART: %s: %v", v, err)
+				}
+				report.LastPart = &part
+			}
+		}
+		p.RenditionReports = append(p.RenditionReports, report)
+	case strings.HasPrefix(line, "#EXT-X-DATERANGE:"):
+		state.listType = MEDIA
+		dr := &DateRange{vars: state.refs}
+		for _, kv := range reKeyValue.FindAllStringSubmatch(line[17:], -1) {
+			k, v := kv[1], strings.Trim(kv[2], `"`)
+			switch {
+			case k == "ID":
+				dr.ID = v
+			case k == "CLASS":
+				dr.Class = v
+			case k == "START-DATE":
+				if dr.StartDate, err = state.parseTime(v); state.check(err, strict) {
+					return fmt.Errorf("Invalid START-DATE: %s: %v", v, err)
+				}
+			case k == "END-DATE":
+				if dr.EndDate, err = state.parseTime(v); state.check(err, strict) {
+					return fmt.Errorf("Invalid END-DATE: %s: %v", v, err)
+				}
+			case k == "DURATION":
+				var duration float64
+				if duration, err = strconv.ParseFloat(v, 64); state.check(err, strict) {
+					return fmt.Errorf("Invalid DURATION: %s: %v", v, err)
+				}
+				dr.Duration = &duration
+			case k == "PLANNED-DURATION":
+				if dr.PlannedDuration, err = strconv.ParseFloat(v, 64); state.check(err, strict) {
+					return fmt.Errorf("Invalid PLANNED-DURATION: %s: %v", v, err)
+				}
+			case k == "END-ON-NEXT":
+				dr.EndOnNext = v == "YES"
+			case k == "SCTE35-CMD":
+				dr.SCTE35Cmd = v
+			case k == "SCTE35-OUT":
+				dr.SCTE35Out = v
+			case k == "SCTE35-IN":
+				dr.SCTE35In = v
+			case strings.HasPrefix(k, "X-"):
+				if dr.X == nil {
+					dr.X = make(map[string]string)
+				}
+				dr.X[k] = kv[2] // client attributes keep quotes of the value
+			}
+		}
+		if err = dr.Validate(); state.check(err, strict) {
+			return err
+		}
+		// date range is linked to the segment that follows it
+		p.PendingDateRanges = append(p.PendingDateRanges, dr)
 	case strings.HasPrefix(line, "#EXT-X-KEY:"):
 		state.listType = MEDIA
-		state.xkey = new(Key)
+		state.xkey = &Key{vars: state.refs}
 		for k, v := range decodeParamsLine(line[11:]) {
 			switch k {
 			case "METHOD":
@@ -659,13 +1687,13 @@ func decodeLineOfMediaPlaylist(p *MediaPlaylist, wv *WV, state *decodingState, l
 		state.tagKey = true
 	case strings.HasPrefix(line, "#EXT-X-MAP:"):
 		state.listType = MEDIA
-		state.xmap = new(Map)
+		state.xmap = &Map{vars: state.refs}
 		for k, v := range decodeParamsLine(line[11:]) {
 			switch k {
 			case "URI":
 				state.xmap.URI = v
 			case "BYTERANGE":
-				if _, err = fmt.Sscanf(v, "%d@%d", &state.xmap.Limit, &state.xmap.Offset); strict && err != nil {
+				if _, err = fmt.Sscanf(v, "%d@%d", &state.xmap.Limit, &state.xmap.Offset); state.check(err, strict) {
 					return fmt.Errorf("Byterange sub-range length value parsing error: %s", err)
 				}
 			}
@@ -674,7 +1702,7 @@ func decodeLineOfMediaPlaylist(p *MediaPlaylist, wv *WV, state *decodingState, l
 	case !state.tagProgramDateTime && strings.HasPrefix(line, "#EXT-X-PROGRAM-DATE-TIME:"):
 		state.tagProgramDateTime = true
 		state.listType = MEDIA
-		if state.programDateTime, err = TimeParse(line[25:]); strict && err != nil {
+		if state.programDateTime, err = state.parseTime(line[25:]); state.check(err, strict) {
 			return err
 		}
 	case !state.tagRange && strings.HasPrefix(line, "#EXT-X-BYTERANGE:"):
@@ -682,11 +1710,11 @@ func decodeLineOfMediaPlaylist(p *MediaPlaylist, wv *WV, state *decodingState, l
 		state.listType = MEDIA
 		state.offset = 0
 		params := strings.SplitN(line[17:], "@", 2)
-		if state.limit, err = strconv.ParseInt(params[0], 10, 64); strict && err != nil {
+		if state.limit, err = strconv.ParseInt(params[0], 10, 64); state.check(err, strict) {
 			return fmt.Errorf("Byterange sub-range length value parsing error: %s", err)
 		}
 		if len(params) > 1 {
-			if state.offset, err = strconv.ParseInt(params[1], 10, 64); strict && err != nil {
+			if state.offset, err = strconv.ParseInt(params[1], 10, 64); state.check(err, strict) {
 				return fmt.Errorf("Byterange sub-range offset value parsing error: %s", err)
 			}
 		}
@@ -747,12 +1775,20 @@ func decodeLineOfMediaPlaylist(p *MediaPlaylist, wv *WV, state *decodingState, l
 	case !state.tagDiscontinuity && strings.HasPrefix(line, "#EXT-X-DISCONTINUITY"):
 		state.tagDiscontinuity = true
 		state.listType = MEDIA
+	case line == "#EXT-X-GAP":
+		state.tagGap = true
+		state.listType = MEDIA
+	case strings.HasPrefix(line, "#EXT-X-BITRATE:"):
+		state.listType = MEDIA
+		if state.bitrate, err = strconv.ParseInt(line[15:], 10, 64); state.check(err, strict) {
+			return fmt.Errorf("Bitrate value parsing error: %s", err)
+		}
 	case strings.HasPrefix(line, "#EXT-X-I-FRAMES-ONLY"):
 		state.listType = MEDIA
 		p.Iframe = true
 	case strings.HasPrefix(line, "#WV-AUDIO-CHANNELS"):
 		state.listType = MEDIA
-		if _, err = fmt.Sscanf(line, "#WV-AUDIO-CHANNELS %d", &wv.AudioChannels); strict && err != nil {
+		if _, err = fmt.Sscanf(line, "#WV-AUDIO-CHANNELS %d", &wv.AudioChannels); state.check(err, strict) {
 			return err
 		}
 		if err == nil {
@@ -760,7 +1796,7 @@ func decodeLineOfMediaPlaylist(p *MediaPlaylist, wv *WV, state *decodingState, l
 		}
 	case strings.HasPrefix(line, "#WV-AUDIO-FORMAT"):
 		state.listType = MEDIA
-		if _, err = fmt.Sscanf(line, "#WV-AUDIO-FORMAT %d", &wv.AudioFormat); strict && err != nil {
+		if _, err = fmt.Sscanf(line, "#WV-AUDIO-FORMAT %d", &wv.AudioFormat); state.check(err, strict) {
 			return err
 		}
 		if err == nil {
@@ -768,7 +1804,7 @@ func decodeLineOfMediaPlaylist(p *MediaPlaylist, wv *WV, state *decodingState, l
 		}
 	case strings.HasPrefix(line, "#WV-AUDIO-PROFILE-IDC"):
 		state.listType = MEDIA
-		if _, err = fmt.Sscanf(line, "#WV-AUDIO-PROFILE-IDC %d", &wv.AudioProfileIDC); strict && err != nil {
+		if _, err = fmt.Sscanf(line, "#WV-AUDIO-PROFILE-IDC %d", &wv.AudioProfileIDC); state.check(err, strict) {
 			return err
 		}
 		if err == nil {
@@ -776,7 +1812,7 @@ func decodeLineOfMediaPlaylist(p *MediaPlaylist, wv *WV, state *decodingState, l
 		}
 	case strings.HasPrefix(line, "#WV-AUDIO-SAMPLE-SIZE"):
 		state.listType = MEDIA
-		if _, err = fmt.Sscanf(line, "#WV-AUDIO-SAMPLE-SIZE %d", &wv.AudioSampleSize); strict && err != nil {
+		if _, err = fmt.Sscanf(line, "#WV-AUDIO-SAMPLE-SIZE %d", &wv.AudioSampleSize); state.check(err, strict) {
 			return err
 		}
 		if err == nil {
@@ -784,7 +1820,7 @@ func decodeLineOfMediaPlaylist(p *MediaPlaylist, wv *WV, state *decodingState, l
 		}
 	case strings.HasPrefix(line, "#WV-AUDIO-SAMPLING-FREQUENCY"):
 		state.listType = MEDIA
-		if _, err = fmt.Sscanf(line, "#WV-AUDIO-SAMPLING-FREQUENCY %d", &wv.AudioSamplingFrequency); strict && err != nil {
+		if _, err = fmt.Sscanf(line, "#WV-AUDIO-SAMPLING-FREQUENCY %d", &wv.AudioSamplingFrequency); state.check(err, strict) {
 			return err
 		}
 		if err == nil {
@@ -796,7 +1832,7 @@ func decodeLineOfMediaPlaylist(p *MediaPlaylist, wv *WV, state *decodingState, l
 		state.tagWV = true
 	case strings.HasPrefix(line, "#WV-ECM"):
 		state.listType = MEDIA
-		if _, err = fmt.Sscanf(line, "#WV-ECM %s", &wv.ECM); strict && err != nil {
+		if _, err = fmt.Sscanf(line, "#WV-ECM %s", &wv.ECM); state.check(err, strict) {
 			return err
 		}
 		if err == nil {
@@ -804,7 +1840,7 @@ func decodeLineOfMediaPlaylist(p *MediaPlaylist, wv *WV, state *decodingState, l
 		}
 	case strings.HasPrefix(line, "#WV-VIDEO-FORMAT"):
 		state.listType = MEDIA
-		if _, err = fmt.Sscanf(line, "#WV-VIDEO-FORMAT %d", &wv.VideoFormat); strict && err != nil {
+		if _, err = fmt.Sscanf(line, "#WV-VIDEO-FORMAT %d", &wv.VideoFormat); state.check(err, strict) {
 			return err
 		}
 		if err == nil {
@@ -812,7 +1848,7 @@ func decodeLineOfMediaPlaylist(p *MediaPlaylist, wv *WV, state *decodingState, l
 		}
 	case strings.HasPrefix(line, "#WV-VIDEO-FRAME-RATE"):
 		state.listType = MEDIA
-		if _, err = fmt.Sscanf(line, "#WV-VIDEO-FRAME-RATE %d", &wv.VideoFrameRate); strict && err != nil {
+		if _, err = fmt.Sscanf(line, "#WV-VIDEO-FRAME-RATE %d", &wv.VideoFrameRate); state.check(err, strict) {
 			return err
 		}
 		if err == nil {
@@ -820,7 +1856,7 @@ func decodeLineOfMediaPlaylist(p *MediaPlaylist, wv *WV, state *decodingState, l
 		}
 	case strings.HasPrefix(line, "#WV-VIDEO-LEVEL-IDC"):
 		state.listType = MEDIA
-		if _, err = fmt.Sscanf(line, "#WV-VIDEO-LEVEL-IDC %d", &wv.VideoLevelIDC); strict && err != nil {
+		if _, err = fmt.Sscanf(line, "#WV-VIDEO-LEVEL-IDC %d", &wv.VideoLevelIDC); state.check(err, strict) {
 			return err
 		}
 		if err == nil {
@@ -828,7 +1864,7 @@ func decodeLineOfMediaPlaylist(p *MediaPlaylist, wv *WV, state *decodingState, l
 		}
 	case strings.HasPrefix(line, "#WV-VIDEO-PROFILE-IDC"):
 		state.listType = MEDIA
-		if _, err = fmt.Sscanf(line, "#WV-VIDEO-PROFILE-IDC %d", &wv.VideoProfileIDC); strict && err != nil {
+		if _, err = fmt.Sscanf(line, "#WV-VIDEO-PROFILE-IDC %d", &wv.VideoProfileIDC); state.check(err, strict) {
 			return err
 		}
 		if err == nil {
@@ -840,14 +1876,27 @@ func decodeLineOfMediaPlaylist(p *MediaPlaylist, wv *WV, state *decodingState, l
 		state.tagWV = true
 	case strings.HasPrefix(line, "#WV-VIDEO-SAR"):
 		state.listType = MEDIA
-		if _, err = fmt.Sscanf(line, "#WV-VIDEO-SAR %s", &wv.VideoSAR); strict && err != nil {
+		if _, err = fmt.Sscanf(line, "#WV-VIDEO-SAR %s", &wv.VideoSAR); state.check(err, strict) {
 			return err
 		}
 		if err == nil {
 			state.tagWV = true
 		}
+	case strings.HasPrefix(line, "#EXTINF:"):
+		// URI of the previous segment is absent
+		state.errs = append(state.errs, ErrDuplicateTag)
+	case strings.HasPrefix(line, "#EXT-X-ALLOW-CACHE:"):
+		// removed in protocol version 7, the value is ignored
 	case strings.HasPrefix(line, "#"):
 		// comments are ignored
+		state.unknownTag = strings.HasPrefix(line, "#EXT") && !custom
+		if p.preserveUnknown && !custom {
+			if !state.segment && !state.tagInf {
+				p.UnknownTags = append(p.UnknownTags, raw)
+			} else {
+				state.unknownSegment = append(state.unknownSegment, raw)
+			}
+		}
 	}
 	return err
 }
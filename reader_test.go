@@ -14,8 +14,12 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -269,6 +273,149 @@ func TestDecodeMasterPlaylistWithIndependentSegments(t *testing.T) {
 	}
 }
 
+func TestDecodeMasterPlaylistWithSessionData(t *testing.T) {
+	f, err := os.Open("sample-playlists/master-with-session-data.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewMasterPlaylist()
+	err = p.DecodeFrom(bufio.NewReader(f), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectData := []*SessionData{
+		{DataID: "com.example.title", Value: "This is an example", Language: "en"},
+		{DataID: "com.example.title", Value: "Este es un ejemplo", Language: "es"},
+		{DataID: "com.example.lyrics", URI: "lyrics.json"},
+	}
+	if !reflect.DeepEqual(p.SessionData, expectData) {
+		t.Errorf("Session data mismatch\ngot: %+v\nexp: %+v", p.SessionData, expectData)
+	}
+	expectKeys := []*Key{
+		{Method: "SAMPLE-AES", URI: "skd://key65", Keyformat: "com.apple.streamingkeydelivery", Keyformatversions: "1"},
+	}
+	if !reflect.DeepEqual(p.SessionKeys, expectKeys) {
+		t.Errorf("Session keys mismatch\ngot: %+v\nexp: %+v", p.SessionKeys, expectKeys)
+	}
+	if len(p.Variants) != 2 {
+		t.Errorf("Expected 2 variants, got %d", len(p.Variants))
+	}
+}
+
+func TestDecodeMasterPlaylistWithInvalidSessionKey(t *testing.T) {
+	playlist := `#EXTM3U
+#EXT-X-SESSION-KEY:METHOD=NONE
+#EXT-X-STREAM-INF:BANDWIDTH=1280000
+low/video.m3u8
+`
+	p := NewMasterPlaylist()
+	if err := p.DecodeFrom(strings.NewReader(playlist), true); err == nil {
+		t.Error("Expected error on EXT-X-SESSION-KEY with METHOD=NONE in strict mode")
+	}
+}
+
+func TestDecodeMasterPlaylistWithContentSteering(t *testing.T) {
+	f, err := os.Open("sample-playlists/master-with-content-steering.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewMasterPlaylist()
+	err = p.DecodeFrom(bufio.NewReader(f), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &ContentSteering{ServerURI: "https://example.com/steering?video=00012", PathwayID: "CDN-A"}
+	if !reflect.DeepEqual(p.ContentSteering, expected) {
+		t.Errorf("Content steering mismatch\ngot: %+v\nexp: %+v", p.ContentSteering, expected)
+	}
+	if len(p.Variants) != 3 {
+		t.Fatalf("Expected 3 variants, got %d", len(p.Variants))
+	}
+	for i, exp := range []struct{ pathway, stableID string }{{"CDN-A", "low-iframe"}, {"CDN-A", "low"}, {"CDN-B", "low"}} {
+		if p.Variants[i].PathwayID != exp.pathway || p.Variants[i].StableVariantID != exp.stableID {
+			t.Errorf("Variant %d: expected PATHWAY-ID %s and STABLE-VARIANT-ID %s, got %s and %s",
+				i, exp.pathway, exp.stableID, p.Variants[i].PathwayID, p.Variants[i].StableVariantID)
+		}
+	}
+	for _, v := range p.Variants[1:] {
+		if len(v.Alternatives) != 1 || v.Alternatives[0].StableRenditionID != "audio-en" {
+			t.Errorf("Expected alternative with STABLE-RENDITION-ID for %s", v.URI)
+		}
+	}
+}
+
+func TestDecodeMasterPlaylistWithMediaAttributes(t *testing.T) {
+	f, err := os.Open("sample-playlists/master-with-media-attributes.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewMasterPlaylist()
+	if err = p.DecodeFrom(bufio.NewReader(f), true); err != nil {
+		t.Fatal(err)
+	}
+	alts := p.Variants[0].Alternatives
+	if len(alts) != 5 {
+		t.Fatalf("Expected 5 alternatives, got %d", len(alts))
+	}
+	expected := []*Alternative{
+		{Type: "AUDIO", GroupId: "atmos", Name: "English", Default: true, Autoselect: "YES", Language: "en", URI: "audio/atmos/en.m3u8",
+			Channels: &Channels{Count: 16, Spatial: []string{"JOC"}}, BitDepth: 24, SampleRate: 48000},
+		{Type: "AUDIO", GroupId: "atmos", Name: "English binaural", Autoselect: "YES", Language: "en", URI: "audio/binaural/en.m3u8",
+			Channels: &Channels{Count: 2, Usage: []string{"BINAURAL"}}},
+		{Type: "AUDIO", GroupId: "atmos", Name: "Deutsch", Autoselect: "YES", Language: "de", AssocLanguage: "de-AT", URI: "audio/stereo/de.m3u8",
+			Channels: &Channels{Count: 6}},
+		{Type: "CLOSED-CAPTIONS", GroupId: "cc", Name: "English CC", Default: true, Autoselect: "YES", Language: "en", InstreamId: "CC1"},
+		{Type: "CLOSED-CAPTIONS", GroupId: "cc", Name: "Spanish CEA-708", Autoselect: "YES", Language: "es", InstreamId: "SERVICE2"},
+	}
+	for i := range expected {
+		if !reflect.DeepEqual(alts[i], expected[i]) {
+			t.Errorf("Alternative %d mismatch\ngot: %+v\nexp: %+v", i, alts[i], expected[i])
+		}
+	}
+}
+
+func TestDecodeMasterPlaylistWithInvalidInstreamId(t *testing.T) {
+	playlist := `#EXTM3U
+#EXT-X-MEDIA:TYPE=CLOSED-CAPTIONS,GROUP-ID="cc",NAME="English",INSTREAM-ID="CC5"
+#EXT-X-STREAM-INF:BANDWIDTH=1280000,CLOSED-CAPTIONS="cc"
+low/video.m3u8
+`
+	p := NewMasterPlaylist()
+	if err := p.DecodeFrom(strings.NewReader(playlist), true); err == nil {
+		t.Error("Expected error on INSTREAM-ID=CC5 in strict mode")
+	}
+}
+
+func TestDecodeMasterPlaylistWithStreamInfV12Attributes(t *testing.T) {
+	f, err := os.Open("sample-playlists/master-with-stream-inf-v12.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewMasterPlaylist()
+	if err = p.DecodeFrom(bufio.NewReader(f), true); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Variants) != 3 {
+		t.Fatalf("Expected 3 variants, got %d", len(p.Variants))
+	}
+	expected := VariantParams{
+		ProgramId: 1, Bandwidth: 14000000, AverageBandwidth: 10000000, Score: 2.5,
+		Codecs: "hvc1.2.4.L153.B0", SupplementalCodecs: "dvh1.08.07/db4h", Resolution: "3840x2160",
+		FrameRate: 23.976, VideoRange: "HLG", HDCPLevel: "TYPE-1",
+		AllowedCPC:      "com.apple.streamingkeydelivery:AppleMain/Main,com.widevine:SW_SECURE_CRYPTO",
+		ReqVideoLayout:  "CH-STEREO,CH-MONO",
+		StableVariantID: "uhd",
+	}
+	if !reflect.DeepEqual(p.Variants[0].VariantParams, expected) {
+		t.Errorf("Variant params mismatch\ngot: %+v\nexp: %+v", p.Variants[0].VariantParams, expected)
+	}
+	iframe := p.Variants[2]
+	if !iframe.Iframe || iframe.FrameRate != 23.976 || iframe.Score != 2.5 || iframe.SupplementalCodecs != "dvh1.08.07/db4h" ||
+		iframe.AllowedCPC != "com.apple.streamingkeydelivery:AppleMain/Main" || iframe.ReqVideoLayout != "CH-STEREO" {
+		t.Errorf("I-frame variant params mismatch: %+v", iframe.VariantParams)
+	}
+}
+
 func TestDecodeMasterWithHLSV7(t *testing.T) {
 	f, err := os.Open("sample-playlists/master-with-hlsv7.m3u8")
 	if err != nil {
@@ -599,6 +746,33 @@ func TestMediaPlaylistWithOATCLSSCTE35Tag(t *testing.T) {
 	}
 }
 
+func TestSpliceInfoOfOATCLSSCTE35Tag(t *testing.T) {
+	f, err := os.Open("sample-playlists/media-playlist-with-oatcls-scte35.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _, err := DecodeFrom(bufio.NewReader(f), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pp := p.(*MediaPlaylist)
+	for i := 0; i < 2; i++ {
+		s, err := pp.Segments[i].SCTE.SpliceInfo()
+		if err != nil {
+			t.Fatalf("segment %d: %s", i, err)
+		}
+		if s.SpliceInsert == nil || !s.SpliceInsert.OutOfNetwork {
+			t.Errorf("segment %d: expected splice_insert out of network, got %+v", i, s)
+		}
+		if d, ok := s.BreakDuration(); !ok || d != pp.Segments[i].SCTE.Time {
+			t.Errorf("segment %d: break duration %v does not match %v", i, d, pp.Segments[i].SCTE.Time)
+		}
+	}
+	if _, err := pp.Segments[2].SCTE.SpliceInfo(); err == nil {
+		t.Error("expected error for cue in tag without splice_info_section")
+	}
+}
+
 func TestDecodeMediaPlaylistWithDiscontinuitySeq(t *testing.T) {
 	f, err := os.Open("sample-playlists/media-playlist-with-discontinuity-seq.m3u8")
 	if err != nil {
@@ -682,6 +856,10 @@ func TestDecodeMasterPlaylistWithCustomTags(t *testing.T) {
 
 		p, listType, err := DecodeWith(bufio.NewReader(f), true, testCase.customDecoders)
 
+		var decodeErr *DecodeError
+		if errors.As(err, &decodeErr) {
+			err = decodeErr.Err
+		}
 		if !reflect.DeepEqual(err, testCase.expectedError) {
 			t.Fatal(err)
 		}
@@ -789,6 +967,10 @@ func TestDecodeMediaPlaylistWithCustomTags(t *testing.T) {
 
 		p, listType, err := DecodeWith(bufio.NewReader(f), true, testCase.customDecoders)
 
+		var decodeErr *DecodeError
+		if errors.As(err, &decodeErr) {
+			err = decodeErr.Err
+		}
 		if !reflect.DeepEqual(err, testCase.expectedError) {
 			t.Fatal(err)
 		}
@@ -1042,6 +1224,667 @@ func TestDecodeMediaPlaylistWithCueOutCueIn(t *testing.T) {
 	}
 }
 
+// Byte ranges must not depend on the order of attributes. Attributes
+// are iterated in random order so the playlist is decoded many times.
+func TestDecodeMediaPlaylistWithByteRangesBeforeURI(t *testing.T) {
+	playlist := `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-TARGETDURATION:4
+#EXT-X-PART-INF:PART-TARGET=1
+#EXT-X-MAP:BYTERANGE="720@100",URI="init.mp4"
+#EXTINF:4.000,
+seg0.mp4
+#EXT-X-PART:BYTERANGE=20000,DURATION=1,URI="seg1.mp4"
+#EXT-X-PART:BYTERANGE=23000,DURATION=1,URI="seg1.mp4"
+#EXT-X-PART:BYTERANGE=1000,URI="seg2.mp4",DURATION=1
+`
+	expected := []*PartialSegment{
+		{URI: "seg1.mp4", Duration: 1, Limit: 20000},
+		{URI: "seg1.mp4", Duration: 1, Limit: 23000, Offset: 20000},
+		{URI: "seg2.mp4", Duration: 1, Limit: 1000},
+	}
+	for i := 0; i < 50; i++ {
+		p, _ := NewMediaPlaylist(3, 3)
+		if err := p.DecodeFrom(bytes.NewBufferString(playlist), true); err != nil {
+			t.Fatal(err)
+		}
+		if p.Map == nil || *p.Map != (Map{URI: "init.mp4", Limit: 720, Offset: 100}) {
+			t.Fatalf("Unexpected map: %+v", p.Map)
+		}
+		if !reflect.DeepEqual(p.PendingParts, expected) {
+			t.Fatalf("Pending parts\nexp: %+v\ngot: %+v", expected, p.PendingParts)
+		}
+	}
+}
+
+func TestDecodeMediaPlaylistWithPartialSegments(t *testing.T) {
+	f, err := os.Open("sample-playlists/media-playlist-low-latency.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, listType, err := DecodeFrom(bufio.NewReader(f), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pp := p.(*MediaPlaylist)
+	CheckType(t, pp)
+	if listType != MEDIA {
+		t.Error("Sample not recognized as media playlist.")
+	}
+	expectedControl := &ServerControl{CanBlockReload: true, CanSkipUntil: 24, PartHoldBack: 3.012}
+	if !reflect.DeepEqual(pp.ServerControl, expectedControl) {
+		t.Errorf("Server control of parsed playlist\nexp: %+v\ngot: %+v", expectedControl, pp.ServerControl)
+	}
+	if pp.PartTargetDuration != 1.00008 {
+		t.Errorf("PartTargetDuration of parsed playlist = %f (must = 1.00008)", pp.PartTargetDuration)
+	}
+	if pp.Count() != 2 {
+		t.Fatalf("Excepted segments quantity: 2, got: %v", pp.Count())
+	}
+	if len(pp.Segments[0].Parts) != 0 {
+		t.Errorf("Excepted no parts for the 1st segment, got: %v", len(pp.Segments[0].Parts))
+	}
+	expected := []*PartialSegment{
+		{URI: "filePart267.0.mp4", Duration: 1.00008, Independent: true},
+		{URI: "filePart267.1.mp4", Duration: 1.00008},
+		{URI: "filePart267.2.mp4", Duration: 1.00008, Gap: true},
+		{URI: "filePart267.3.mp4", Duration: 1.00008},
+	}
+	if !reflect.DeepEqual(pp.Segments[1].Parts, expected) {
+		t.Errorf("Parts of the 2nd segment\nexp: %+v\ngot: %+v", expected, pp.Segments[1].Parts)
+	}
+	expected = []*PartialSegment{
+		{URI: "fileSequence268.mp4", Duration: 1.00008, Independent: true, Limit: 20000},
+		{URI: "fileSequence268.mp4", Duration: 1.00008, Limit: 23000, Offset: 20000},
+	}
+	if !reflect.DeepEqual(pp.PendingParts, expected) {
+		t.Errorf("Pending parts\nexp: %+v\ngot: %+v", expected, pp.PendingParts)
+	}
+	expectedHints := []*PreloadHint{
+		{Type: "PART", URI: "fileSequence268.mp4", Offset: 43000},
+	}
+	if !reflect.DeepEqual(pp.PreloadHints, expectedHints) {
+		t.Errorf("Preload hints\nexp: %+v\ngot: %+v", expectedHints, pp.PreloadHints)
+	}
+	lastPart := int64(1)
+	expectedReports := []*RenditionReport{
+		{URI: "../1M/waitForMSN.php", LastMSN: 267, LastPart: &lastPart},
+		{URI: "../4M/waitForMSN.php", LastMSN: 267},
+	}
+	if !reflect.DeepEqual(pp.RenditionReports, expectedReports) {
+		t.Errorf("Rendition reports\nexp: %+v\ngot: %+v", expectedReports, pp.RenditionReports)
+	}
+}
+
+// Attributes of preload hints are iterated in random order so the
+// playlist is decoded many times.
+func TestDecodeMediaPlaylistWithPreloadHintByteRangeBeforeURI(t *testing.T) {
+	playlist := `#EXTM3U
+#EXT-X-VERSION:9
+#EXT-X-TARGETDURATION:4
+#EXT-X-PART-INF:PART-TARGET=1
+#EXTINF:4.000,
+seg0.mp4
+#EXT-X-PRELOAD-HINT:BYTERANGE-START=1024,BYTERANGE-LENGTH=2048,TYPE=PART,URI="seg1.mp4"
+#EXT-X-PRELOAD-HINT:BYTERANGE-START=0,URI="init.mp4",TYPE=MAP
+`
+	expected := []*PreloadHint{
+		{Type: "PART", URI: "seg1.mp4", Offset: 1024, Limit: 2048},
+		{Type: "MAP", URI: "init.mp4"},
+	}
+	for i := 0; i < 50; i++ {
+		p, _ := NewMediaPlaylist(3, 3)
+		if err := p.DecodeFrom(bytes.NewBufferString(playlist), true); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(p.PreloadHints, expected) {
+			t.Fatalf("Preload hints\nexp: %+v\ngot: %+v", expected, p.PreloadHints)
+		}
+	}
+}
+
+func TestDecodeMediaPlaylistDeltaUpdate(t *testing.T) {
+	full := `#EXTM3U
+#EXT-X-VERSION:6
+#EXT-X-TARGETDURATION:4
+#EXT-X-MEDIA-SEQUENCE:100
+#EXT-X-PROGRAM-DATE-TIME:2020-01-01T00:00:00Z
+#EXTINF:4.000,
+fileSequence100.mp4
+#EXT-X-DATERANGE:ID="ad1",START-DATE="2020-01-01T00:00:04Z",DURATION=4
+#EXTINF:4.000,
+fileSequence101.mp4
+#EXTINF:4.000,
+fileSequence102.mp4
+#EXT-X-DATERANGE:ID="ad3",START-DATE="2020-01-01T00:00:12Z",DURATION=8
+#EXTINF:4.000,
+fileSequence103.mp4
+#EXTINF:4.000,
+fileSequence104.mp4
+#EXT-X-DATERANGE:ID="ad4",START-DATE="2020-01-01T00:00:20Z",DURATION=4
+#EXTINF:4.000,
+fileSequence105.mp4
+`
+	p, _, err := DecodeFrom(strings.NewReader(full), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pp := p.(*MediaPlaylist)
+
+	f, err := os.Open("sample-playlists/media-playlist-delta-update.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, _, err := DecodeFrom(bufio.NewReader(f), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delta := d.(*MediaPlaylist)
+	expected := &Skip{SkippedSegments: 3, RecentlyRemovedDateRanges: []string{"ad1", "ad2"}, SkippedDateRanges: true}
+	if !reflect.DeepEqual(delta.Skip, expected) {
+		t.Errorf("Skip of parsed playlist\nexp: %+v\ngot: %+v", expected, delta.Skip)
+	}
+	if delta.Count() != 4 || delta.Segments[0].SeqId != 104 {
+		t.Fatalf("Excepted 4 segments starting from SeqId 104, got: %v/%v", delta.Count(), delta.Segments[0].SeqId)
+	}
+
+	if err = pp.ApplyDelta(delta); err != nil {
+		t.Fatal(err)
+	}
+	if pp.Skip != nil {
+		t.Error("Merged playlist must not be a delta update")
+	}
+	if pp.Version() != 6 {
+		t.Errorf("Excepted version of merged playlist: 6, got: %v", pp.Version())
+	}
+	if pp.SeqNo != 101 {
+		t.Errorf("Excepted SeqNo of merged playlist: 101, got: %v", pp.SeqNo)
+	}
+	if pp.ServerControl == nil || pp.ServerControl.CanSkipUntil != 12 {
+		t.Errorf("Header of merged playlist must be taken from the delta update, got: %+v", pp.ServerControl)
+	}
+	segments := pp.GetAllSegments()
+	if len(segments) != 7 {
+		t.Fatalf("Excepted segments in merged playlist: 7, got: %v", len(segments))
+	}
+	// date ranges keep their positions, recently removed are dropped
+	for i, id := range []string{"", "", "ad3", "", "ad4", "", ""} {
+		var ids []string
+		for _, dr := range segments[i].DateRanges {
+			ids = append(ids, dr.ID)
+		}
+		if strings.Join(ids, " ") != id {
+			t.Errorf("Excepted date ranges %q before segment %d, got: %v", id, i, ids)
+		}
+	}
+	for i, seg := range segments {
+		seqId := uint64(101 + i)
+		if seg.SeqId != seqId || seg.URI != fmt.Sprintf("fileSequence%d.mp4", seqId) {
+			t.Errorf("Excepted segment %d with SeqId %d, got: %v/%v", i, seqId, seg.URI, seg.SeqId)
+		}
+	}
+
+	empty, _ := NewMediaPlaylist(3, 3)
+	if err = empty.ApplyDelta(delta); err == nil {
+		t.Error("Expected error on missing skipped segments")
+	}
+}
+
+func TestDecodeMediaPlaylistWithDateRange(t *testing.T) {
+	f, err := os.Open("sample-playlists/media-playlist-with-daterange.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, listType, err := DecodeFrom(bufio.NewReader(f), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pp := p.(*MediaPlaylist)
+	CheckType(t, pp)
+	if listType != MEDIA {
+		t.Error("Sample not recognized as media playlist.")
+	}
+	dateRanges := pp.Segments[0].DateRanges
+	if len(dateRanges) != 3 {
+		t.Fatalf("Excepted date ranges: 3, got: %v", len(dateRanges))
+	}
+	if len(pp.Segments[1].DateRanges) != 0 || len(pp.DateRanges) != 0 {
+		t.Error("Date ranges must be linked to the segment that follows them")
+	}
+	start, _ := time.Parse(time.RFC3339, "2014-03-05T11:15:00Z")
+	out := dateRanges[0]
+	if out.ID != "splice-6FFFFFF0" || !out.StartDate.Equal(start) || out.PlannedDuration != 59.993 || !strings.HasPrefix(out.SCTE35Out, "0xFC002F") {
+		t.Errorf("Wrong SCTE35-OUT date range: %+v", out)
+	}
+	if out.Duration != nil {
+		t.Errorf("Excepted absent DURATION, got: %v", *out.Duration)
+	}
+	in := dateRanges[1]
+	if in.Duration == nil || *in.Duration != 59.993 || !in.EndDate.Equal(start.Add(59993*time.Millisecond)) || !strings.HasPrefix(in.SCTE35In, "0xFC002A") {
+		t.Errorf("Wrong SCTE35-IN date range: %+v", in)
+	}
+	expected := map[string]string{
+		"X-AD-ID":             `"ad,42"`,
+		"X-COM-EXAMPLE-SCORE": "0.75",
+		"X-COM-EXAMPLE-DATA":  "0xABCD",
+	}
+	next := dateRanges[2]
+	if next.Class != "com.example.ad" || !next.EndOnNext || !reflect.DeepEqual(next.X, expected) {
+		t.Errorf("Wrong date range with client attributes: %+v", next)
+	}
+}
+
+func TestDecodeMediaPlaylistWithInvalidDateRange(t *testing.T) {
+	playlist := `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-DATERANGE:ID="nmc-1",START-DATE="2014-03-05T11:14:30Z",END-ON-NEXT=YES
+#EXTINF:10.0,
+segment0.ts
+`
+	p, _ := NewMediaPlaylist(1, 1)
+	if err := p.DecodeFrom(strings.NewReader(playlist), true); err == nil {
+		t.Error("Expected error on END-ON-NEXT without CLASS in strict mode")
+	}
+	p, _ = NewMediaPlaylist(1, 1)
+	if err := p.DecodeFrom(strings.NewReader(playlist), false); err != nil {
+		t.Errorf("Unexpected error in non-strict mode: %s", err)
+	}
+	if len(p.Segments[0].DateRanges) != 1 {
+		t.Errorf("Excepted date ranges: 1, got: %v", len(p.Segments[0].DateRanges))
+	}
+}
+
+func TestDecodeMediaPlaylistWithGapAndBitrate(t *testing.T) {
+	f, err := os.Open("sample-playlists/media-playlist-with-gap-and-bitrate.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := NewMediaPlaylist(5, 5)
+	if err = p.DecodeFrom(bufio.NewReader(f), true); err != nil {
+		t.Fatal(err)
+	}
+	expectGap := []bool{false, false, true, false, false}
+	// EXT-X-BITRATE is inherited by following segments except ones with EXT-X-BYTERANGE
+	expectBitrate := []int64{1500, 1500, 1500, 0, 2100}
+	for i, seg := range p.GetAllSegments() {
+		if seg.Gap != expectGap[i] {
+			t.Errorf("Segment %d: expected gap %v, got %v", i, expectGap[i], seg.Gap)
+		}
+		if seg.Bitrate != expectBitrate[i] {
+			t.Errorf("Segment %d: expected bitrate %d, got %d", i, expectBitrate[i], seg.Bitrate)
+		}
+	}
+}
+
+func TestDecodeMasterPlaylistWithDefine(t *testing.T) {
+	f, err := os.Open("sample-playlists/master-with-define.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewMasterPlaylist()
+	p.SetQueryParams(url.Values{"token": {"abc"}})
+	if err = p.DecodeFrom(bufio.NewReader(f), true); err != nil {
+		t.Fatal(err)
+	}
+	expectDefines := []*Define{
+		{Name: "host", Value: "https://cdn.example.com", Type: DefineValue},
+		{Name: "token", Value: "abc", Type: DefineQueryParam},
+	}
+	if !reflect.DeepEqual(p.Defines, expectDefines) {
+		t.Errorf("Defines mismatch\ngot: %+v\nexp: %+v", p.Defines, expectDefines)
+	}
+	if p.Variants[0].URI != "https://cdn.example.com/low/video.m3u8?token=abc" {
+		t.Errorf("Variant URI is not expanded: %s", p.Variants[0].URI)
+	}
+	if p.Variants[1].Alternatives[0].URI != "https://cdn.example.com/audio/en.m3u8?token=abc" {
+		t.Errorf("Alternative URI is not expanded: %s", p.Variants[1].Alternatives[0].URI)
+	}
+}
+
+func TestDecodeMediaPlaylistWithDefine(t *testing.T) {
+	master := NewMasterPlaylist()
+	if err := master.AppendDefine(&Define{Name: "host", Value: "https://cdn.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open("sample-playlists/media-playlist-with-define.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := NewMediaPlaylist(2, 2)
+	p.ImportVariables(master.Variables())
+	if err = p.DecodeFrom(bufio.NewReader(f), true); err != nil {
+		t.Fatal(err)
+	}
+	if p.Map == nil || p.Map.URI != "https://cdn.example.com/low/segments/init.mp4" {
+		t.Errorf("Map URI is not expanded: %+v", p.Map)
+	}
+	for i, seg := range p.GetAllSegments() {
+		expected := fmt.Sprintf("https://cdn.example.com/low/segments/segment%d.mp4", i)
+		if seg.URI != expected {
+			t.Errorf("Segment %d: expected URI %s, got %s", i, expected, seg.URI)
+		}
+	}
+
+	// unresolved import is an error only in strict mode
+	f.Seek(0, io.SeekStart)
+	p, _ = NewMediaPlaylist(2, 2)
+	if err = p.DecodeFrom(bufio.NewReader(f), true); err == nil {
+		t.Error("Expected error on undefined variable in strict mode")
+	}
+	f.Seek(0, io.SeekStart)
+	p, _ = NewMediaPlaylist(2, 2)
+	if err = p.DecodeFrom(bufio.NewReader(f), false); err != nil {
+		t.Fatal(err)
+	}
+	if p.Segments[0].URI != "{$host}/low/segments/segment0.mp4" {
+		t.Errorf("Expected undefined reference to be kept, got %s", p.Segments[0].URI)
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	playlist := "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:10,\nseg0.ts\n#EXT-X-BYTERANGE:1000@abc\r\n#EXTINF:10,\nseg1.ts\n"
+	p, _ := NewMediaPlaylist(2, 2)
+	err := p.DecodeFrom(strings.NewReader(playlist), true)
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("Expected DecodeError, got %v", err)
+	}
+	if decodeErr.Line != 5 || decodeErr.Raw != "#EXT-X-BYTERANGE:1000@abc" || decodeErr.Tag != "#EXT-X-BYTERANGE" || decodeErr.Err == nil {
+		t.Errorf("Unexpected error: %+v", decodeErr)
+	}
+	expected := "line 5: #EXT-X-BYTERANGE: " + decodeErr.Err.Error()
+	if err.Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, err.Error())
+	}
+
+	// the same error from the generic decoder
+	_, _, err = DecodeFrom(strings.NewReader(playlist), true)
+	if !errors.As(err, &decodeErr) || decodeErr.Line != 5 {
+		t.Errorf("Expected DecodeError at line 5, got %v", err)
+	}
+
+	// errors of master playlists
+	m := NewMasterPlaylist()
+	err = m.DecodeFrom(strings.NewReader("#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=x\nlow.m3u8\n"), true)
+	if !errors.As(err, &decodeErr) || decodeErr.Line != 2 || decodeErr.Tag != "#EXT-X-STREAM-INF" {
+		t.Errorf("Expected DecodeError of EXT-X-STREAM-INF at line 2, got %v", err)
+	}
+}
+
+func TestDecodeLenientMediaPlaylist(t *testing.T) {
+	f, err := os.Open("sample-playlists/media-playlist-damaged.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, listType, problems, err := DecodeLenient(bufio.NewReader(f), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if listType != MEDIA {
+		t.Fatalf("Expected media playlist, got %v", listType)
+	}
+	if count := p.(*MediaPlaylist).Count(); count != 3 {
+		t.Errorf("Expected 3 segments, got %d", count)
+	}
+	expected := []struct {
+		line int
+		tag  string
+		err  error
+	}{
+		{5, "#EXT-X-PACKAGER-DEBUG", ErrUnknownTag},
+		{9, "", ErrOrphanURI},
+		{10, "#EXT-X-TARGETDURATION", ErrDuplicateTag},
+		{11, "#EXT-X-BYTERANGE", nil},
+		{15, "#EXTINF", ErrDuplicateTag},
+	}
+	if len(problems) != len(expected) {
+		t.Fatalf("Expected %d problems, got %d: %v", len(expected), len(problems), problems)
+	}
+	for i, e := range expected {
+		problem := problems[i]
+		if problem.Line != e.line || problem.Tag != e.tag {
+			t.Errorf("Expected problem of %s at line %d, got %v", e.tag, e.line, problem)
+		}
+		if e.err != nil && !errors.Is(problem, e.err) {
+			t.Errorf("Expected %v, got %v", e.err, problem.Err)
+		}
+	}
+
+	// the same problems are recovered by decoder of media playlist
+	f.Seek(0, io.SeekStart)
+	pp, _ := NewMediaPlaylist(1, 1)
+	if problems, err = pp.DecodeLenient(bufio.NewReader(f)); err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != len(expected) {
+		t.Errorf("Expected %d problems, got %d: %v", len(expected), len(problems), problems)
+	}
+}
+
+func TestDecodeLenientStartTimeOffset(t *testing.T) {
+	playlist := "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXT-X-START:TIME-OFFSET=abc\n#EXTINF:10,\nseg0.ts\n"
+	p, _ := NewMediaPlaylist(1, 1)
+	problems, err := p.DecodeLenient(strings.NewReader(playlist))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 || problems[0].Line != 3 || problems[0].Tag != "#EXT-X-START" {
+		t.Fatalf("Expected problem of EXT-X-START at line 3, got %v", problems)
+	}
+	if p.Count() != 1 {
+		t.Errorf("Expected 1 segment, got %d", p.Count())
+	}
+	if err = p.DecodeFrom(strings.NewReader(playlist), true); err == nil {
+		t.Error("Expected error of invalid TIME-OFFSET in strict mode")
+	}
+}
+
+func TestDecodeLenientMasterPlaylist(t *testing.T) {
+	playlist := `#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=300000
+#EXT-X-STREAM-INF:BANDWIDTH=600000
+chunklist-b300000.m3u8
+orphan.m3u8
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=MAYBE
+`
+	p := NewMasterPlaylist()
+	problems, err := p.DecodeLenient(strings.NewReader(playlist))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Variants) != 1 {
+		t.Errorf("Expected 1 variant, got %d", len(p.Variants))
+	}
+	if len(problems) != 3 {
+		t.Fatalf("Expected 3 problems, got %d: %v", len(problems), problems)
+	}
+	if problems[0].Line != 3 || !errors.Is(problems[0], ErrDuplicateTag) {
+		t.Errorf("Unexpected problem: %v", problems[0])
+	}
+	if problems[1].Line != 5 || !errors.Is(problems[1], ErrOrphanURI) {
+		t.Errorf("Unexpected problem: %v", problems[1])
+	}
+	if problems[2].Line != 6 || problems[2].Tag != "#EXT-X-MEDIA" {
+		t.Errorf("Unexpected problem: %v", problems[2])
+	}
+
+	// valid playlists have no problems
+	f, err := os.Open("sample-playlists/master.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, problems, err = DecodeLenient(bufio.NewReader(f), nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("Expected no problems, got %v", problems)
+	}
+}
+
+func TestDecodeMediaPlaylistWithUnknownTags(t *testing.T) {
+	data, err := ioutil.ReadFile("sample-playlists/media-playlist-with-unknown-tags.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := NewMediaPlaylist(3, 3)
+	p.PreserveUnknownTags(true)
+	if err = p.DecodeFrom(bytes.NewReader(data), true); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p.UnknownTags, []string{"#EXT-X-TWITCH-ELAPSED-SECS:600.000", "# generated by the packager"}) {
+		t.Errorf("Unexpected header tags: %v", p.UnknownTags)
+	}
+	if p.Segments[0].UnknownTags != nil {
+		t.Errorf("Unexpected tags of the first segment: %v", p.Segments[0].UnknownTags)
+	}
+	if !reflect.DeepEqual(p.Segments[1].UnknownTags, []string{"#EXT-X-ASSET:CAID=0x0000000020FB6501"}) {
+		t.Errorf("Unexpected tags of the second segment: %v", p.Segments[1].UnknownTags)
+	}
+	if !reflect.DeepEqual(p.TrailingTags, []string{"#EXT-X-TWITCH-PREFETCH:https://example.com/segment102.ts"}) {
+		t.Errorf("Unexpected trailing tags: %v", p.TrailingTags)
+	}
+	if p.String() != string(data) {
+		t.Errorf("Encoded playlist differs from the source:\n%s", p)
+	}
+
+	// unknown tags are dropped by default
+	p, _ = NewMediaPlaylist(3, 3)
+	if err = p.DecodeFrom(bytes.NewReader(data), true); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(p.String(), "TWITCH") || strings.Contains(p.String(), "#EXT-X-ASSET") {
+		t.Errorf("Unexpected unknown tags in the playlist:\n%s", p)
+	}
+}
+
+func TestDecodeMasterPlaylistWithUnknownTags(t *testing.T) {
+	data, err := ioutil.ReadFile("sample-playlists/master-with-unknown-tags.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewMasterPlaylist()
+	p.PreserveUnknownTags(true)
+	if err = p.DecodeFrom(bytes.NewReader(data), true); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p.UnknownTags, []string{"# master comment", "#EXT-X-VENDOR-INFO:ID=42"}) {
+		t.Errorf("Unexpected header tags: %v", p.UnknownTags)
+	}
+	if !reflect.DeepEqual(p.Variants[0].UnknownTags, []string{"#EXT-X-VENDOR-VARIANT:low"}) {
+		t.Errorf("Unexpected tags of the first variant: %v", p.Variants[0].UnknownTags)
+	}
+	if !reflect.DeepEqual(p.Variants[1].UnknownTags, []string{"# high"}) {
+		t.Errorf("Unexpected tags of the second variant: %v", p.Variants[1].UnknownTags)
+	}
+	if !reflect.DeepEqual(p.TrailingTags, []string{"#EXT-X-VENDOR-END"}) {
+		t.Errorf("Unexpected trailing tags: %v", p.TrailingTags)
+	}
+	if p.String() != string(data) {
+		t.Errorf("Encoded playlist differs from the source:\n%s", p)
+	}
+}
+
+func TestApplyDeltaOfEncodedDeltaUpdate(t *testing.T) {
+	p, _ := NewMediaPlaylist(0, 10)
+	p.ServerControl = &ServerControl{CanSkipUntil: 8, CanSkipDateRanges: true}
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 6; i++ {
+		if i == 1 {
+			p.AppendDateRange(&DateRange{ID: "ad", StartDate: start.Add(4 * time.Second)})
+		}
+		p.Append(fmt.Sprintf("test%d.ts", i), 4.0, "")
+	}
+	full, _, err := DecodeFrom(strings.NewReader(p.String()), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := p.Delta(8, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, _, err := DecodeFrom(strings.NewReader(d.String()), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delta := decoded.(*MediaPlaylist)
+	if delta.Skip == nil || !delta.Skip.SkippedDateRanges {
+		t.Fatalf("Expected skipped date ranges of the delta update:\n%s", d)
+	}
+	merged := full.(*MediaPlaylist)
+	if err = merged.ApplyDelta(delta); err != nil {
+		t.Fatal(err)
+	}
+	segments := merged.GetAllSegments()
+	if len(segments) != 6 || len(segments[1].DateRanges) != 1 || segments[1].DateRanges[0].ID != "ad" {
+		t.Errorf("Expected date range kept before segment 1:\n%s", merged)
+	}
+}
+
+func TestDecodeFromReturnsPartialPlaylistOnError(t *testing.T) {
+	f, err := os.Open("sample-playlists/master-with-i-frame-stream-inf.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	p, listType, err := DecodeFrom(bufio.NewReader(f), true)
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) || decodeErr.Line != 13 {
+		t.Fatalf("Expected decode error at line 13, got %v", err)
+	}
+	master, ok := p.(*MasterPlaylist)
+	if listType != MASTER || !ok || master == nil {
+		t.Fatalf("Expected partly decoded master playlist, got %v", p)
+	}
+	if len(master.Variants) != 8 {
+		t.Errorf("Expected 8 variants decoded up to the error, got %d", len(master.Variants))
+	}
+
+	media, listType, err := DecodeFrom(strings.NewReader("#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:10,\nseg0.ts\n#EXTINF:x,\nseg1.ts\n"), true)
+	if err == nil || listType != MEDIA || media == nil || media.(*MediaPlaylist).Count() != 1 {
+		t.Errorf("Expected partly decoded media playlist with the error, got %v, %v", media, err)
+	}
+}
+
+func TestDetectListType(t *testing.T) {
+	for _, c := range []struct {
+		playlist string
+		expected ListType
+	}{
+		{"#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-STREAM-INF:BANDWIDTH=300000\nchunklist.m3u8\n", MASTER},
+		{"#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-MEDIA-SEQUENCE:1\n#EXT-X-MEDIA:TYPE=AUDIO\n", MEDIA},
+		{"#EXTM3U\r\n  #EXTINF:10,\r\nsegment.ts\r\n", MEDIA},
+		{"#EXTM3U\n#EXT-X-VERSION:3\n", MEDIA},
+		{"#EXTM3U\n#WV-CYPHER-VERSION:5\n#EXT-X-STREAM-INF:BANDWIDTH=300000\nchunklist.m3u8\n", MASTER},
+		{"#EXTM3U\n#EXT-X-UNKNOWN\n", 0},
+		{"", 0},
+	} {
+		if listType := detectListType(c.playlist); listType != c.expected {
+			t.Errorf("Expected type %d of %q, got %d", c.expected, c.playlist, listType)
+		}
+	}
+	if _, _, err := DecodeFrom(strings.NewReader("#EXTM3U\n#EXT-X-UNKNOWN\n"), false); err == nil {
+		t.Error("Expected error of unknown playlist type")
+	}
+}
+
+func TestDetectWidevineMasterPlaylist(t *testing.T) {
+	f, err := os.Open("sample-playlists/widevine-master.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	p, listType, err := DecodeFrom(bufio.NewReader(f), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if listType != MASTER {
+		t.Fatalf("Expected master playlist, got %d", listType)
+	}
+	if n := len(p.(*MasterPlaylist).Variants); n != 3 {
+		t.Errorf("Expected 3 variants, got %d", n)
+	}
+}
+
 /****************
  *  Benchmarks  *
  ****************/
@@ -1074,3 +1917,31 @@ func BenchmarkDecodeMediaPlaylist(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkDecodeDetectedMasterPlaylist(b *testing.B) {
+	data, err := ioutil.ReadFile("sample-playlists/master.m3u8")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := DecodeFrom(bytes.NewReader(data), false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeDetectedMediaPlaylist(b *testing.B) {
+	data, err := ioutil.ReadFile("sample-playlists/media-playlist-large.m3u8")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := DecodeFrom(bytes.NewReader(data), true); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package scte35
+
+/*
+ Part of M3U8 parser & generator library.
+ This file defines bit level reader and writer of SCTE-35 sections.
+
+ Copyright 2013-2019 The Project Developers.
+ See the AUTHORS and LICENSE files at the top-level directory of this distribution
+ and at https://github.com/grafov/m3u8/
+
+ ॐ तारे तुत्तारे तुरे स्व
+*/
+
+// bitReader reads big-endian bit fields from the byte slice.
+type bitReader struct {
+	data []byte
+	pos  uint // position in bits
+	err  error
+}
+
+// read returns next n bits (n <= 64). After the end of data it
+// returns zeroes and keeps ErrShortSection in err.
+func (r *bitReader) read(n uint) uint64 {
+	if r.err != nil {
+		return 0
+	}
+	if r.pos+n > uint(len(r.data))*8 {
+		r.err = ErrShortSection
+		return 0
+	}
+	var v uint64
+	for i := uint(0); i < n; i++ {
+		b := r.data[(r.pos+i)/8] >> (7 - (r.pos+i)%8) & 1
+		v = v<<1 | uint64(b)
+	}
+	r.pos += n
+	return v
+}
+
+func (r *bitReader) flag() bool {
+	return r.read(1) == 1
+}
+
+// bytes returns next n bytes, the reader must be aligned to byte.
+func (r *bitReader) bytes(n uint) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if r.pos%8 != 0 || r.pos/8+n > uint(len(r.data)) {
+		r.err = ErrShortSection
+		return nil
+	}
+	b := make([]byte, n)
+	copy(b, r.data[r.pos/8:])
+	r.pos += n * 8
+	return b
+}
+
+// left returns the number of unread bytes.
+func (r *bitReader) left() uint {
+	return uint(len(r.data)) - (r.pos+7)/8
+}
+
+// bitWriter writes big-endian bit fields to the byte slice.
+type bitWriter struct {
+	data []byte
+	n    uint // number of bits written
+}
+
+func (w *bitWriter) write(n uint, v uint64) {
+	for i := n; i > 0; i-- {
+		if w.n%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+		if v>>(i-1)&1 == 1 {
+			w.data[w.n/8] |= 1 << (7 - w.n%8)
+		}
+		w.n++
+	}
+}
+
+func (w *bitWriter) flag(b bool) {
+	if b {
+		w.write(1, 1)
+	} else {
+		w.write(1, 0)
+	}
+}
+
+// reserved writes n bits set to 1 as required for reserved fields.
+func (w *bitWriter) reserved(n uint) {
+	w.write(n, 1<<n-1)
+}
+
+func (w *bitWriter) bytes(b []byte) {
+	for _, v := range b {
+		w.write(8, uint64(v))
+	}
+}
+
+// crc32 calculates CRC of MPEG-2 sections (polynomial 0x04C11DB7
+// without reflection).
+func crc32(data []byte) uint32 {
+	crc := uint32(0xffffffff)
+	for _, b := range data {
+		crc ^= uint32(b) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
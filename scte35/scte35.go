@@ -0,0 +1,625 @@
+// Package scte35 decodes and encodes SCTE-35 splice_info_section
+// carried by cue tags of HLS playlists (EXT-OATCLS-SCTE35,
+// EXT-X-CUE-OUT-CONT, EXT-X-DATERANGE and others).
+//
+// Library coded accordingly with ANSI/SCTE 35 Digital Program Insertion
+// Cueing Message. Splice commands splice_insert and time_signal and
+// segmentation descriptors are decoded into structures, other commands
+// and descriptors are kept as raw bytes so the section may be encoded
+// back without losses.
+package scte35
+
+/*
+ Part of M3U8 parser & generator library.
+ This file defines SCTE-35 structures and their decoding and encoding.
+
+ Copyright 2013-2019 The Project Developers.
+ See the AUTHORS and LICENSE files at the top-level directory of this distribution
+ and at https://github.com/grafov/m3u8/
+
+ ॐ तारे तुत्तारे तुरे स्व
+*/
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TicksPerSecond is the frequency of 90 kHz clock used for PTS and
+// durations in SCTE-35 sections.
+const TicksPerSecond = 90000
+
+// TableID is the only table_id of splice_info_section.
+const TableID = 0xfc
+
+// Splice command types (splice_command_type).
+const (
+	SpliceNull           uint8 = 0x00
+	SpliceSchedule       uint8 = 0x04
+	SpliceInsertCommand  uint8 = 0x05
+	TimeSignal           uint8 = 0x06
+	BandwidthReservation uint8 = 0x07
+	PrivateCommand       uint8 = 0xff
+)
+
+// Splice descriptor tags (splice_descriptor_tag).
+const (
+	AvailDescriptor        uint8 = 0x00
+	DTMFDescriptor         uint8 = 0x01
+	SegmentationDescriptor uint8 = 0x02
+	TimeDescriptor         uint8 = 0x03
+	AudioDescriptor        uint8 = 0x04
+)
+
+// CUEIdentifier is the identifier of descriptors defined by SCTE-35
+// (ASCII "CUEI").
+const CUEIdentifier = 0x43554549
+
+var (
+	// ErrShortSection returned when the section ends before all fields are read.
+	ErrShortSection = errors.New("scte35: section is too short")
+	// ErrInvalidCRC returned when CRC_32 of the section does not match its data.
+	ErrInvalidCRC = errors.New("scte35: CRC_32 mismatch")
+)
+
+// SpliceInfoSection structure represents splice_info_section of
+// SCTE-35. Encrypted sections are not decrypted, their splice command
+// and descriptors are kept in Encrypted as is.
+type SpliceInfoSection struct {
+	SAPType             uint8 // sap_type, 3 means not specified
+	ProtocolVersion     uint8
+	EncryptedPacket     bool
+	EncryptionAlgorithm uint8
+	PTSAdjustment       uint64 // pts_adjustment in 90 kHz ticks
+	CWIndex             uint8
+	Tier                uint16
+	CommandType         uint8         // splice_command_type
+	SpliceInsert        *SpliceInsert // splice_insert() for SpliceInsertCommand
+	TimeSignal          *SpliceTime   // splice_time() of time_signal() for TimeSignal
+	Command             []byte        // raw bytes of other splice commands
+	Descriptors         []*SpliceDescriptor
+	Encrypted           []byte // splice_command_length and the rest of encrypted section up to CRC_32
+}
+
+// SpliceTime structure represents splice_time() of splice commands.
+type SpliceTime struct {
+	TimeSpecified bool
+	PTSTime       uint64 // pts_time in 90 kHz ticks
+}
+
+// BreakDuration structure represents break_duration() of splice_insert.
+type BreakDuration struct {
+	AutoReturn bool
+	Duration   uint64 // duration in 90 kHz ticks
+}
+
+// SpliceInsert structure represents splice_insert() command.
+type SpliceInsert struct {
+	EventID         uint32
+	EventCancel     bool
+	OutOfNetwork    bool
+	ProgramSplice   bool
+	SpliceImmediate bool
+	SpliceTime      *SpliceTime // only for program splice mode without splice_immediate_flag
+	Components      []*SpliceInsertComponent
+	BreakDuration   *BreakDuration // nil if duration_flag is not set
+	UniqueProgramID uint16
+	AvailNum        uint8
+	AvailsExpected  uint8
+}
+
+// SpliceInsertComponent structure represents component of
+// splice_insert() in component splice mode.
+type SpliceInsertComponent struct {
+	Tag        uint8
+	SpliceTime *SpliceTime // nil if splice_immediate_flag is set
+}
+
+// SpliceDescriptor structure represents splice_descriptor() of the
+// section. Segmentation descriptors are decoded, private bytes of
+// other descriptors are kept in Data.
+type SpliceDescriptor struct {
+	Tag          uint8
+	Identifier   uint32
+	Segmentation *Segmentation // segmentation_descriptor() for SegmentationDescriptor tag
+	Data         []byte
+}
+
+// Segmentation structure represents segmentation_descriptor().
+type Segmentation struct {
+	EventID               uint32
+	EventCancel           bool
+	EventIDCompliance     bool
+	ProgramSegmentation   bool
+	DeliveryNotRestricted bool
+	WebDeliveryAllowed    bool
+	NoRegionalBlackout    bool
+	ArchiveAllowed        bool
+	DeviceRestrictions    uint8
+	Components            []*SegmentationComponent
+	DurationFlag          bool
+	Duration              uint64 // segmentation_duration in 90 kHz ticks
+	UPIDType              uint8
+	UPID                  []byte
+	TypeID                uint8 // segmentation_type_id
+	SegmentNum            uint8
+	SegmentsExpected      uint8
+	SubSegments           bool  // sub_segment_num and sub_segments_expected are present
+	SubSegmentNum         uint8 // only for segmentation types with sub-segments
+	SubSegmentsExpected   uint8 // only for segmentation types with sub-segments
+}
+
+// SegmentationComponent structure represents component of
+// segmentation_descriptor() for component segmentation mode.
+type SegmentationComponent struct {
+	Tag       uint8
+	PTSOffset uint64
+}
+
+// DecodeBase64 decodes the section from base64 string as used by
+// EXT-OATCLS-SCTE35, EXT-X-CUE-OUT-CONT and EXT-SCTE35 tags.
+func DecodeBase64(s string) (*SpliceInfoSection, error) {
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("scte35: %s", err)
+	}
+	return Decode(data)
+}
+
+// DecodeHex decodes the section from hexadecimal sequence (with or
+// without 0x prefix) as used by SCTE35 attributes of EXT-X-DATERANGE.
+func DecodeHex(s string) (*SpliceInfoSection, error) {
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		s = s[2:]
+	}
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("scte35: %s", err)
+	}
+	return Decode(data)
+}
+
+// Decode parses binary splice_info_section and checks its CRC_32.
+func Decode(data []byte) (*SpliceInfoSection, error) {
+	r := &bitReader{data: data}
+	if tableID := r.read(8); r.err == nil && tableID != TableID {
+		return nil, fmt.Errorf("scte35: unexpected table_id 0x%02x", tableID)
+	}
+	r.read(2) // section_syntax_indicator and private_indicator
+	s := new(SpliceInfoSection)
+	s.SAPType = uint8(r.read(2))
+	length := uint(r.read(12))
+	if r.err != nil {
+		return nil, r.err
+	}
+	if length+3 > uint(len(data)) || length < 4 {
+		return nil, ErrShortSection
+	}
+	data = data[:length+3]
+	if crc32(data) != 0 {
+		return nil, ErrInvalidCRC
+	}
+	r.data = data[:len(data)-4] // CRC_32 is checked already
+
+	s.ProtocolVersion = uint8(r.read(8))
+	s.EncryptedPacket = r.flag()
+	s.EncryptionAlgorithm = uint8(r.read(6))
+	s.PTSAdjustment = r.read(33)
+	s.CWIndex = uint8(r.read(8))
+	s.Tier = uint16(r.read(12))
+	if r.err != nil {
+		return nil, r.err
+	}
+	if s.EncryptedPacket {
+		s.Encrypted = append([]byte(nil), r.data[r.pos/8:]...)
+		s.Encrypted[0] &= 0x0f // keep only splice_command_length of the shared byte
+		return s, nil
+	}
+	cmdLength := uint(r.read(12))
+	s.CommandType = uint8(r.read(8))
+	if r.err != nil {
+		return nil, r.err
+	}
+	start := r.pos
+	switch s.CommandType {
+	case SpliceInsertCommand:
+		s.SpliceInsert = decodeSpliceInsert(r)
+	case TimeSignal:
+		s.TimeSignal = decodeSpliceTime(r)
+	default:
+		if cmdLength == 0xfff {
+			return nil, fmt.Errorf("scte35: unknown length of splice command 0x%02x", s.CommandType)
+		}
+		s.Command = r.bytes(cmdLength)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if cmdLength != 0xfff && r.pos-start != cmdLength*8 {
+		return nil, fmt.Errorf("scte35: splice_command_length %d does not match splice command 0x%02x", cmdLength, s.CommandType)
+	}
+
+	loopLength := uint(r.read(16))
+	if r.err != nil {
+		return nil, r.err
+	}
+	if loopLength > r.left() {
+		return nil, ErrShortSection
+	}
+	loop := &bitReader{data: r.bytes(loopLength)}
+	for loop.left() > 0 {
+		d, err := decodeDescriptor(loop)
+		if err != nil {
+			return nil, err
+		}
+		s.Descriptors = append(s.Descriptors, d)
+	}
+	return s, nil
+}
+
+func decodeSpliceTime(r *bitReader) *SpliceTime {
+	t := new(SpliceTime)
+	t.TimeSpecified = r.flag()
+	if t.TimeSpecified {
+		r.read(6)
+		t.PTSTime = r.read(33)
+	} else {
+		r.read(7)
+	}
+	return t
+}
+
+func decodeSpliceInsert(r *bitReader) *SpliceInsert {
+	c := new(SpliceInsert)
+	c.EventID = uint32(r.read(32))
+	c.EventCancel = r.flag()
+	r.read(7)
+	if c.EventCancel {
+		return c
+	}
+	c.OutOfNetwork = r.flag()
+	c.ProgramSplice = r.flag()
+	durationFlag := r.flag()
+	c.SpliceImmediate = r.flag()
+	r.read(4)
+	if c.ProgramSplice && !c.SpliceImmediate {
+		c.SpliceTime = decodeSpliceTime(r)
+	}
+	if !c.ProgramSplice {
+		count := int(r.read(8))
+		for i := 0; i < count && r.err == nil; i++ {
+			comp := &SpliceInsertComponent{Tag: uint8(r.read(8))}
+			if !c.SpliceImmediate {
+				comp.SpliceTime = decodeSpliceTime(r)
+			}
+			c.Components = append(c.Components, comp)
+		}
+	}
+	if durationFlag {
+		c.BreakDuration = new(BreakDuration)
+		c.BreakDuration.AutoReturn = r.flag()
+		r.read(6)
+		c.BreakDuration.Duration = r.read(33)
+	}
+	c.UniqueProgramID = uint16(r.read(16))
+	c.AvailNum = uint8(r.read(8))
+	c.AvailsExpected = uint8(r.read(8))
+	return c
+}
+
+func decodeDescriptor(r *bitReader) (*SpliceDescriptor, error) {
+	d := new(SpliceDescriptor)
+	d.Tag = uint8(r.read(8))
+	length := uint(r.read(8))
+	body := r.bytes(length)
+	if r.err != nil {
+		return nil, r.err
+	}
+	if length < 4 {
+		return nil, fmt.Errorf("scte35: splice descriptor 0x%02x is too short", d.Tag)
+	}
+	br := &bitReader{data: body}
+	d.Identifier = uint32(br.read(32))
+	if d.Tag == SegmentationDescriptor && d.Identifier == CUEIdentifier {
+		d.Segmentation = decodeSegmentation(br)
+		if br.err != nil {
+			return nil, br.err
+		}
+		if br.left() > 0 {
+			return nil, fmt.Errorf("scte35: unexpected %d bytes in segmentation descriptor", br.left())
+		}
+		return d, nil
+	}
+	d.Data = body[4:]
+	return d, nil
+}
+
+// hasSubSegments reports whether segmentation type carries
+// sub_segment_num and sub_segments_expected fields.
+func hasSubSegments(typeID uint8) bool {
+	switch typeID {
+	case 0x34, 0x36, 0x38, 0x3a, 0x44, 0x46:
+		return true
+	}
+	return false
+}
+
+func decodeSegmentation(r *bitReader) *Segmentation {
+	s := new(Segmentation)
+	s.EventID = uint32(r.read(32))
+	s.EventCancel = r.flag()
+	s.EventIDCompliance = r.flag()
+	r.read(6)
+	if s.EventCancel {
+		return s
+	}
+	s.ProgramSegmentation = r.flag()
+	s.DurationFlag = r.flag()
+	s.DeliveryNotRestricted = r.flag()
+	if s.DeliveryNotRestricted {
+		r.read(5)
+	} else {
+		s.WebDeliveryAllowed = r.flag()
+		s.NoRegionalBlackout = r.flag()
+		s.ArchiveAllowed = r.flag()
+		s.DeviceRestrictions = uint8(r.read(2))
+	}
+	if !s.ProgramSegmentation {
+		count := int(r.read(8))
+		for i := 0; i < count && r.err == nil; i++ {
+			comp := &SegmentationComponent{Tag: uint8(r.read(8))}
+			r.read(7)
+			comp.PTSOffset = r.read(33)
+			s.Components = append(s.Components, comp)
+		}
+	}
+	if s.DurationFlag {
+		s.Duration = r.read(40)
+	}
+	s.UPIDType = uint8(r.read(8))
+	s.UPID = r.bytes(uint(r.read(8)))
+	s.TypeID = uint8(r.read(8))
+	s.SegmentNum = uint8(r.read(8))
+	s.SegmentsExpected = uint8(r.read(8))
+	// sub-segments fields were added in SCTE 35 2016 so older
+	// encoders may omit them
+	if hasSubSegments(s.TypeID) && r.left() >= 2 {
+		s.SubSegments = true
+		s.SubSegmentNum = uint8(r.read(8))
+		s.SubSegmentsExpected = uint8(r.read(8))
+	}
+	return s
+}
+
+// EncodeBase64 encodes the section to base64 string.
+func (s *SpliceInfoSection) EncodeBase64() (string, error) {
+	data, err := s.Encode()
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// EncodeHex encodes the section to hexadecimal sequence with 0x prefix.
+func (s *SpliceInfoSection) EncodeHex() (string, error) {
+	data, err := s.Encode()
+	if err != nil {
+		return "", err
+	}
+	return "0x" + strings.ToUpper(hex.EncodeToString(data)), nil
+}
+
+// Encode generates binary splice_info_section. Section and command
+// lengths and CRC_32 are calculated, reserved bits are set to 1.
+func (s *SpliceInfoSection) Encode() ([]byte, error) {
+	body := new(bitWriter)
+	body.write(8, uint64(s.ProtocolVersion))
+	body.flag(s.EncryptedPacket)
+	body.write(6, uint64(s.EncryptionAlgorithm))
+	body.write(33, s.PTSAdjustment)
+	body.write(8, uint64(s.CWIndex))
+	body.write(12, uint64(s.Tier))
+	if s.EncryptedPacket {
+		if len(s.Encrypted) == 0 {
+			return nil, errors.New("scte35: encrypted section without data")
+		}
+		// the first byte shares 4 bits with tier
+		body.write(4, uint64(s.Encrypted[0]))
+		body.bytes(s.Encrypted[1:])
+	} else {
+		cmd := new(bitWriter)
+		switch s.CommandType {
+		case SpliceInsertCommand:
+			if s.SpliceInsert == nil {
+				return nil, errors.New("scte35: splice_insert command is not set")
+			}
+			encodeSpliceInsert(cmd, s.SpliceInsert)
+		case TimeSignal:
+			if s.TimeSignal == nil {
+				return nil, errors.New("scte35: time_signal command is not set")
+			}
+			encodeSpliceTime(cmd, s.TimeSignal)
+		default:
+			cmd.bytes(s.Command)
+		}
+		if len(cmd.data) >= 0xfff {
+			return nil, errors.New("scte35: splice command is too long")
+		}
+		body.write(12, uint64(len(cmd.data)))
+		body.write(8, uint64(s.CommandType))
+		body.bytes(cmd.data)
+
+		loop := new(bitWriter)
+		for _, d := range s.Descriptors {
+			if err := encodeDescriptor(loop, d); err != nil {
+				return nil, err
+			}
+		}
+		if len(loop.data) > 0xffff {
+			return nil, errors.New("scte35: descriptors are too long")
+		}
+		body.write(16, uint64(len(loop.data)))
+		body.bytes(loop.data)
+	}
+
+	length := len(body.data) + 4 // CRC_32
+	if length > 0xfff {
+		return nil, errors.New("scte35: section is too long")
+	}
+	w := new(bitWriter)
+	w.write(8, TableID)
+	w.write(2, 0) // section_syntax_indicator and private_indicator
+	w.write(2, uint64(s.SAPType))
+	w.write(12, uint64(length))
+	w.bytes(body.data)
+	w.write(32, uint64(crc32(w.data)))
+	return w.data, nil
+}
+
+func encodeSpliceTime(w *bitWriter, t *SpliceTime) {
+	w.flag(t.TimeSpecified)
+	if t.TimeSpecified {
+		w.reserved(6)
+		w.write(33, t.PTSTime)
+	} else {
+		w.reserved(7)
+	}
+}
+
+func encodeSpliceInsert(w *bitWriter, c *SpliceInsert) {
+	w.write(32, uint64(c.EventID))
+	w.flag(c.EventCancel)
+	w.reserved(7)
+	if c.EventCancel {
+		return
+	}
+	w.flag(c.OutOfNetwork)
+	w.flag(c.ProgramSplice)
+	w.flag(c.BreakDuration != nil)
+	w.flag(c.SpliceImmediate)
+	w.reserved(4)
+	if c.ProgramSplice && !c.SpliceImmediate {
+		t := c.SpliceTime
+		if t == nil {
+			t = new(SpliceTime)
+		}
+		encodeSpliceTime(w, t)
+	}
+	if !c.ProgramSplice {
+		w.write(8, uint64(len(c.Components)))
+		for _, comp := range c.Components {
+			w.write(8, uint64(comp.Tag))
+			if !c.SpliceImmediate {
+				t := comp.SpliceTime
+				if t == nil {
+					t = new(SpliceTime)
+				}
+				encodeSpliceTime(w, t)
+			}
+		}
+	}
+	if c.BreakDuration != nil {
+		w.flag(c.BreakDuration.AutoReturn)
+		w.reserved(6)
+		w.write(33, c.BreakDuration.Duration)
+	}
+	w.write(16, uint64(c.UniqueProgramID))
+	w.write(8, uint64(c.AvailNum))
+	w.write(8, uint64(c.AvailsExpected))
+}
+
+func encodeDescriptor(w *bitWriter, d *SpliceDescriptor) error {
+	body := new(bitWriter)
+	body.write(32, uint64(d.Identifier))
+	if d.Segmentation != nil {
+		encodeSegmentation(body, d.Segmentation)
+	} else {
+		body.bytes(d.Data)
+	}
+	if len(body.data) > 0xff {
+		return fmt.Errorf("scte35: splice descriptor 0x%02x is too long", d.Tag)
+	}
+	w.write(8, uint64(d.Tag))
+	w.write(8, uint64(len(body.data)))
+	w.bytes(body.data)
+	return nil
+}
+
+func encodeSegmentation(w *bitWriter, s *Segmentation) {
+	w.write(32, uint64(s.EventID))
+	w.flag(s.EventCancel)
+	w.flag(s.EventIDCompliance)
+	w.reserved(6)
+	if s.EventCancel {
+		return
+	}
+	w.flag(s.ProgramSegmentation)
+	w.flag(s.DurationFlag)
+	w.flag(s.DeliveryNotRestricted)
+	if s.DeliveryNotRestricted {
+		w.reserved(5)
+	} else {
+		w.flag(s.WebDeliveryAllowed)
+		w.flag(s.NoRegionalBlackout)
+		w.flag(s.ArchiveAllowed)
+		w.write(2, uint64(s.DeviceRestrictions))
+	}
+	if !s.ProgramSegmentation {
+		w.write(8, uint64(len(s.Components)))
+		for _, comp := range s.Components {
+			w.write(8, uint64(comp.Tag))
+			w.reserved(7)
+			w.write(33, comp.PTSOffset)
+		}
+	}
+	if s.DurationFlag {
+		w.write(40, s.Duration)
+	}
+	w.write(8, uint64(s.UPIDType))
+	w.write(8, uint64(len(s.UPID)))
+	w.bytes(s.UPID)
+	w.write(8, uint64(s.TypeID))
+	w.write(8, uint64(s.SegmentNum))
+	w.write(8, uint64(s.SegmentsExpected))
+	if s.SubSegments && hasSubSegments(s.TypeID) {
+		w.write(8, uint64(s.SubSegmentNum))
+		w.write(8, uint64(s.SubSegmentsExpected))
+	}
+}
+
+// BreakDuration returns duration of the break in seconds from
+// break_duration() of splice_insert or from the first segmentation
+// descriptor with segmentation_duration. It returns false if the
+// section carries no duration.
+func (s *SpliceInfoSection) BreakDuration() (float64, bool) {
+	if s.SpliceInsert != nil && s.SpliceInsert.BreakDuration != nil {
+		return float64(s.SpliceInsert.BreakDuration.Duration) / TicksPerSecond, true
+	}
+	for _, d := range s.Descriptors {
+		if d.Segmentation != nil && d.Segmentation.DurationFlag {
+			return float64(d.Segmentation.Duration) / TicksPerSecond, true
+		}
+	}
+	return 0, false
+}
+
+// PTSTime returns splice time in seconds of splice_insert in program
+// splice mode or of time_signal with pts_adjustment applied. It
+// returns false if the time is not specified (splice immediate).
+func (s *SpliceInfoSection) PTSTime() (float64, bool) {
+	var t *SpliceTime
+	switch {
+	case s.TimeSignal != nil:
+		t = s.TimeSignal
+	case s.SpliceInsert != nil:
+		t = s.SpliceInsert.SpliceTime
+	}
+	if t == nil || !t.TimeSpecified {
+		return 0, false
+	}
+	pts := (t.PTSTime + s.PTSAdjustment) & (1<<33 - 1)
+	return float64(pts) / TicksPerSecond, true
+}
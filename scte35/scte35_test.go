@@ -0,0 +1,165 @@
+package scte35
+
+/*
+ Part of M3U8 parser & generator library.
+ This file defines tests for SCTE-35 decoding and encoding.
+
+ Copyright 2013-2019 The Project Developers.
+ See the AUTHORS and LICENSE files at the top-level directory of this distribution
+ and at https://github.com/grafov/m3u8/
+
+ ॐ तारे तुत्तारे तुरे स्व
+*/
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+const (
+	spliceInsertCue = "/DAlAAAAAAAAAP/wFAUAAAABf+/+ANgNkv4AFJlwAAEBAQAA5xULLA=="
+	timeSignalCue   = "/DA0AAAAAAAA///wBQb+cr0AUAAeAhxDVUVJSAAAjn/PAAGlmbAICAAAAAAsoKGKNAIAmsnRfg=="
+	availCue        = "/DAvAAAAAAAA///wFAVIAACPf+/+c2nALv4AUsz1AAAAAAAKAAhDVUVJAAABNWLbowo="
+)
+
+func TestDecodeSpliceInsert(t *testing.T) {
+	s, err := DecodeBase64(spliceInsertCue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.CommandType != SpliceInsertCommand || s.SpliceInsert == nil {
+		t.Fatalf("expected splice_insert, got command 0x%02x", s.CommandType)
+	}
+	c := s.SpliceInsert
+	if c.EventID != 1 || !c.OutOfNetwork || !c.ProgramSplice || c.SpliceImmediate {
+		t.Errorf("unexpected splice_insert %+v", c)
+	}
+	if c.SpliceTime == nil || !c.SpliceTime.TimeSpecified || c.SpliceTime.PTSTime != 14159250 {
+		t.Errorf("unexpected splice time %+v", c.SpliceTime)
+	}
+	if c.BreakDuration == nil || !c.BreakDuration.AutoReturn || c.BreakDuration.Duration != 1350000 {
+		t.Errorf("unexpected break duration %+v", c.BreakDuration)
+	}
+	if c.UniqueProgramID != 1 || c.AvailNum != 1 || c.AvailsExpected != 1 {
+		t.Errorf("unexpected avail fields %+v", c)
+	}
+	if d, ok := s.BreakDuration(); !ok || d != 15 {
+		t.Errorf("expected break duration 15s, got %v", d)
+	}
+	if pts, ok := s.PTSTime(); !ok || pts != 157.325 {
+		t.Errorf("expected splice time 157.325s, got %v", pts)
+	}
+}
+
+func TestDecodeTimeSignalWithSegmentation(t *testing.T) {
+	s, err := DecodeBase64(timeSignalCue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.CommandType != TimeSignal || s.TimeSignal == nil || s.TimeSignal.PTSTime != 0x072bd0050 {
+		t.Fatalf("unexpected time_signal %+v", s.TimeSignal)
+	}
+	if len(s.Descriptors) != 1 || s.Descriptors[0].Segmentation == nil {
+		t.Fatalf("expected one segmentation descriptor, got %+v", s.Descriptors)
+	}
+	d := s.Descriptors[0]
+	if d.Tag != SegmentationDescriptor || d.Identifier != CUEIdentifier {
+		t.Errorf("unexpected descriptor %+v", d)
+	}
+	seg := d.Segmentation
+	if seg.EventID != 0x4800008e || !seg.ProgramSegmentation || !seg.DurationFlag || seg.Duration != 27630000 {
+		t.Errorf("unexpected segmentation descriptor %+v", seg)
+	}
+	if seg.UPIDType != 0x08 || !bytes.Equal(seg.UPID, []byte{0, 0, 0, 0, 0x2c, 0xa0, 0xa1, 0x8a}) {
+		t.Errorf("unexpected UPID 0x%02x %x", seg.UPIDType, seg.UPID)
+	}
+	if seg.TypeID != 0x34 || seg.SegmentNum != 2 || seg.SegmentsExpected != 0 || seg.SubSegments {
+		t.Errorf("unexpected segmentation type %+v", seg)
+	}
+	if dur, ok := s.BreakDuration(); !ok || dur != 307 {
+		t.Errorf("expected segmentation duration 307s, got %v", dur)
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	for _, cue := range []string{spliceInsertCue, timeSignalCue, availCue} {
+		s, err := DecodeBase64(cue)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := s.EncodeBase64()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != cue {
+			t.Errorf("round trip mismatch\ngot: %s\nexp: %s", got, cue)
+		}
+	}
+}
+
+func TestEncodeDecodeSpliceInsert(t *testing.T) {
+	s := &SpliceInfoSection{
+		SAPType:     3,
+		Tier:        0xfff,
+		CommandType: SpliceInsertCommand,
+		SpliceInsert: &SpliceInsert{
+			EventID:         42,
+			OutOfNetwork:    true,
+			SpliceImmediate: true,
+			Components: []*SpliceInsertComponent{
+				{Tag: 1},
+				{Tag: 2},
+			},
+			BreakDuration: &BreakDuration{AutoReturn: true, Duration: 30 * TicksPerSecond},
+		},
+		Descriptors: []*SpliceDescriptor{
+			{
+				Tag:        SegmentationDescriptor,
+				Identifier: CUEIdentifier,
+				Segmentation: &Segmentation{
+					EventID:               7,
+					DeliveryNotRestricted: true,
+					Components:            []*SegmentationComponent{{Tag: 1, PTSOffset: 90}},
+					UPIDType:              0x09,
+					UPID:                  []byte("SIGNAL:abc"),
+					TypeID:                0x34,
+					SegmentNum:            1,
+					SegmentsExpected:      1,
+					SubSegments:           true,
+					SubSegmentNum:         1,
+					SubSegmentsExpected:   2,
+				},
+			},
+			{Tag: AvailDescriptor, Identifier: CUEIdentifier, Data: []byte{0, 0, 1, 53}},
+		},
+	}
+	hex, err := s.EncodeHex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodeHex(hex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, s) {
+		t.Errorf("decoded section does not match encoded one\ngot: %+v\nexp: %+v", got, s)
+	}
+}
+
+func TestDecodeInvalidSection(t *testing.T) {
+	data, err := (&SpliceInfoSection{CommandType: TimeSignal, TimeSignal: &SpliceTime{}}).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Decode(data[:len(data)-1]); err != ErrShortSection {
+		t.Errorf("expected ErrShortSection, got %v", err)
+	}
+	data[len(data)-1] ^= 0xff
+	if _, err = Decode(data); err != ErrInvalidCRC {
+		t.Errorf("expected ErrInvalidCRC, got %v", err)
+	}
+	if _, err = DecodeBase64("not base64"); err == nil {
+		t.Error("expected error for malformed base64")
+	}
+}
@@ -0,0 +1,162 @@
+package m3u8
+
+/*
+ Part of M3U8 parser & generator library.
+ This file defines streaming decoder of media playlists.
+
+ Copyright 2013-2019 The Project Developers.
+ See the AUTHORS and LICENSE files at the top-level directory of this distribution
+ and at https://github.com/grafov/m3u8/
+
+ ॐ तारे तुत्तारे तुरे स्व
+*/
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// MediaReader decodes a media playlist from the stream segment by
+// segment. Only the header and the segment being decoded are kept in
+// memory so it suits for very long playlists. Sample of usage:
+//
+//	r := m3u8.NewMediaReader(f)
+//	header, err := r.Header()
+//	...
+//	for {
+//		seg, err := r.Next()
+//		if err == io.EOF {
+//			break
+//		}
+//		...
+//	}
+type MediaReader struct {
+	reader   *bufio.Reader
+	opts     decodeOptions
+	p        *MediaPlaylist
+	state    *decodingState
+	wv       *WV
+	lineno   int
+	count    int           // number of segments decoded
+	next     uint64        // sequence number of the next segment
+	pending  *MediaSegment // the first segment decoded by Header
+	header   bool          // the header is decoded
+	problems []*DecodeError
+	err      error
+}
+
+// NewMediaReader creates a streaming decoder of the media playlist
+// configured with the options.
+func NewMediaReader(reader io.Reader, options ...DecodeOption) *MediaReader {
+	r := &MediaReader{reader: bufio.NewReader(reader)}
+	for _, option := range options {
+		option(&r.opts)
+	}
+	r.p, _ = NewMediaPlaylist(0, 1) // segments are taken from the playlist one by one
+	r.p.configure(&r.opts)
+	r.state = newDecodingState(&r.opts)
+	r.wv = new(WV)
+	return r
+}
+
+// Header decodes the stream up to the first segment and returns the
+// playlist without segments. The first segment is kept for Next. Tags
+// displayed after the segments (EXT-X-ENDLIST, EXT-X-PRELOAD-HINT and
+// others) are set to the playlist when Next returns io.EOF.
+func (r *MediaReader) Header() (*MediaPlaylist, error) {
+	if !r.header {
+		seg, err := r.decode()
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		r.pending = seg
+		r.header = true
+	}
+	return r.p, nil
+}
+
+// Next returns the next segment of the playlist. It returns io.EOF
+// when there are no more segments.
+func (r *MediaReader) Next() (*MediaSegment, error) {
+	r.header = true
+	if seg := r.pending; seg != nil {
+		r.pending = nil
+		return seg, nil
+	}
+	return r.decode()
+}
+
+// Problems returns problems recovered in Lenient mode so far.
+func (r *MediaReader) Problems() []*DecodeError {
+	return r.problems
+}
+
+// decode reads lines until the next segment is decoded.
+func (r *MediaReader) decode() (*MediaSegment, error) {
+	for r.err == nil {
+		line, err := r.reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			r.err = err
+			break
+		}
+		if len(line) > 0 {
+			r.lineno++
+			problems, decodeErr := decodeMediaLine(r.p, r.wv, r.state, &r.opts, r.lineno, line)
+			if decodeErr != nil {
+				r.err = decodeErr
+				break
+			}
+			r.problems = append(r.problems, problems...)
+		}
+		if r.p.count > 0 {
+			return r.take(line)
+		}
+		if err == io.EOF {
+			r.err = r.finish()
+		}
+	}
+	return nil, r.err
+}
+
+// take removes the decoded segment from the playlist. Parts and date
+// ranges are linked to the segment so the playlist keeps nothing of
+// the segment.
+func (r *MediaReader) take(line string) (*MediaSegment, error) {
+	seg := r.p.Segments[r.p.head]
+	r.p.Segments[r.p.head] = nil
+	r.p.head, r.p.tail, r.p.count = 0, 0, 0
+	r.p.PendingParts, r.p.PendingDateRanges = nil, nil
+	r.p.buf.Reset()
+	// the playlist is empty so the sequence number is counted here
+	if r.count > 0 {
+		seg.SeqId = r.next
+	}
+	r.next = seg.SeqId + 1
+	r.count++
+	if r.opts.maxSegments > 0 && r.count > r.opts.maxSegments {
+		r.err = newDecodeError(r.lineno, line, ErrTooManySegments)
+		return nil, r.err
+	}
+	if r.opts.baseURL != nil {
+		seg.rewriteURIs(resolveTo(r.opts.baseURL))
+	}
+	return seg, nil
+}
+
+// finish completes decoding of the playlist at the end of the stream.
+func (r *MediaReader) finish() error {
+	if r.state.tagWV {
+		r.p.WV = r.wv
+	}
+	if len(r.state.unknownSegment) > 0 {
+		r.p.TrailingTags = r.state.unknownSegment
+	}
+	if r.opts.strictness >= Strict && !r.state.m3u {
+		return errors.New("#EXTM3U absent")
+	}
+	if r.opts.baseURL != nil {
+		r.p.ResolveURIs(r.opts.baseURL)
+	}
+	return io.EOF
+}
@@ -0,0 +1,207 @@
+package m3u8
+
+/*
+ Streaming decoder tests.
+
+ Copyright 2013-2019 The Project Developers.
+ See the AUTHORS and LICENSE files at the top-level directory of this distribution
+ and at https://github.com/grafov/m3u8/
+
+ ॐ तारे तुत्तारे तुरे स्व
+*/
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMediaReaderDecodesLikeDecoder(t *testing.T) {
+	for _, name := range []string{
+		"media-playlist-large.m3u8",
+		"media-playlist-with-byterange.m3u8",
+		"media-playlist-with-discontinuity.m3u8",
+		"media-playlist-with-program-date-time.m3u8",
+		"media-playlist-with-oatcls-scte35.m3u8",
+		"media-playlist-with-gap-and-bitrate.m3u8",
+		"media-playlist-low-latency.m3u8",
+		"wowza-vod-chunklist.m3u8",
+	} {
+		f, err := os.Open("sample-playlists/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, _ := NewMediaPlaylist(0, 8)
+		if err = expected.DecodeFrom(bufio.NewReader(f), true); err != nil {
+			t.Fatal(err)
+		}
+
+		f.Seek(0, io.SeekStart)
+		r := NewMediaReader(f, WithStrictness(Strict))
+		p, err := r.Header()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if p.SeqNo != expected.SeqNo || p.TargetDuration != expected.TargetDuration {
+			t.Errorf("%s: unexpected header: %+v", name, p)
+		}
+		var segments []*MediaSegment
+		for {
+			seg, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			segments = append(segments, seg)
+		}
+		if !reflect.DeepEqual(segments, expected.GetAllSegments()) {
+			t.Errorf("%s: streamed segments differ from decoded ones", name)
+		}
+		if p.Closed != expected.Closed || len(p.PreloadHints) != len(expected.PreloadHints) || len(p.RenditionReports) != len(expected.RenditionReports) {
+			t.Errorf("%s: unexpected trailing tags of the playlist: %+v", name, p)
+		}
+		if len(p.Segments) != 1 {
+			t.Errorf("%s: expected single segment buffer, got %d", name, len(p.Segments))
+		}
+		f.Close()
+	}
+}
+
+func TestMediaReaderWithoutHeader(t *testing.T) {
+	r := NewMediaReader(strings.NewReader("#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:5\n#EXTINF:10,\nseg5.ts\n#EXTINF:10,\nseg6.ts\n#EXT-X-ENDLIST"))
+	for i := uint64(5); i < 7; i++ {
+		seg, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seg.SeqId != i || seg.URI != fmt.Sprintf("seg%d.ts", i) {
+			t.Errorf("Unexpected segment: %+v", seg)
+		}
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("Expected EOF, got %v", err)
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("Expected EOF again, got %v", err)
+	}
+	p, _ := r.Header()
+	if !p.Closed || p.SeqNo != 5 {
+		t.Errorf("Unexpected header: %+v", p)
+	}
+}
+
+func TestMediaReaderErrors(t *testing.T) {
+	playlist := "#EXTM3U\n#EXTINF:10,\nseg0.ts\n#EXT-X-BYTERANGE:1000@abc\n#EXTINF:10,\nseg1.ts\n#EXT-X-UNKNOWN\n#EXTINF:10,\nseg2.ts\n"
+	r := NewMediaReader(strings.NewReader(playlist), WithStrictness(Strict))
+	if _, err := r.Next(); err != nil {
+		t.Fatal(err)
+	}
+	_, err := r.Next()
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) || decodeErr.Line != 4 {
+		t.Errorf("Expected error at line 4, got %v", err)
+	}
+
+	r = NewMediaReader(strings.NewReader(playlist))
+	var count int
+	for {
+		if _, err = r.Next(); err != nil {
+			break
+		}
+		count++
+	}
+	if err != io.EOF || count != 3 {
+		t.Errorf("Expected 3 segments, got %d: %v", count, err)
+	}
+	if problems := r.Problems(); len(problems) != 2 || !errors.Is(problems[1], ErrUnknownTag) {
+		t.Errorf("Unexpected problems: %v", problems)
+	}
+
+	r = NewMediaReader(strings.NewReader(playlist), WithMaxSegments(2))
+	for err = nil; err == nil; _, err = r.Next() {
+	}
+	if !errors.Is(err, ErrTooManySegments) {
+		t.Errorf("Expected too many segments, got %v", err)
+	}
+}
+
+func TestMediaReaderLongPlaylist(t *testing.T) {
+	const count = 100000
+	pr, pw := io.Pipe()
+	go func() {
+		w := bufio.NewWriter(pw)
+		w.WriteString("#EXTM3U\n#EXT-X-TARGETDURATION:6\n#EXT-X-PLAYLIST-TYPE:VOD\n")
+		for i := 0; i < count; i++ {
+			fmt.Fprintf(w, "#EXTINF:6.000,\nsegment%d.ts\n", i)
+		}
+		w.WriteString("#EXT-X-ENDLIST\n")
+		w.Flush()
+		pw.Close()
+	}()
+	r := NewMediaReader(pr)
+	p, err := r.Header()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.MediaType != VOD {
+		t.Errorf("Expected VOD playlist, got %v", p.MediaType)
+	}
+	var n uint64
+	for ; ; n++ {
+		seg, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seg.SeqId != n {
+			t.Fatalf("Expected sequence number %d, got %d", n, seg.SeqId)
+		}
+	}
+	if n != count || !p.Closed {
+		t.Errorf("Expected %d segments of closed playlist, got %d", count, n)
+	}
+}
+
+func TestMediaReaderDateRanges(t *testing.T) {
+	const count = 1000
+	pr, pw := io.Pipe()
+	go func() {
+		w := bufio.NewWriter(pw)
+		w.WriteString("#EXTM3U\n#EXT-X-VERSION:6\n#EXT-X-TARGETDURATION:6\n")
+		for i := 0; i < count; i++ {
+			fmt.Fprintf(w, "#EXT-X-PROGRAM-DATE-TIME:2020-01-01T00:00:00Z\n#EXT-X-DATERANGE:ID=\"ad%d\",START-DATE=\"2020-01-01T00:00:00Z\"\n#EXTINF:6.000,\nsegment%d.ts\n", i, i)
+		}
+		w.WriteString("#EXT-X-ENDLIST\n")
+		w.Flush()
+		pw.Close()
+	}()
+	r := NewMediaReader(pr)
+	p, err := r.Header()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := 0; ; n++ {
+		seg, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(seg.DateRanges) != 1 || seg.DateRanges[0].ID != fmt.Sprintf("ad%d", n) {
+			t.Fatalf("Expected date range ad%d with the segment, got %+v", n, seg.DateRanges)
+		}
+		if len(p.PendingDateRanges) != 0 || p.Count() != 0 {
+			t.Fatalf("Expected header without segment state, got %d date ranges and %d segments", len(p.PendingDateRanges), p.Count())
+		}
+	}
+}
@@ -14,6 +14,7 @@ package m3u8
 import (
 	"bytes"
 	"io"
+	"net/url"
 	"time"
 )
 
@@ -57,6 +58,15 @@ const (
 	VOD
 )
 
+// DefineType is the kind of variable definition of EXT-X-DEFINE tag.
+type DefineType uint
+
+const (
+	DefineValue      DefineType = iota // NAME and VALUE attributes define the variable in place
+	DefineImport                       // IMPORT takes the variable from the master playlist
+	DefineQueryParam                   // QUERYPARAM takes the variable from the query of the playlist URI
+)
+
 // SCTE35Syntax defines the format of the SCTE-35 cue points which do not use
 // the draft-pantos-http-live-streaming-19 EXT-X-DATERANGE tag and instead
 // have their own custom tags
@@ -81,7 +91,8 @@ const (
 // MediaPlaylist structure represents a single bitrate playlist aka
 // media playlist. It related to both a simple media playlists and a
 // sliding window media playlists. URI lines in the Playlist point to
-// media segments.
+// media segments. MediaPlaylist is not safe for concurrent use, see
+// LivePlaylist for live playlists updated and encoded concurrently.
 //
 // Simple Media Playlist file sample:
 //
@@ -124,12 +135,32 @@ type MediaPlaylist struct {
 	tail             uint // tail of FIFO, we remove segments from tail
 	count            uint // number of segments added to the playlist
 	buf              bytes.Buffer
+	encodeOpts       EncodeOptions
 	ver              uint8
 	Key              *Key // EXT-X-KEY is optional encryption key displayed before any segments (default key for the playlist)
 	Map              *Map // EXT-X-MAP is optional tag specifies how to obtain the Media Initialization Section (default map for the playlist)
 	WV               *WV  // Widevine related tags outside of M3U8 specs
 	Custom           map[string]CustomTag
+	customOrder      customOrder
+	DateRanges       []*DateRange // EXT-X-DATERANGE tags displayed before the segments
 	customDecoders   []CustomDecoder
+	Defines          []*Define // EXT-X-DEFINE tags displayed before any other tags
+	expandVars       bool      // expand variables on Encode instead of keeping them symbolic
+	autoVersion      bool      // write the minimum compatible version on Encode
+	importVars       map[string]string
+	query            url.Values
+	UnknownTags      []string // unrecognised tags and comments of the header, see PreserveUnknownTags
+	TrailingTags     []string // unrecognised tags and comments after the last segment
+	preserveUnknown  bool
+
+	// Low-Latency HLS extensions
+	ServerControl      *ServerControl     // EXT-X-SERVER-CONTROL declares delivery directives supported by the server
+	PartTargetDuration float64            // EXT-X-PART-INF:PART-TARGET is the maximum duration of partial segments
+	PendingParts       []*PartialSegment  // EXT-X-PART tags displayed after the last segment, they belong to the segment not completed yet
+	PendingDateRanges  []*DateRange       // EXT-X-DATERANGE tags displayed after the last segment, they are linked to the next appended segment
+	PreloadHints       []*PreloadHint     // EXT-X-PRELOAD-HINT tags displayed after the last segment
+	RenditionReports   []*RenditionReport // EXT-X-RENDITION-REPORT tags displayed after the last segment
+	Skip               *Skip              // EXT-X-SKIP is set for playlist delta updates
 }
 
 // MasterPlaylist structure represents a master playlist which
@@ -150,53 +181,89 @@ type MasterPlaylist struct {
 	Args                string // optional arguments placed after URI (URI?Args)
 	CypherVersion       string // non-standard tag for Widevine (see also WV struct)
 	buf                 bytes.Buffer
+	encodeOpts          EncodeOptions
 	ver                 uint8
 	independentSegments bool
 	Custom              map[string]CustomTag
+	customOrder         customOrder
 	customDecoders      []CustomDecoder
+	SessionData         []*SessionData   // EXT-X-SESSION-DATA tags displayed before the variants
+	SessionKeys         []*Key           // EXT-X-SESSION-KEY tags allow clients to preload encryption keys
+	ContentSteering     *ContentSteering // EXT-X-CONTENT-STEERING points to the steering manifest of the content
+	Defines             []*Define        // EXT-X-DEFINE tags displayed before any other tags
+	expandVars          bool             // expand variables on Encode instead of keeping them symbolic
+	autoVersion         bool             // write the minimum compatible version on Encode
+	query               url.Values
+	UnknownTags         []string // unrecognised tags and comments of the header, see PreserveUnknownTags
+	TrailingTags        []string // unrecognised tags and comments after the last variant
+	preserveUnknown     bool
 }
 
 // Variant structure represents variants for master playlist.
 // Variants included in a master playlist and point to media
 // playlists.
 type Variant struct {
-	URI       string
-	Chunklist *MediaPlaylist
+	URI         string
+	Chunklist   *MediaPlaylist
+	UnknownTags []string // unrecognised tags and comments displayed before the variant
 	VariantParams
+	vars *varRefs
 }
 
 // VariantParams structure represents additional parameters for a
 // variant used in EXT-X-STREAM-INF and EXT-X-I-FRAME-STREAM-INF
 type VariantParams struct {
-	ProgramId        uint32
-	Bandwidth        uint32
-	AverageBandwidth uint32 // EXT-X-STREAM-INF only
-	Codecs           string
-	Resolution       string
-	Audio            string // EXT-X-STREAM-INF only
-	Video            string
-	Subtitles        string // EXT-X-STREAM-INF only
-	Captions         string // EXT-X-STREAM-INF only
-	Name             string // EXT-X-STREAM-INF only (non standard Wowza/JWPlayer extension to name the variant/quality in UA)
-	Iframe           bool   // EXT-X-I-FRAME-STREAM-INF
-	VideoRange       string
-	HDCPLevel        string
-	FrameRate        float64        // EXT-X-STREAM-INF
-	Alternatives     []*Alternative // EXT-X-MEDIA
+	ProgramId          uint32
+	Bandwidth          uint32
+	AverageBandwidth   uint32 // EXT-X-STREAM-INF only
+	Codecs             string
+	Resolution         string
+	Audio              string // EXT-X-STREAM-INF only
+	Video              string
+	Subtitles          string // EXT-X-STREAM-INF only
+	Captions           string // EXT-X-STREAM-INF only
+	Name               string // EXT-X-STREAM-INF only (non standard Wowza/JWPlayer extension to name the variant/quality in UA)
+	Iframe             bool   // EXT-X-I-FRAME-STREAM-INF
+	VideoRange         string
+	HDCPLevel          string
+	FrameRate          float64        // EXT-X-STREAM-INF
+	Alternatives       []*Alternative // EXT-X-MEDIA
+	PathwayID          string         // PATHWAY-ID is content steering pathway of the variant
+	StableVariantID    string         // STABLE-VARIANT-ID identifies the variant across playlist reloads and pathways
+	Score              float64        // SCORE is relative preference of the variant, zero value is not displayed
+	SupplementalCodecs string         // SUPPLEMENTAL-CODECS lists backward compatible enhancements (e.g. Dolby Vision profile)
+	AllowedCPC         string         // ALLOWED-CPC lists allowed content protection configurations per KEYFORMAT
+	ReqVideoLayout     string         // REQ-VIDEO-LAYOUT is required video layout (e.g. CH-STEREO)
 }
 
 // Alternative structure represents EXT-X-MEDIA tag in variants.
 type Alternative struct {
-	GroupId         string
-	URI             string
-	Type            string
-	Language        string
-	Name            string
-	Default         bool
-	Autoselect      string
-	Forced          string
-	Characteristics string
-	Subtitles       string
+	GroupId           string
+	URI               string
+	Type              string
+	Language          string
+	Name              string
+	Default           bool
+	Autoselect        string
+	Forced            string
+	Characteristics   string
+	Subtitles         string
+	StableRenditionID string
+	AssocLanguage     string
+	InstreamId        string    // INSTREAM-ID identifies closed captions channel (CC1..CC4 or SERVICE1..SERVICE63)
+	Channels          *Channels // CHANNELS of audio renditions
+	BitDepth          uint32    // BIT-DEPTH of audio samples
+	SampleRate        uint32    // SAMPLE-RATE of audio in Hz
+	vars              *varRefs
+}
+
+// Channels structure represents CHANNELS attribute of EXT-X-MEDIA
+// tag. It is a slash separated list of parameters, for example "16/JOC"
+// for Dolby Atmos or "2" for stereo.
+type Channels struct {
+	Count   uint32   // count of independent, simultaneous audio channels
+	Spatial []string // audio coding identifiers of spatial audio (e.g. JOC), nil for "-"
+	Usage   []string // special usage of channels (BINAURAL, IMMERSIVE, DOWNMIX)
 }
 
 // MediaSegment structure represents a media segment included in a
@@ -212,9 +279,54 @@ type MediaSegment struct {
 	Key             *Key      // EXT-X-KEY displayed before the segment and means changing of encryption key (in theory each segment may have own key)
 	Map             *Map      // EXT-X-MAP displayed before the segment
 	Discontinuity   bool      // EXT-X-DISCONTINUITY indicates an encoding discontinuity between the media segment that follows it and the one that preceded it (i.e. file format, number and type of tracks, encoding parameters, encoding sequence, timestamp sequence)
+	Gap             bool      // EXT-X-GAP indicates that the segment is absent and must not be loaded by clients
 	SCTE            *SCTE     // SCTE-35 used for Ad signaling in HLS
 	ProgramDateTime time.Time // EXT-X-PROGRAM-DATE-TIME tag associates the first sample of a media segment with an absolute date and/or time
 	Custom          map[string]CustomTag
+	customOrder     customOrder
+	Parts           []*PartialSegment // EXT-X-PART tags displayed before the segment (Low-Latency HLS)
+	DateRanges      []*DateRange      // EXT-X-DATERANGE tags displayed before the segment
+	Bitrate         int64             // EXT-X-BITRATE is approximate bit rate of the segment in kbit/s, the tag applies to following segments until the next one
+	UnknownTags     []string          // unrecognised tags and comments displayed before the segment
+	vars            *varRefs
+}
+
+// PartialSegment structure represents a part of a media segment used
+// by Low-Latency HLS. Partial segments of a media segment are
+// displayed before its EXTINF tag.
+//
+// Realizes EXT-X-PART tag.
+type PartialSegment struct {
+	URI         string
+	Duration    float64 // DURATION attribute in seconds
+	Independent bool    // INDEPENDENT=YES means the part starts with an independent frame
+	Limit       int64   // BYTERANGE <n> is length in bytes for the file under URI
+	Offset      int64   // BYTERANGE [@o] is offset from the start of the file under URI
+	Gap         bool    // GAP=YES means the part is not available
+	vars        *varRefs
+}
+
+// DateRange structure represents a range of time defined by a
+// starting and ending date with a set of attributes. It is used for
+// signaling of ad breaks (SCTE-35) and other timed metadata.
+//
+// Realizes EXT-X-DATERANGE tag.
+type DateRange struct {
+	ID              string
+	Class           string    // CLASS defines a set of attributes and their semantics
+	StartDate       time.Time // START-DATE is the start of the range
+	EndDate         time.Time // END-DATE is the end of the range, optional
+	Duration        *float64  // DURATION of the range in seconds, nil if it is absent
+	PlannedDuration float64   // PLANNED-DURATION is the expected duration if the real one is not known yet
+	EndOnNext       bool      // END-ON-NEXT=YES means the range ends at the start of the next range of the same class
+	SCTE35Cmd       string    // SCTE35-CMD is hexadecimal sequence of splice_info_section
+	SCTE35Out       string    // SCTE35-OUT is hexadecimal sequence of splice_info_section with out of network indicator
+	SCTE35In        string    // SCTE35-IN is hexadecimal sequence of splice_info_section returning to the network
+	vars            *varRefs
+	// X is the map of client-defined attributes with X- prefix. Values are
+	// kept as they appear in the playlist: quoted strings with their
+	// double quotes, hexadecimal sequences and decimal floats as is.
+	X map[string]string
 }
 
 // SCTE holds custom, non EXT-X-DATERANGE, SCTE-35 tags
@@ -227,6 +339,56 @@ type SCTE struct {
 	Elapsed float64
 }
 
+// ServerControl structure represents delivery directives supported
+// by the server for the media playlist (Low-Latency HLS). Durations
+// are in seconds, zero values are not displayed.
+//
+// Realizes EXT-X-SERVER-CONTROL tag.
+type ServerControl struct {
+	CanBlockReload    bool    // CAN-BLOCK-RELOAD=YES means the server supports blocking playlist reload
+	CanSkipUntil      float64 // CAN-SKIP-UNTIL is the skip boundary for playlist delta updates
+	CanSkipDateRanges bool    // CAN-SKIP-DATERANGES=YES means the server can skip older EXT-X-DATERANGE tags
+	HoldBack          float64 // HOLD-BACK is the minimum distance from the end of the playlist to start playback
+	PartHoldBack      float64 // PART-HOLD-BACK is the same as HOLD-BACK for playback in low-latency mode
+}
+
+// PreloadHint structure represents a resource the client should
+// request in advance to reduce latency of the playback (Low-Latency
+// HLS).
+//
+// Realizes EXT-X-PRELOAD-HINT tag.
+type PreloadHint struct {
+	Type   string // TYPE is PART or MAP
+	URI    string
+	Offset int64 // BYTERANGE-START is offset from the start of the file under URI
+	Limit  int64 // BYTERANGE-LENGTH is length in bytes, zero means the length is unknown
+	vars   *varRefs
+}
+
+// RenditionReport structure represents the last media sequence number
+// and partial segment of another rendition of the same master playlist
+// (Low-Latency HLS).
+//
+// Realizes EXT-X-RENDITION-REPORT tag.
+type RenditionReport struct {
+	URI      string
+	LastMSN  uint64 // LAST-MSN is media sequence number of the last segment of the rendition
+	LastPart *int64 // LAST-PART is index of the last partial segment, nil if it is absent
+	vars     *varRefs
+}
+
+// Skip structure represents segments skipped in a playlist delta
+// update (Low-Latency HLS). Skipped segments are not present in the
+// media playlist, they are the oldest segments of the playlist
+// starting from EXT-X-MEDIA-SEQUENCE.
+//
+// Realizes EXT-X-SKIP tag.
+type Skip struct {
+	SkippedSegments           uint64   // SKIPPED-SEGMENTS is the number of segments replaced by the tag
+	RecentlyRemovedDateRanges []string // RECENTLY-REMOVED-DATERANGES is the list of IDs of EXT-X-DATERANGE tags removed from the playlist
+	SkippedDateRanges         bool     // EXT-X-DATERANGE tags of the previous updates are skipped, RECENTLY-REMOVED-DATERANGES is displayed even if empty
+}
+
 // Key structure represents information about stream encryption.
 //
 // Realizes EXT-X-KEY tag.
@@ -236,6 +398,54 @@ type Key struct {
 	IV                string
 	Keyformat         string
 	Keyformatversions string
+	vars              *varRefs
+}
+
+// varRefs keeps raw values of the attributes of the tag with {$name}
+// variable references by attribute names, the raw URI line is kept by
+// "URI" name. The encoder writes raw values back while they expand to
+// the current values of the fields. It is referenced by pointer so the
+// structures stay comparable.
+type varRefs struct {
+	raw map[string]string
+}
+
+// Define structure represents a variable used for substitution of
+// {$name} references in URI lines and quoted-string attribute values.
+// Value of imported variables and variables taken from query
+// parameters is resolved on decoding, it stays empty when the source
+// of the value is unknown.
+//
+// Realizes EXT-X-DEFINE tag.
+type Define struct {
+	Name  string
+	Value string
+	Type  DefineType
+}
+
+// ContentSteering structure represents the reference to the content
+// steering manifest which tells clients which pathway (group of
+// variants, e.g. CDN) to use. The PATHWAY-ID is the pathway used
+// before the manifest is loaded.
+//
+// Realizes EXT-X-CONTENT-STEERING tag.
+type ContentSteering struct {
+	ServerURI string
+	PathwayID string
+	vars      *varRefs
+}
+
+// SessionData structure represents arbitrary session data carried by
+// a master playlist. Either Value or URI must be set.
+//
+// Realizes EXT-X-SESSION-DATA tag.
+type SessionData struct {
+	DataID   string // DATA-ID is reverse DNS identifier of the data (e.g. com.example.title)
+	Value    string
+	URI      string // URI of JSON (or raw data with FORMAT=RAW) resource
+	Format   string // FORMAT is JSON (default) or RAW, applies to URI only
+	Language string
+	vars     *varRefs
 }
 
 // Map structure represents specifies how to obtain the Media
@@ -251,6 +461,7 @@ type Map struct {
 	URI    string
 	Limit  int64 // <n> is length in bytes for the file under URI
 	Offset int64 // [@o] is offset from the start of the file under URI
+	vars   *varRefs
 }
 
 // WV structure represents metadata  for Google Widevine playlists.
@@ -321,9 +532,12 @@ type decodingState struct {
 	tagKey             bool
 	tagMap             bool
 	tagCustom          bool
+	tagGap             bool
+	segment            bool // at least one segment is decoded
 	programDateTime    time.Time
 	limit              int64
 	offset             int64
+	bitrate            int64
 	duration           float64
 	title              string
 	variant            *Variant
@@ -331,5 +545,16 @@ type decodingState struct {
 	xkey               *Key
 	xmap               *Map
 	scte               *SCTE
+	part               *PartialSegment
 	custom             map[string]CustomTag
+	customOrder        customOrder
+	unknownTag         bool            // the line is a tag not known to the decoder
+	orphanURI          bool            // the line is URI not described by a tag
+	errs               []error         // errors of the line ignored in non-strict mode
+	seenTags           map[string]bool // unique tags already decoded
+	unknownSegment     []string        // unrecognised lines kept for the next segment
+	unknownVariant     []string        // unrecognised lines kept for the next variant
+	timeParse          func(value string) (time.Time, error)
+	vars               map[string]string // values of the variables defined so far
+	refs               *varRefs          // raw values of the line with variable references
 }
@@ -0,0 +1,173 @@
+package m3u8
+
+/*
+ Part of M3U8 parser & generator library.
+ This file defines resolving of playlist URIs against base URLs.
+
+ Copyright 2013-2019 The Project Developers.
+ See the AUTHORS and LICENSE files at the top-level directory of this distribution
+ and at https://github.com/grafov/m3u8/
+
+ ॐ तारे तुत्तारे तुरे स्व
+*/
+
+import (
+	"net/url"
+	"strings"
+)
+
+// ResolveURIs turns relative URIs of variants, alternatives, session
+// data, session keys and content steering server into absolute ones
+// resolved against the base URL. Absolute URIs are kept as is.
+func (p *MasterPlaylist) ResolveURIs(base *url.URL) {
+	p.rewriteURIs(resolveTo(base))
+}
+
+// RelativizeURIs turns absolute URIs of the master playlist into URIs
+// relative to the base URL. URIs of other hosts are kept as is. It is
+// reverse to ResolveURIs so the playlist may be moved to another
+// location with ResolveURIs and RelativizeURIs.
+func (p *MasterPlaylist) RelativizeURIs(base *url.URL) {
+	p.rewriteURIs(relativeTo(base))
+}
+
+// ResolveURIs turns relative URIs of segments, keys, maps, partial
+// segments, preload hints and rendition reports into absolute ones
+// resolved against the base URL. Absolute URIs are kept as is.
+func (p *MediaPlaylist) ResolveURIs(base *url.URL) {
+	p.rewriteURIs(resolveTo(base))
+}
+
+// RelativizeURIs turns absolute URIs of the media playlist into URIs
+// relative to the base URL. URIs of other hosts are kept as is. It is
+// reverse to ResolveURIs.
+func (p *MediaPlaylist) RelativizeURIs(base *url.URL) {
+	p.rewriteURIs(relativeTo(base))
+}
+
+// Rewrite all URIs of the master playlist.
+func (p *MasterPlaylist) rewriteURIs(rewrite func(string) string) {
+	for _, v := range p.Variants {
+		v.URI = rewrite(v.URI)
+		for _, alt := range v.Alternatives {
+			alt.URI = rewrite(alt.URI)
+		}
+	}
+	for _, sd := range p.SessionData {
+		sd.URI = rewrite(sd.URI)
+	}
+	for _, key := range p.SessionKeys {
+		key.URI = rewrite(key.URI)
+	}
+	if p.ContentSteering != nil {
+		p.ContentSteering.ServerURI = rewrite(p.ContentSteering.ServerURI)
+	}
+	p.buf.Reset()
+}
+
+// Rewrite all URIs of the media segment.
+func (seg *MediaSegment) rewriteURIs(rewrite func(string) string) {
+	seg.URI = rewrite(seg.URI)
+	if seg.Key != nil {
+		seg.Key.URI = rewrite(seg.Key.URI)
+	}
+	if seg.Map != nil {
+		seg.Map.URI = rewrite(seg.Map.URI)
+	}
+	for _, part := range seg.Parts {
+		part.URI = rewrite(part.URI)
+	}
+}
+
+// Rewrite all URIs of the media playlist.
+func (p *MediaPlaylist) rewriteURIs(rewrite func(string) string) {
+	if p.Key != nil {
+		p.Key.URI = rewrite(p.Key.URI)
+	}
+	if p.Map != nil {
+		p.Map.URI = rewrite(p.Map.URI)
+	}
+	for _, seg := range p.Segments {
+		if seg != nil {
+			seg.rewriteURIs(rewrite)
+		}
+	}
+	for _, part := range p.PendingParts {
+		part.URI = rewrite(part.URI)
+	}
+	for _, hint := range p.PreloadHints {
+		hint.URI = rewrite(hint.URI)
+	}
+	for _, report := range p.RenditionReports {
+		report.URI = rewrite(report.URI)
+	}
+	p.buf.Reset()
+}
+
+// resolveTo returns the function resolving URI references against the
+// base URL. Empty and invalid URIs are kept as is.
+func resolveTo(base *url.URL) func(string) string {
+	return func(uri string) string {
+		if uri == "" {
+			return uri
+		}
+		ref, err := url.Parse(uri)
+		if err != nil {
+			return uri
+		}
+		return base.ResolveReference(ref).String()
+	}
+}
+
+// relativeTo returns the function making absolute URIs relative to the
+// base URL. Relative URIs, URIs with other scheme, host or user info
+// and URIs which can't be relativized are kept as is.
+func relativeTo(base *url.URL) func(string) string {
+	return func(uri string) string {
+		target, err := url.Parse(uri)
+		if err != nil || !target.IsAbs() || target.Opaque != "" || base.Opaque != "" {
+			return uri
+		}
+		if !strings.EqualFold(target.Scheme, base.Scheme) || !strings.EqualFold(target.Host, base.Host) || target.User.String() != base.User.String() {
+			return uri
+		}
+		ref := relativePath(base.EscapedPath(), target.EscapedPath())
+		if target.RawQuery != "" || target.ForceQuery {
+			ref += "?" + target.RawQuery
+		}
+		if target.Fragment != "" {
+			ref += "#" + target.EscapedFragment()
+		}
+		// the reference must point to the same URI after resolving
+		resolved, err := url.Parse(ref)
+		if err != nil {
+			return uri
+		}
+		if resolved = base.ResolveReference(resolved); resolved.EscapedPath() != target.EscapedPath() || resolved.RawQuery != target.RawQuery || resolved.Fragment != target.Fragment {
+			return uri
+		}
+		return ref
+	}
+}
+
+// relativePath returns the path of the target relative to the directory
+// of the base path.
+func relativePath(base, target string) string {
+	if !strings.HasPrefix(target, "/") {
+		target = "/" + target
+	}
+	baseDirs := strings.Split(base[:strings.LastIndex(base, "/")+1], "/")
+	targetDirs := strings.Split(target, "/")
+	baseDirs = baseDirs[:len(baseDirs)-1] // the file name of the base
+	var i int
+	for i < len(baseDirs) && i < len(targetDirs)-1 && baseDirs[i] == targetDirs[i] {
+		i++
+	}
+	ref := strings.Repeat("../", len(baseDirs)-i) + strings.Join(targetDirs[i:], "/")
+	if ref == "" || strings.Contains(strings.SplitN(ref, "/", 2)[0], ":") {
+		// keep the reference to the directory and prevent treating
+		// the first segment as a scheme
+		ref = "./" + ref
+	}
+	return ref
+}
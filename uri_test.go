@@ -0,0 +1,123 @@
+package m3u8
+
+/*
+ Playlist URI resolving tests.
+
+ Copyright 2013-2019 The Project Developers.
+ See the AUTHORS and LICENSE files at the top-level directory of this distribution
+ and at https://github.com/grafov/m3u8/
+
+ ॐ तारे तुत्तारे तुरे स्व
+*/
+
+import (
+	"bufio"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMasterPlaylistResolveURIs(t *testing.T) {
+	f, err := os.Open("sample-playlists/master-with-alternatives.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewMasterPlaylist()
+	if err = p.DecodeFrom(bufio.NewReader(f), true); err != nil {
+		t.Fatal(err)
+	}
+	source := p.String()
+
+	base, _ := url.Parse("https://cdn1.example.com/live/master.m3u8")
+	p.ResolveURIs(base)
+	for _, v := range p.Variants {
+		if !strings.HasPrefix(v.URI, "https://cdn1.example.com/live/") {
+			t.Errorf("Expected absolute URI of the variant, got %s", v.URI)
+		}
+		for _, alt := range v.Alternatives {
+			if alt.URI != "" && !strings.HasPrefix(alt.URI, "https://cdn1.example.com/live/") {
+				t.Errorf("Expected absolute URI of the alternative, got %s", alt.URI)
+			}
+		}
+	}
+	if p.String() == source {
+		t.Error("Expected changed playlist after resolving")
+	}
+	p.RelativizeURIs(base)
+	if p.String() != source {
+		t.Errorf("Expected the source playlist after relativizing, got:\n%s", p)
+	}
+}
+
+func TestMediaPlaylistRelocation(t *testing.T) {
+	playlist := `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-TARGETDURATION:10
+#EXT-X-KEY:METHOD=AES-128,URI="../keys/key1"
+#EXT-X-MAP:URI="init.mp4"
+#EXTINF:10.000,
+seg0.ts
+#EXTINF:10.000,
+http://other.example.com/seg1.ts
+#EXTINF:10.000,
+media/seg2.ts?token=42
+#EXT-X-ENDLIST
+`
+	p, _ := NewMediaPlaylist(3, 3)
+	if err := p.DecodeFrom(strings.NewReader(playlist), true); err != nil {
+		t.Fatal(err)
+	}
+	source := p.String()
+	cdn1, _ := url.Parse("https://cdn1.example.com/vod/movie/index.m3u8")
+	cdn2, _ := url.Parse("https://cdn2.example.com/index.m3u8")
+	p.ResolveURIs(cdn1)
+	for i, expected := range []string{
+		"https://cdn1.example.com/vod/movie/seg0.ts",
+		"http://other.example.com/seg1.ts",
+		"https://cdn1.example.com/vod/movie/media/seg2.ts?token=42",
+	} {
+		if p.Segments[i].URI != expected {
+			t.Errorf("Expected %s, got %s", expected, p.Segments[i].URI)
+		}
+	}
+	if p.Key.URI != "https://cdn1.example.com/vod/keys/key1" {
+		t.Errorf("Unexpected URI of the key: %s", p.Key.URI)
+	}
+	if p.Map.URI != "https://cdn1.example.com/vod/movie/init.mp4" {
+		t.Errorf("Unexpected URI of the map: %s", p.Map.URI)
+	}
+
+	p.RelativizeURIs(cdn1)
+	if p.String() != source {
+		t.Errorf("Expected the source playlist after relativizing, got:\n%s", p)
+	}
+
+	// moving to another CDN keeps the relative URIs working
+	p.ResolveURIs(cdn2)
+	if p.Segments[0].URI != "https://cdn2.example.com/seg0.ts" || p.Key.URI != "https://cdn2.example.com/keys/key1" {
+		t.Errorf("Unexpected URIs after relocation: %s, %s", p.Segments[0].URI, p.Key.URI)
+	}
+}
+
+func TestRelativeTo(t *testing.T) {
+	base, _ := url.Parse("https://example.com/a/b/index.m3u8")
+	for uri, expected := range map[string]string{
+		"https://example.com/a/b/seg.ts":      "seg.ts",
+		"https://EXAMPLE.com/a/b/c/seg.ts":    "c/seg.ts",
+		"https://example.com/a/seg.ts":        "../seg.ts",
+		"https://example.com/x/y/seg.ts":      "../../x/y/seg.ts",
+		"https://example.com/a/b/":            "./",
+		"https://example.com/a/b/seg:1.ts":    "./seg:1.ts",
+		"https://example.com/a/b/seg.ts?x=1":  "seg.ts?x=1",
+		"https://example.com/a/b/seg.ts#t=10": "seg.ts#t=10",
+		"http://example.com/a/b/seg.ts":       "http://example.com/a/b/seg.ts",
+		"https://other.com/a/b/seg.ts":        "https://other.com/a/b/seg.ts",
+		"seg.ts":                              "seg.ts",
+		"":                                    "",
+	} {
+		if ref := relativeTo(base)(uri); ref != expected {
+			t.Errorf("Expected %q for %q, got %q", expected, uri, ref)
+		}
+	}
+}
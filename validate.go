@@ -0,0 +1,191 @@
+package m3u8
+
+/*
+ Part of M3U8 parser & generator library.
+ This file defines validation of playlists against requirements of the
+ HLS specification.
+
+ Copyright 2013-2019 The Project Developers.
+ See the AUTHORS and LICENSE files at the top-level directory of this distribution
+ and at https://github.com/grafov/m3u8/
+
+ ॐ तारे तुत्तारे तुरे स्व
+*/
+
+import (
+	"fmt"
+	"math"
+)
+
+// Severity is the level of a violation of the specification.
+type Severity uint
+
+const (
+	// use 0 for not defined severity
+	SeverityWarning Severity = iota + 1 // violation of SHOULD requirement, clients may play the playlist
+	SeverityError                       // violation of MUST requirement
+)
+
+// Identifiers of the rules checked by Validate.
+const (
+	RuleTargetDuration    = "target-duration"     // EXTINF duration rounded to integer exceeds EXT-X-TARGETDURATION
+	RuleVODWithoutEndlist = "vod-without-endlist" // VOD playlist is not closed by EXT-X-ENDLIST
+	RuleSlidingWindow     = "sliding-window"      // EVENT or VOD playlist drops segments out of the window
+	RuleBandwidth         = "bandwidth"           // BANDWIDTH is required for variants
+	RuleCodecs            = "codecs"              // CODECS should be present for variants
+	RuleGroupReference    = "group-reference"     // group referenced by variant has no renditions
+	RuleDuplicateName     = "duplicate-name"      // renditions of the same group have the same NAME
+)
+
+// Violation structure represents a requirement of the specification
+// violated by a playlist. Segment is the index of the segment in
+// GetAllSegments of media playlist and Variant is the index of the
+// variant in Variants of master playlist, they are -1 when the
+// violation is not related to a segment or a variant.
+type Violation struct {
+	Rule     string
+	Section  string // section of RFC 8216
+	Segment  int
+	Variant  int
+	Severity Severity
+	Message  string
+}
+
+// String returns name of the severity level.
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return "unknown"
+}
+
+// Error returns description of the violation, it allows to use the
+// violation as an error.
+func (v *Violation) Error() string {
+	var position string
+	switch {
+	case v.Segment >= 0:
+		position = fmt.Sprintf(" (segment %d)", v.Segment)
+	case v.Variant >= 0:
+		position = fmt.Sprintf(" (variant %d)", v.Variant)
+	}
+	return fmt.Sprintf("%s: %s [%s, section %s]%s", v.Severity, v.Message, v.Rule, v.Section, position)
+}
+
+// Validate checks the media playlist against requirements of the
+// specification and returns the list of violations. Only segments
+// displayed by Encode are checked.
+func (p *MediaPlaylist) Validate() []*Violation {
+	var violations []*Violation
+	add := func(rule, section string, segment int, severity Severity, format string, args ...interface{}) {
+		violations = append(violations, &Violation{
+			Rule:     rule,
+			Section:  section,
+			Segment:  segment,
+			Variant:  -1,
+			Severity: severity,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	// EXT-X-TARGETDURATION is written as integer rounded up
+	target := math.Ceil(p.TargetDuration)
+	head := p.head
+	count := p.count
+	for i, n := uint(0), 0; (i < p.winsize || p.winsize == 0) && count > 0; count-- {
+		seg := p.Segments[head]
+		head = (head + 1) % p.capacity
+		if seg == nil {
+			continue
+		}
+		if p.winsize > 0 {
+			i++
+		}
+		if math.Floor(seg.Duration+0.5) > target {
+			add(RuleTargetDuration, "4.3.3.1", n, SeverityError,
+				"EXTINF duration %v rounded to the nearest integer exceeds EXT-X-TARGETDURATION %v", seg.Duration, target)
+		}
+		n++
+	}
+	// EVENT playlist may be closed by EXT-X-ENDLIST at any time but
+	// segments of EVENT and VOD playlists are never removed
+	if p.MediaType == VOD && !p.Closed {
+		add(RuleVODWithoutEndlist, "4.3.3.5", -1, SeverityWarning,
+			"VOD playlist cannot change but EXT-X-ENDLIST is absent")
+	}
+	if (p.MediaType == EVENT || p.MediaType == VOD) && p.winsize > 0 && p.count > p.winsize {
+		add(RuleSlidingWindow, "4.3.3.5", -1, SeverityError,
+			"%d of %d segments are displayed but segments of %s playlist cannot be removed", p.winsize, p.count, mediaTypeNames[p.MediaType])
+	}
+	return violations
+}
+
+// Validate checks the master playlist against requirements of the
+// specification and returns the list of violations.
+func (p *MasterPlaylist) Validate() []*Violation {
+	var violations []*Violation
+	add := func(rule, section string, variant int, severity Severity, format string, args ...interface{}) {
+		violations = append(violations, &Violation{
+			Rule:     rule,
+			Section:  section,
+			Segment:  -1,
+			Variant:  variant,
+			Severity: severity,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	// renditions shared by variants are counted once, NAME must be
+	// unique in the group whatever the other attributes are
+	type group struct{ typ, id string }
+	groups := make(map[group]map[string]int)
+	seen := make(map[*Alternative]bool)
+	for i, v := range p.Variants {
+		for _, alt := range v.Alternatives {
+			if alt == nil || seen[alt] {
+				continue
+			}
+			seen[alt] = true
+			g := group{alt.Type, alt.GroupId}
+			if groups[g] == nil {
+				groups[g] = make(map[string]int)
+			}
+			groups[g][alt.Name]++
+			if groups[g][alt.Name] == 2 {
+				add(RuleDuplicateName, "4.3.4.1.1", i, SeverityError,
+					"renditions of %s group %q have the same NAME %q", alt.Type, alt.GroupId, alt.Name)
+			}
+		}
+	}
+
+	for i, v := range p.Variants {
+		section := "4.3.4.2"
+		if v.Iframe {
+			section = "4.3.4.3"
+		}
+		if v.Bandwidth == 0 {
+			add(RuleBandwidth, section, i, SeverityError, "BANDWIDTH attribute is required")
+		}
+		if v.Codecs == "" {
+			add(RuleCodecs, section, i, SeverityWarning, "CODECS attribute should be present")
+		}
+		for _, ref := range []struct{ typ, id string }{
+			{"AUDIO", v.Audio},
+			{"VIDEO", v.Video},
+			{"SUBTITLES", v.Subtitles},
+			{"CLOSED-CAPTIONS", v.Captions},
+		} {
+			if ref.id == "" || ref.typ == "CLOSED-CAPTIONS" && ref.id == "NONE" {
+				continue
+			}
+			if groups[group{ref.typ, ref.id}] == nil {
+				add(RuleGroupReference, "4.3.4.2", i, SeverityError,
+					"%s group %q has no EXT-X-MEDIA renditions", ref.typ, ref.id)
+			}
+		}
+	}
+	return violations
+}
@@ -0,0 +1,150 @@
+package m3u8
+
+/*
+ Playlist validation tests.
+
+ Copyright 2013-2019 The Project Developers.
+ See the AUTHORS and LICENSE files at the top-level directory of this distribution
+ and at https://github.com/grafov/m3u8/
+
+ ॐ तारे तुत्तारे तुरे स्व
+*/
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestValidateMediaPlaylist(t *testing.T) {
+	p, e := NewMediaPlaylist(3, 5)
+	if e != nil {
+		t.Fatalf("Create media playlist failed: %s", e)
+	}
+	p.Append("test01.ts", 10.4, "")
+	p.Append("test02.ts", 10.5, "")
+	p.Append("test03.ts", 9, "")
+	p.TargetDuration = 10 // Append raises it to the longest duration
+	p.MediaType = VOD
+	violations := p.Validate()
+	if len(violations) != 2 {
+		t.Fatalf("Expected 2 violations, got %d: %v", len(violations), violations)
+	}
+	v := violations[0]
+	if v.Rule != RuleTargetDuration || v.Section != "4.3.3.1" || v.Segment != 1 || v.Variant != -1 || v.Severity != SeverityError {
+		t.Errorf("Unexpected violation: %+v", v)
+	}
+	v = violations[1]
+	if v.Rule != RuleVODWithoutEndlist || v.Segment != -1 || v.Severity != SeverityWarning {
+		t.Errorf("Unexpected violation: %+v", v)
+	}
+	p.Close()
+	p.TargetDuration = 10.2 // written as 11
+	if violations = p.Validate(); len(violations) != 0 {
+		t.Errorf("Expected no violations, got %v", violations)
+	}
+}
+
+func TestValidatePlaylistType(t *testing.T) {
+	for _, c := range []struct {
+		mediaType MediaType
+		winsize   uint
+		closed    bool
+		expected  []string
+	}{
+		{EVENT, 0, false, nil},
+		{EVENT, 0, true, nil},
+		{EVENT, 2, false, []string{RuleSlidingWindow}},
+		{VOD, 0, false, []string{RuleVODWithoutEndlist}},
+		{VOD, 0, true, nil},
+		{VOD, 2, true, []string{RuleSlidingWindow}},
+		{VOD, 3, true, nil},
+		{0, 2, false, nil},
+	} {
+		p, _ := NewMediaPlaylist(c.winsize, 3)
+		for i := 0; i < 3; i++ {
+			p.Append(fmt.Sprintf("test%d.ts", i), 10, "")
+		}
+		p.MediaType = c.mediaType
+		p.Closed = c.closed
+		var rules []string
+		for _, v := range p.Validate() {
+			rules = append(rules, v.Rule)
+		}
+		if !reflect.DeepEqual(rules, c.expected) {
+			t.Errorf("Playlist type %d, window %d, closed %v: expected %v, got %v", c.mediaType, c.winsize, c.closed, c.expected, rules)
+		}
+	}
+}
+
+func TestValidateMasterPlaylist(t *testing.T) {
+	m := NewMasterPlaylist()
+	audio := []*Alternative{
+		{Type: "AUDIO", GroupId: "aac", Name: "English", Language: "en"},
+		{Type: "AUDIO", GroupId: "aac", Name: "English", Language: "en-GB"},
+	}
+	m.Append("low.m3u8", nil, VariantParams{Bandwidth: 1280000, Codecs: "avc1.4d401e,mp4a.40.2", Audio: "aac", Alternatives: audio})
+	m.Append("mid.m3u8", nil, VariantParams{Codecs: "avc1.4d401f,mp4a.40.2", Audio: "aac", Alternatives: audio, Subtitles: "subs"})
+	m.Append("iframe.m3u8", nil, VariantParams{Bandwidth: 86000, Iframe: true})
+	expected := []Violation{
+		{Rule: RuleDuplicateName, Section: "4.3.4.1.1", Segment: -1, Variant: 0, Severity: SeverityError},
+		{Rule: RuleBandwidth, Section: "4.3.4.2", Segment: -1, Variant: 1, Severity: SeverityError},
+		{Rule: RuleGroupReference, Section: "4.3.4.2", Segment: -1, Variant: 1, Severity: SeverityError},
+		{Rule: RuleCodecs, Section: "4.3.4.3", Segment: -1, Variant: 2, Severity: SeverityWarning},
+	}
+	violations := m.Validate()
+	if len(violations) != len(expected) {
+		t.Fatalf("Expected %d violations, got %d: %v", len(expected), len(violations), violations)
+	}
+	for i, v := range violations {
+		v.Message = ""
+		if *v != expected[i] {
+			t.Errorf("Violation %d\ngot: %+v\nexp: %+v", i, *v, expected[i])
+		}
+	}
+}
+
+func TestValidateDuplicateName(t *testing.T) {
+	m := NewMasterPlaylist()
+	audio := []*Alternative{
+		{Type: "AUDIO", GroupId: "aac", Name: "English", Language: "en", URI: "en-1.m3u8"},
+		{Type: "AUDIO", GroupId: "aac", Name: "English", Language: "en", URI: "en-2.m3u8"},
+		{Type: "AUDIO", GroupId: "ac3", Name: "English", Language: "en", URI: "en-3.m3u8"},
+	}
+	// the renditions are shared by both variants
+	m.Append("low.m3u8", nil, VariantParams{Bandwidth: 1280000, Codecs: "avc1.4d401e,mp4a.40.2", Audio: "aac", Alternatives: audio})
+	m.Append("mid.m3u8", nil, VariantParams{Bandwidth: 2560000, Codecs: "avc1.4d401f,mp4a.40.2", Audio: "aac", Alternatives: audio})
+	violations := m.Validate()
+	if len(violations) != 1 {
+		t.Fatalf("Expected 1 violation, got %d: %v", len(violations), violations)
+	}
+	if v := violations[0]; v.Rule != RuleDuplicateName || v.Variant != 0 {
+		t.Errorf("Unexpected violation: %+v", v)
+	}
+}
+
+func TestValidateDecodedMasterPlaylist(t *testing.T) {
+	f, err := os.Open("sample-playlists/master-with-alternatives.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewMasterPlaylist()
+	if err = p.DecodeFrom(bufio.NewReader(f), true); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range p.Validate() {
+		if v.Severity == SeverityError {
+			t.Errorf("Unexpected violation: %s", v)
+		}
+	}
+}
+
+func TestViolationError(t *testing.T) {
+	v := &Violation{Rule: RuleBandwidth, Section: "4.3.4.2", Segment: -1, Variant: 3, Severity: SeverityError, Message: "BANDWIDTH attribute is required"}
+	expected := "error: BANDWIDTH attribute is required [bandwidth, section 4.3.4.2] (variant 3)"
+	if v.Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, v.Error())
+	}
+}
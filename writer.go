@@ -16,6 +16,7 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -35,6 +36,126 @@ func strver(ver uint8) string {
 	return strconv.FormatUint(uint64(ver), 10)
 }
 
+// Write unrecognised tags and comments kept by the decoder.
+func writeUnknownTags(e *encoder, lines []string) {
+	for _, line := range lines {
+		if e.expand && len(e.vars) > 0 {
+			line, _, _ = substituteVariables(line, e.vars)
+		}
+		e.line(line)
+	}
+}
+
+// Write EXT-X-DEFINE tags of variables.
+func writeDefines(e *encoder, defines []*Define) {
+	for _, d := range defines {
+		e.begin("#EXT-X-DEFINE:", nil)
+		switch d.Type {
+		case DefineValue:
+			e.quoted("NAME", d.Name)
+			e.quoted("VALUE", d.Value)
+		case DefineImport:
+			e.quoted("IMPORT", d.Name)
+		case DefineQueryParam:
+			e.quoted("QUERYPARAM", d.Name)
+		}
+		e.end()
+	}
+}
+
+// Write EXT-X-DATERANGE tag.
+func writeDateRange(e *encoder, dr *DateRange) {
+	e.begin("#EXT-X-DATERANGE:", dr.vars)
+	e.quoted("ID", dr.ID)
+	if dr.Class != "" {
+		e.quoted("CLASS", dr.Class)
+	}
+	if !dr.StartDate.IsZero() {
+		e.quoted("START-DATE", dr.StartDate.Format(DATETIME))
+	}
+	if !dr.EndDate.IsZero() {
+		e.quoted("END-DATE", dr.EndDate.Format(DATETIME))
+	}
+	if dr.Duration != nil {
+		e.attr("DURATION", e.float(*dr.Duration, -1, 64))
+	}
+	if dr.PlannedDuration > 0 {
+		e.attr("PLANNED-DURATION", e.float(dr.PlannedDuration, -1, 64))
+	}
+	if dr.SCTE35Cmd != "" {
+		e.attr("SCTE35-CMD", dr.SCTE35Cmd)
+	}
+	if dr.SCTE35Out != "" {
+		e.attr("SCTE35-OUT", dr.SCTE35Out)
+	}
+	if dr.SCTE35In != "" {
+		e.attr("SCTE35-IN", dr.SCTE35In)
+	}
+	if dr.EndOnNext {
+		e.attr("END-ON-NEXT", "YES")
+	}
+	// client attributes sorted for the stable output
+	keys := make([]string, 0, len(dr.X))
+	for k := range dr.X {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		e.attr(k, dr.X[k]) // values keep their quotes
+	}
+	e.end()
+}
+
+// Write EXT-X-PART tag of Low-Latency HLS.
+func writePart(e *encoder, part *PartialSegment, args string) {
+	e.begin("#EXT-X-PART:", part.vars)
+	e.attr("DURATION", e.float(part.Duration, -1, 64))
+	if args != "" {
+		e.quoted("URI", e.value(part.vars, "URI", part.URI)+"?"+args)
+	} else {
+		e.quoted("URI", part.URI)
+	}
+	if part.Independent {
+		e.attr("INDEPENDENT", "YES")
+	}
+	if part.Limit > 0 {
+		e.quoted("BYTERANGE", strconv.FormatInt(part.Limit, 10)+"@"+strconv.FormatInt(part.Offset, 10))
+	}
+	if part.Gap {
+		e.attr("GAP", "YES")
+	}
+	e.end()
+}
+
+// Write EXT-X-KEY or EXT-X-SESSION-KEY tag.
+func writeKey(e *encoder, tag string, key *Key) {
+	e.begin(tag, key.vars)
+	e.attr("METHOD", key.Method)
+	if key.Method != "NONE" {
+		e.quoted("URI", key.URI)
+		if key.IV != "" {
+			e.attr("IV", key.IV)
+		}
+		if key.Keyformat != "" {
+			e.quoted("KEYFORMAT", key.Keyformat)
+		}
+		if key.Keyformatversions != "" {
+			e.quoted("KEYFORMATVERSIONS", key.Keyformatversions)
+		}
+	}
+	e.end()
+}
+
+// Write EXT-X-MAP tag.
+func writeMap(e *encoder, m *Map) {
+	e.begin("#EXT-X-MAP:", m.vars)
+	e.quoted("URI", m.URI)
+	if m.Limit > 0 {
+		e.attr("BYTERANGE", strconv.FormatInt(m.Limit, 10)+"@"+strconv.FormatInt(m.Offset, 10))
+	}
+	e.end()
+}
+
 // NewMasterPlaylist creates a new empty master playlist. Master
 // playlist consists of variants.
 func NewMasterPlaylist() *MasterPlaylist {
@@ -74,24 +195,64 @@ func (p *MasterPlaylist) Encode() *bytes.Buffer {
 	if p.buf.Len() > 0 {
 		return &p.buf
 	}
+	e := p.newEncoder(&p.buf, nil)
+	p.encode(e)
+	return &p.buf
+}
+
+// Encode the master playlist by parts flushed after each variant.
+func (p *MasterPlaylist) encode(e *encoder) {
+	buf := e.buf
 
-	p.buf.WriteString("#EXTM3U\n#EXT-X-VERSION:")
-	p.buf.WriteString(strver(p.ver))
-	p.buf.WriteRune('\n')
+	e.line("#EXTM3U")
+	e.line("#EXT-X-VERSION:" + strver(p.Version()))
 
 	if p.IndependentSegments() {
-		p.buf.WriteString("#EXT-X-INDEPENDENT-SEGMENTS\n")
+		e.line("#EXT-X-INDEPENDENT-SEGMENTS")
+	}
+
+	if !p.expandVars {
+		writeDefines(e, p.Defines)
+	}
+
+	for _, sd := range p.SessionData {
+		e.begin("#EXT-X-SESSION-DATA:", sd.vars)
+		e.quoted("DATA-ID", sd.DataID)
+		if sd.Value != "" {
+			e.quoted("VALUE", sd.Value)
+		}
+		if sd.URI != "" {
+			e.quoted("URI", sd.URI)
+		}
+		if sd.Format != "" {
+			e.attr("FORMAT", sd.Format)
+		}
+		if sd.Language != "" {
+			e.quoted("LANGUAGE", sd.Language)
+		}
+		e.end()
+	}
+
+	for _, key := range p.SessionKeys {
+		writeKey(e, "#EXT-X-SESSION-KEY:", key)
+	}
+
+	if p.ContentSteering != nil {
+		e.begin("#EXT-X-CONTENT-STEERING:", p.ContentSteering.vars)
+		e.quoted("SERVER-URI", p.ContentSteering.ServerURI)
+		if p.ContentSteering.PathwayID != "" {
+			e.quoted("PATHWAY-ID", p.ContentSteering.PathwayID)
+		}
+		e.end()
 	}
 
 	// Write any custom master tags
-	if p.Custom != nil {
-		for _, v := range p.Custom {
-			if customBuf := v.Encode(); customBuf != nil {
-				p.buf.WriteString(customBuf.String())
-				p.buf.WriteRune('\n')
-			}
+	for _, v := range p.CustomTags() {
+		if customBuf := v.Encode(); customBuf != nil {
+			e.line(customBuf.String())
 		}
 	}
+	writeUnknownTags(e, p.UnknownTags)
 
 	altsWritten := make(map[string]bool)
 
@@ -105,185 +266,275 @@ func (p *MasterPlaylist) Encode() *bytes.Buffer {
 				}
 				altsWritten[altKey] = true
 
-				p.buf.WriteString("#EXT-X-MEDIA:")
+				e.begin("#EXT-X-MEDIA:", alt.vars)
 				if alt.Type != "" {
-					p.buf.WriteString("TYPE=") // Type should not be quoted
-					p.buf.WriteString(alt.Type)
+					e.attr("TYPE", alt.Type) // Type should not be quoted
 				}
 				if alt.GroupId != "" {
-					p.buf.WriteString(",GROUP-ID=\"")
-					p.buf.WriteString(alt.GroupId)
-					p.buf.WriteRune('"')
+					e.quoted("GROUP-ID", alt.GroupId)
 				}
 				if alt.Name != "" {
-					p.buf.WriteString(",NAME=\"")
-					p.buf.WriteString(alt.Name)
-					p.buf.WriteRune('"')
+					e.quoted("NAME", alt.Name)
 				}
-				p.buf.WriteString(",DEFAULT=")
 				if alt.Default {
-					p.buf.WriteString("YES")
+					e.attr("DEFAULT", "YES")
 				} else {
-					p.buf.WriteString("NO")
+					e.attr("DEFAULT", "NO")
 				}
 				if alt.Autoselect != "" {
-					p.buf.WriteString(",AUTOSELECT=")
-					p.buf.WriteString(alt.Autoselect)
+					e.attr("AUTOSELECT", alt.Autoselect)
 				}
 				if alt.Language != "" {
-					p.buf.WriteString(",LANGUAGE=\"")
-					p.buf.WriteString(alt.Language)
-					p.buf.WriteRune('"')
+					e.quoted("LANGUAGE", alt.Language)
+				}
+				if alt.AssocLanguage != "" {
+					e.quoted("ASSOC-LANGUAGE", alt.AssocLanguage)
 				}
 				if alt.Forced != "" {
-					p.buf.WriteString(",FORCED=\"")
-					p.buf.WriteString(alt.Forced)
-					p.buf.WriteRune('"')
+					e.quoted("FORCED", alt.Forced)
+				}
+				if alt.InstreamId != "" {
+					e.quoted("INSTREAM-ID", alt.InstreamId)
 				}
 				if alt.Characteristics != "" {
-					p.buf.WriteString(",CHARACTERISTICS=\"")
-					p.buf.WriteString(alt.Characteristics)
-					p.buf.WriteRune('"')
+					e.quoted("CHARACTERISTICS", alt.Characteristics)
+				}
+				if alt.Channels != nil {
+					e.quoted("CHANNELS", alt.Channels.String())
+				}
+				if alt.BitDepth != 0 {
+					e.attr("BIT-DEPTH", strconv.FormatUint(uint64(alt.BitDepth), 10))
+				}
+				if alt.SampleRate != 0 {
+					e.attr("SAMPLE-RATE", strconv.FormatUint(uint64(alt.SampleRate), 10))
 				}
 				if alt.Subtitles != "" {
-					p.buf.WriteString(",SUBTITLES=\"")
-					p.buf.WriteString(alt.Subtitles)
-					p.buf.WriteRune('"')
+					e.quoted("SUBTITLES", alt.Subtitles)
 				}
 				if alt.URI != "" {
-					p.buf.WriteString(",URI=\"")
-					p.buf.WriteString(alt.URI)
-					p.buf.WriteRune('"')
+					e.quoted("URI", alt.URI)
+				}
+				if alt.StableRenditionID != "" {
+					e.quoted("STABLE-RENDITION-ID", alt.StableRenditionID)
 				}
-				p.buf.WriteRune('\n')
+				e.end()
 			}
 		}
+		writeUnknownTags(e, pl.UnknownTags)
 		if pl.Iframe {
-			p.buf.WriteString("#EXT-X-I-FRAME-STREAM-INF:PROGRAM-ID=")
-			p.buf.WriteString(strconv.FormatUint(uint64(pl.ProgramId), 10))
-			p.buf.WriteString(",BANDWIDTH=")
-			p.buf.WriteString(strconv.FormatUint(uint64(pl.Bandwidth), 10))
-			if pl.AverageBandwidth != 0 {
-				p.buf.WriteString(",AVERAGE-BANDWIDTH=")
-				p.buf.WriteString(strconv.FormatUint(uint64(pl.AverageBandwidth), 10))
-			}
-			if pl.Codecs != "" {
-				p.buf.WriteString(",CODECS=\"")
-				p.buf.WriteString(pl.Codecs)
-				p.buf.WriteRune('"')
-			}
-			if pl.Resolution != "" {
-				p.buf.WriteString(",RESOLUTION=") // Resolution should not be quoted
-				p.buf.WriteString(pl.Resolution)
+			e.begin("#EXT-X-I-FRAME-STREAM-INF:", pl.vars)
+		} else {
+			e.begin("#EXT-X-STREAM-INF:", pl.vars)
+		}
+		e.attr("PROGRAM-ID", strconv.FormatUint(uint64(pl.ProgramId), 10))
+		e.attr("BANDWIDTH", strconv.FormatUint(uint64(pl.Bandwidth), 10))
+		if pl.AverageBandwidth != 0 {
+			e.attr("AVERAGE-BANDWIDTH", strconv.FormatUint(uint64(pl.AverageBandwidth), 10))
+		}
+		if pl.Score != 0 {
+			e.attr("SCORE", e.float(pl.Score, -1, 64))
+		}
+		if pl.Codecs != "" {
+			e.quoted("CODECS", pl.Codecs)
+		}
+		if pl.SupplementalCodecs != "" {
+			e.quoted("SUPPLEMENTAL-CODECS", pl.SupplementalCodecs)
+		}
+		if pl.Resolution != "" {
+			e.attr("RESOLUTION", pl.Resolution) // Resolution should not be quoted
+		}
+		if pl.Iframe {
+			if pl.FrameRate != 0 {
+				e.attr("FRAME-RATE", e.float(pl.FrameRate, 3, 64))
 			}
 			if pl.Video != "" {
-				p.buf.WriteString(",VIDEO=\"")
-				p.buf.WriteString(pl.Video)
-				p.buf.WriteRune('"')
-			}
-			if pl.VideoRange != "" {
-				p.buf.WriteString(",VIDEO-RANGE=")
-				p.buf.WriteString(pl.VideoRange)
-			}
-			if pl.HDCPLevel != "" {
-				p.buf.WriteString(",HDCP-LEVEL=")
-				p.buf.WriteString(pl.HDCPLevel)
+				e.quoted("VIDEO", pl.Video)
 			}
-			if pl.URI != "" {
-				p.buf.WriteString(",URI=\"")
-				p.buf.WriteString(pl.URI)
-				p.buf.WriteRune('"')
-			}
-			p.buf.WriteRune('\n')
 		} else {
-			p.buf.WriteString("#EXT-X-STREAM-INF:PROGRAM-ID=")
-			p.buf.WriteString(strconv.FormatUint(uint64(pl.ProgramId), 10))
-			p.buf.WriteString(",BANDWIDTH=")
-			p.buf.WriteString(strconv.FormatUint(uint64(pl.Bandwidth), 10))
-			if pl.AverageBandwidth != 0 {
-				p.buf.WriteString(",AVERAGE-BANDWIDTH=")
-				p.buf.WriteString(strconv.FormatUint(uint64(pl.AverageBandwidth), 10))
-			}
-			if pl.Codecs != "" {
-				p.buf.WriteString(",CODECS=\"")
-				p.buf.WriteString(pl.Codecs)
-				p.buf.WriteRune('"')
-			}
-			if pl.Resolution != "" {
-				p.buf.WriteString(",RESOLUTION=") // Resolution should not be quoted
-				p.buf.WriteString(pl.Resolution)
-			}
 			if pl.Audio != "" {
-				p.buf.WriteString(",AUDIO=\"")
-				p.buf.WriteString(pl.Audio)
-				p.buf.WriteRune('"')
+				e.quoted("AUDIO", pl.Audio)
 			}
 			if pl.Video != "" {
-				p.buf.WriteString(",VIDEO=\"")
-				p.buf.WriteString(pl.Video)
-				p.buf.WriteRune('"')
+				e.quoted("VIDEO", pl.Video)
 			}
 			if pl.Captions != "" {
-				p.buf.WriteString(",CLOSED-CAPTIONS=")
 				if pl.Captions == "NONE" {
-					p.buf.WriteString(pl.Captions) // CC should not be quoted when eq NONE
+					e.attr("CLOSED-CAPTIONS", pl.Captions) // CC should not be quoted when eq NONE
 				} else {
-					p.buf.WriteRune('"')
-					p.buf.WriteString(pl.Captions)
-					p.buf.WriteRune('"')
+					e.quoted("CLOSED-CAPTIONS", pl.Captions)
 				}
 			}
 			if pl.Subtitles != "" {
-				p.buf.WriteString(",SUBTITLES=\"")
-				p.buf.WriteString(pl.Subtitles)
-				p.buf.WriteRune('"')
+				e.quoted("SUBTITLES", pl.Subtitles)
 			}
 			if pl.Name != "" {
-				p.buf.WriteString(",NAME=\"")
-				p.buf.WriteString(pl.Name)
-				p.buf.WriteRune('"')
+				e.quoted("NAME", pl.Name)
 			}
 			if pl.FrameRate != 0 {
-				p.buf.WriteString(",FRAME-RATE=")
-				p.buf.WriteString(strconv.FormatFloat(pl.FrameRate, 'f', 3, 64))
-			}
-			if pl.VideoRange != "" {
-				p.buf.WriteString(",VIDEO-RANGE=")
-				p.buf.WriteString(pl.VideoRange)
+				e.attr("FRAME-RATE", e.float(pl.FrameRate, 3, 64))
 			}
-			if pl.HDCPLevel != "" {
-				p.buf.WriteString(",HDCP-LEVEL=")
-				p.buf.WriteString(pl.HDCPLevel)
+		}
+		if pl.VideoRange != "" {
+			e.attr("VIDEO-RANGE", pl.VideoRange)
+		}
+		if pl.HDCPLevel != "" {
+			e.attr("HDCP-LEVEL", pl.HDCPLevel)
+		}
+		if pl.AllowedCPC != "" {
+			e.quoted("ALLOWED-CPC", pl.AllowedCPC)
+		}
+		if pl.ReqVideoLayout != "" {
+			e.quoted("REQ-VIDEO-LAYOUT", pl.ReqVideoLayout)
+		}
+		if pl.PathwayID != "" {
+			e.quoted("PATHWAY-ID", pl.PathwayID)
+		}
+		if pl.StableVariantID != "" {
+			e.quoted("STABLE-VARIANT-ID", pl.StableVariantID)
+		}
+		if pl.Iframe {
+			if pl.URI != "" {
+				e.quoted("URI", pl.URI)
 			}
-
-			p.buf.WriteRune('\n')
-			p.buf.WriteString(pl.URI)
+			e.end()
+		} else {
+			e.end()
+			buf.WriteString(e.value(pl.vars, "URI", pl.URI))
 			if p.Args != "" {
 				if strings.Contains(pl.URI, "?") {
-					p.buf.WriteRune('&')
+					buf.WriteRune('&')
 				} else {
-					p.buf.WriteRune('?')
+					buf.WriteRune('?')
 				}
-				p.buf.WriteString(p.Args)
+				buf.WriteString(p.Args)
 			}
-			p.buf.WriteRune('\n')
+			e.newline()
 		}
+		e.flush()
 	}
+	writeUnknownTags(e, p.TrailingTags)
+	e.flush()
+}
 
-	return &p.buf
+// AppendDefine appends variable definition to the master playlist.
+// Value of QUERYPARAM variable is taken from query parameters set by
+// SetQueryParams if it is empty. IMPORT is not allowed in master
+// playlists. This operation does reset playlist cache.
+func (p *MasterPlaylist) AppendDefine(d *Define) error {
+	if d.Type == DefineImport {
+		return errors.New("EXT-X-DEFINE IMPORT is not allowed in master playlist")
+	}
+	if err := checkDefine(p.Defines, d); err != nil {
+		return err
+	}
+	if d.Type == DefineQueryParam {
+		if d.Value == "" {
+			d.Value = p.query.Get(d.Name)
+		}
+		version(&p.ver, 11)
+	}
+	version(&p.ver, 8)
+	p.Defines = append(p.Defines, d)
+	p.buf.Reset()
+	return nil
+}
+
+// ExpandVariables sets whether variable references are expanded on
+// Encode. By default fields decoded from values with {$name}
+// references are written back as the references together with
+// EXT-X-DEFINE tags unless the fields are changed. With expanding
+// EXT-X-DEFINE tags are omitted and all references are replaced by
+// values of the variables.
+func (p *MasterPlaylist) ExpandVariables(yes bool) {
+	p.expandVars = yes
+	p.buf.Reset()
+}
+
+// String returns value of CHANNELS attribute.
+func (c *Channels) String() string {
+	value := strconv.FormatUint(uint64(c.Count), 10)
+	if len(c.Spatial) == 0 && len(c.Usage) == 0 {
+		return value
+	}
+	if len(c.Spatial) > 0 {
+		value += "/" + strings.Join(c.Spatial, ",")
+	} else {
+		value += "/-"
+	}
+	if len(c.Usage) > 0 {
+		value += "/" + strings.Join(c.Usage, ",")
+	}
+	return value
 }
 
-// SetCustomTag sets the provided tag on the master playlist for its TagName
+// SetContentSteering sets the URI of the content steering manifest
+// and the pathway used by clients until the manifest is loaded. This
+// operation does reset playlist cache.
+func (p *MasterPlaylist) SetContentSteering(serverURI, pathwayID string) {
+	p.ContentSteering = &ContentSteering{ServerURI: serverURI, PathwayID: pathwayID}
+	p.buf.Reset()
+}
+
+// AppendSessionData appends session data to the master playlist. This
+// operation does reset playlist cache.
+func (p *MasterPlaylist) AppendSessionData(sd *SessionData) error {
+	if err := sd.Validate(); err != nil {
+		return err
+	}
+	p.SessionData = append(p.SessionData, sd)
+	p.buf.Reset()
+	return nil
+}
+
+// Validate checks that session data conforms to EXT-X-SESSION-DATA
+// requirements: DATA-ID is required and exactly one of VALUE and URI
+// must be present.
+func (sd *SessionData) Validate() error {
+	if sd.DataID == "" {
+		return errors.New("EXT-X-SESSION-DATA requires DATA-ID attribute")
+	}
+	if (sd.Value == "") == (sd.URI == "") {
+		return errors.New("EXT-X-SESSION-DATA must contain either VALUE or URI attribute")
+	}
+	if sd.Format != "" && sd.URI == "" {
+		return errors.New("EXT-X-SESSION-DATA FORMAT attribute is allowed only with URI")
+	}
+	return nil
+}
+
+// AppendSessionKey appends encryption key of media playlists to the
+// master playlist so clients can preload it. The method NONE is not
+// allowed for EXT-X-SESSION-KEY. This operation does reset playlist
+// cache.
+func (p *MasterPlaylist) AppendSessionKey(method, uri, iv, keyformat, keyformatversions string) error {
+	if method == "" || method == "NONE" {
+		return errors.New("EXT-X-SESSION-KEY METHOD must not be NONE")
+	}
+	if uri == "" {
+		return errors.New("EXT-X-SESSION-KEY requires URI attribute")
+	}
+	p.SessionKeys = append(p.SessionKeys, &Key{Method: method, URI: uri, IV: iv, Keyformat: keyformat, Keyformatversions: keyformatversions})
+	p.buf.Reset()
+	return nil
+}
+
+// SetCustomTag sets the provided tag on the master playlist for its
+// TagName. New tags are encoded after the tags set before, a replaced
+// tag keeps its position.
 func (p *MasterPlaylist) SetCustomTag(tag CustomTag) {
 	if p.Custom == nil {
 		p.Custom = make(map[string]CustomTag)
 	}
 
-	p.Custom[tag.TagName()] = tag
+	p.customOrder.set(p.Custom, tag.TagName(), tag)
 }
 
-// Version returns the current playlist version number
+// Version returns the current playlist version number or the
+// minimum compatible version if SetAutoVersion is set.
 func (p *MasterPlaylist) Version() uint8 {
+	if p.autoVersion {
+		return p.MinVersion()
+	}
 	return p.ver
 }
 
@@ -293,6 +544,36 @@ func (p *MasterPlaylist) SetVersion(ver uint8) {
 	p.ver = ver
 }
 
+// SetAutoVersion sets whether Encode writes the minimum protocol
+// version computed by MinVersion instead of the version set by
+// SetVersion and other Set methods.
+func (p *MasterPlaylist) SetAutoVersion(yes bool) {
+	p.autoVersion = yes
+	p.buf.Reset()
+}
+
+// MinVersion computes the minimum protocol version compatible with
+// the features used by the master playlist (section 8 of the HLS
+// specification).
+func (p *MasterPlaylist) MinVersion() uint8 {
+	ver := uint8(1)
+	defineVersion(&ver, p.Defines)
+	for _, v := range p.Variants {
+		if v.Iframe {
+			version(&ver, 4) // EXT-X-I-FRAME-STREAM-INF
+		}
+		if v.ReqVideoLayout != "" {
+			version(&ver, 12) // REQ- attributes
+		}
+		for _, alt := range v.Alternatives {
+			if strings.HasPrefix(alt.InstreamId, "SERVICE") {
+				version(&ver, 7)
+			}
+		}
+	}
+	return ver
+}
+
 // IndependentSegments returns true if all media samples in a segment can be
 // decoded without information from other buf.
 func (p *MasterPlaylist) IndependentSegments() bool {
@@ -365,7 +646,18 @@ func (p *MediaPlaylist) AppendSegment(seg *MediaSegment) error {
 	if p.head == p.tail && p.count > 0 {
 		return ErrPlaylistFull
 	}
+	if seg.Parts == nil && len(p.PendingParts) > 0 {
+		seg.Parts = p.PendingParts
+		p.PendingParts = nil
+	}
+	if seg.DateRanges == nil && len(p.PendingDateRanges) > 0 {
+		seg.DateRanges = p.PendingDateRanges
+		p.PendingDateRanges = nil
+	}
 	seg.SeqId = p.SeqNo
+	if p.Skip != nil {
+		seg.SeqId += p.Skip.SkippedSegments
+	}
 	if p.count > 0 {
 		seg.SeqId = p.Segments[(p.capacity+p.tail-1)%p.capacity].SeqId + 1
 	}
@@ -379,6 +671,52 @@ func (p *MediaPlaylist) AppendSegment(seg *MediaSegment) error {
 	return nil
 }
 
+// AppendPart appends a partial segment (EXT-X-PART) of the media
+// segment which is not completed yet. Pending parts displayed after
+// the last segment of the playlist and they are linked to the next
+// segment added by Append or AppendSegment. This operation does reset
+// playlist cache.
+func (p *MediaPlaylist) AppendPart(part *PartialSegment) {
+	p.PendingParts = append(p.PendingParts, part)
+	p.buf.Reset()
+}
+
+// SetPreloadHint sets EXT-X-PRELOAD-HINT of the resource expected
+// next at the live edge. The playlist may contain only one hint of each
+// type (PART or MAP) so the hint of the same type is replaced. This
+// operation does reset playlist cache.
+func (p *MediaPlaylist) SetPreloadHint(hintType, uri string, offset, limit int64) {
+	p.buf.Reset()
+	for _, hint := range p.PreloadHints {
+		if hint.Type == hintType {
+			hint.URI = uri
+			hint.Offset = offset
+			hint.Limit = limit
+			return
+		}
+	}
+	p.PreloadHints = append(p.PreloadHints, &PreloadHint{Type: hintType, URI: uri, Offset: offset, Limit: limit})
+}
+
+// SetRenditionReport adds or updates EXT-X-RENDITION-REPORT for the
+// rendition under URI. Pass negative lastPart if the rendition has
+// no partial segments. This operation does reset playlist cache.
+func (p *MediaPlaylist) SetRenditionReport(uri string, lastMSN uint64, lastPart int64) {
+	p.buf.Reset()
+	var part *int64
+	if lastPart >= 0 {
+		part = &lastPart
+	}
+	for _, report := range p.RenditionReports {
+		if report.URI == uri {
+			report.LastMSN = lastMSN
+			report.LastPart = part
+			return
+		}
+	}
+	p.RenditionReports = append(p.RenditionReports, &RenditionReport{URI: uri, LastMSN: lastMSN, LastPart: part})
+}
+
 // Slide combines two operations: firstly it removes one chunk from
 // the head of chunk slice and move pointer to next chunk. Secondly it
 // appends one chunk to the tail of chunk slice. Useful for sliding
@@ -402,169 +740,156 @@ func (p *MediaPlaylist) Encode() *bytes.Buffer {
 	if p.buf.Len() > 0 {
 		return &p.buf
 	}
+	e := p.newEncoder(&p.buf, nil)
+	p.encode(e)
+	return &p.buf
+}
+
+// Encode the media playlist by parts flushed after the header and
+// after each segment.
+func (p *MediaPlaylist) encode(e *encoder) {
+	buf := e.buf
 
-	p.buf.WriteString("#EXTM3U\n#EXT-X-VERSION:")
-	p.buf.WriteString(strver(p.ver))
-	p.buf.WriteRune('\n')
+	e.line("#EXTM3U")
+	e.line("#EXT-X-VERSION:" + strver(p.Version()))
+
+	if !p.expandVars {
+		writeDefines(e, p.Defines)
+	}
 
 	// Write any custom master tags
-	if p.Custom != nil {
-		for _, v := range p.Custom {
-			if customBuf := v.Encode(); customBuf != nil {
-				p.buf.WriteString(customBuf.String())
-				p.buf.WriteRune('\n')
-			}
+	for _, v := range p.CustomTags() {
+		if customBuf := v.Encode(); customBuf != nil {
+			e.line(customBuf.String())
 		}
 	}
 
 	// default key (workaround for Widevine)
 	if p.Key != nil {
-		p.buf.WriteString("#EXT-X-KEY:")
-		p.buf.WriteString("METHOD=")
-		p.buf.WriteString(p.Key.Method)
-		if p.Key.Method != "NONE" {
-			p.buf.WriteString(",URI=\"")
-			p.buf.WriteString(p.Key.URI)
-			p.buf.WriteRune('"')
-			if p.Key.IV != "" {
-				p.buf.WriteString(",IV=")
-				p.buf.WriteString(p.Key.IV)
-			}
-			if p.Key.Keyformat != "" {
-				p.buf.WriteString(",KEYFORMAT=\"")
-				p.buf.WriteString(p.Key.Keyformat)
-				p.buf.WriteRune('"')
-			}
-			if p.Key.Keyformatversions != "" {
-				p.buf.WriteString(",KEYFORMATVERSIONS=\"")
-				p.buf.WriteString(p.Key.Keyformatversions)
-				p.buf.WriteRune('"')
-			}
-		}
-		p.buf.WriteRune('\n')
+		writeKey(e, "#EXT-X-KEY:", p.Key)
 	}
 	if p.Map != nil {
-		p.buf.WriteString("#EXT-X-MAP:")
-		p.buf.WriteString("URI=\"")
-		p.buf.WriteString(p.Map.URI)
-		p.buf.WriteRune('"')
-		if p.Map.Limit > 0 {
-			p.buf.WriteString(",BYTERANGE=")
-			p.buf.WriteString(strconv.FormatInt(p.Map.Limit, 10))
-			p.buf.WriteRune('@')
-			p.buf.WriteString(strconv.FormatInt(p.Map.Offset, 10))
-		}
-		p.buf.WriteRune('\n')
+		writeMap(e, p.Map)
 	}
 	if p.MediaType > 0 {
-		p.buf.WriteString("#EXT-X-PLAYLIST-TYPE:")
 		switch p.MediaType {
 		case EVENT:
-			p.buf.WriteString("EVENT\n")
-			p.buf.WriteString("#EXT-X-ALLOW-CACHE:NO\n")
+			e.line("#EXT-X-PLAYLIST-TYPE:EVENT")
+			e.line("#EXT-X-ALLOW-CACHE:NO")
 		case VOD:
-			p.buf.WriteString("VOD\n")
+			e.line("#EXT-X-PLAYLIST-TYPE:VOD")
+		}
+	}
+	e.line("#EXT-X-MEDIA-SEQUENCE:" + strconv.FormatUint(p.SeqNo, 10))
+	e.line("#EXT-X-TARGETDURATION:" + strconv.FormatInt(int64(math.Ceil(p.TargetDuration)), 10)) // due section 3.4.2 of M3U8 specs EXT-X-TARGETDURATION must be integer
+	if p.ServerControl != nil {
+		e.begin("#EXT-X-SERVER-CONTROL:", nil)
+		if p.ServerControl.CanBlockReload {
+			e.attr("CAN-BLOCK-RELOAD", "YES")
+		}
+		if p.ServerControl.CanSkipUntil > 0 {
+			e.attr("CAN-SKIP-UNTIL", e.float(p.ServerControl.CanSkipUntil, -1, 64))
+			if p.ServerControl.CanSkipDateRanges {
+				e.attr("CAN-SKIP-DATERANGES", "YES")
+			}
+		}
+		if p.ServerControl.HoldBack > 0 {
+			e.attr("HOLD-BACK", e.float(p.ServerControl.HoldBack, -1, 64))
+		}
+		if p.ServerControl.PartHoldBack > 0 {
+			e.attr("PART-HOLD-BACK", e.float(p.ServerControl.PartHoldBack, -1, 64))
+		}
+		if len(e.attrs) > 0 {
+			e.end()
 		}
 	}
-	p.buf.WriteString("#EXT-X-MEDIA-SEQUENCE:")
-	p.buf.WriteString(strconv.FormatUint(p.SeqNo, 10))
-	p.buf.WriteRune('\n')
-	p.buf.WriteString("#EXT-X-TARGETDURATION:")
-	p.buf.WriteString(strconv.FormatInt(int64(math.Ceil(p.TargetDuration)), 10)) // due section 3.4.2 of M3U8 specs EXT-X-TARGETDURATION must be integer
-	p.buf.WriteRune('\n')
+	if p.PartTargetDuration > 0 {
+		e.begin("#EXT-X-PART-INF:", nil)
+		e.attr("PART-TARGET", e.float(p.PartTargetDuration, -1, 64))
+		e.end()
+	}
 	if p.StartTime > 0.0 {
-		p.buf.WriteString("#EXT-X-START:TIME-OFFSET=")
-		p.buf.WriteString(strconv.FormatFloat(p.StartTime, 'f', -1, 64))
+		e.begin("#EXT-X-START:", nil)
+		e.attr("TIME-OFFSET", e.float(p.StartTime, -1, 64))
 		if p.StartTimePrecise {
-			p.buf.WriteString(",PRECISE=YES")
+			e.attr("PRECISE", "YES")
 		}
-		p.buf.WriteRune('\n')
+		e.end()
 	}
 	if p.DiscontinuitySeq != 0 {
-		p.buf.WriteString("#EXT-X-DISCONTINUITY-SEQUENCE:")
-		p.buf.WriteString(strconv.FormatUint(uint64(p.DiscontinuitySeq), 10))
-		p.buf.WriteRune('\n')
+		e.line("#EXT-X-DISCONTINUITY-SEQUENCE:" + strconv.FormatUint(uint64(p.DiscontinuitySeq), 10))
 	}
 	if p.Iframe {
-		p.buf.WriteString("#EXT-X-I-FRAMES-ONLY\n")
+		e.line("#EXT-X-I-FRAMES-ONLY")
 	}
 	// Widevine tags
 	if p.WV != nil {
 		if p.WV.AudioChannels != 0 {
-			p.buf.WriteString("#WV-AUDIO-CHANNELS ")
-			p.buf.WriteString(strconv.FormatUint(uint64(p.WV.AudioChannels), 10))
-			p.buf.WriteRune('\n')
+			e.line("#WV-AUDIO-CHANNELS " + strconv.FormatUint(uint64(p.WV.AudioChannels), 10))
 		}
 		if p.WV.AudioFormat != 0 {
-			p.buf.WriteString("#WV-AUDIO-FORMAT ")
-			p.buf.WriteString(strconv.FormatUint(uint64(p.WV.AudioFormat), 10))
-			p.buf.WriteRune('\n')
+			e.line("#WV-AUDIO-FORMAT " + strconv.FormatUint(uint64(p.WV.AudioFormat), 10))
 		}
 		if p.WV.AudioProfileIDC != 0 {
-			p.buf.WriteString("#WV-AUDIO-PROFILE-IDC ")
-			p.buf.WriteString(strconv.FormatUint(uint64(p.WV.AudioProfileIDC), 10))
-			p.buf.WriteRune('\n')
+			e.line("#WV-AUDIO-PROFILE-IDC " + strconv.FormatUint(uint64(p.WV.AudioProfileIDC), 10))
 		}
 		if p.WV.AudioSampleSize != 0 {
-			p.buf.WriteString("#WV-AUDIO-SAMPLE-SIZE ")
-			p.buf.WriteString(strconv.FormatUint(uint64(p.WV.AudioSampleSize), 10))
-			p.buf.WriteRune('\n')
+			e.line("#WV-AUDIO-SAMPLE-SIZE " + strconv.FormatUint(uint64(p.WV.AudioSampleSize), 10))
 		}
 		if p.WV.AudioSamplingFrequency != 0 {
-			p.buf.WriteString("#WV-AUDIO-SAMPLING-FREQUENCY ")
-			p.buf.WriteString(strconv.FormatUint(uint64(p.WV.AudioSamplingFrequency), 10))
-			p.buf.WriteRune('\n')
+			e.line("#WV-AUDIO-SAMPLING-FREQUENCY " + strconv.FormatUint(uint64(p.WV.AudioSamplingFrequency), 10))
 		}
 		if p.WV.CypherVersion != "" {
-			p.buf.WriteString("#WV-CYPHER-VERSION ")
-			p.buf.WriteString(p.WV.CypherVersion)
-			p.buf.WriteRune('\n')
+			e.line("#WV-CYPHER-VERSION " + p.WV.CypherVersion)
 		}
 		if p.WV.ECM != "" {
-			p.buf.WriteString("#WV-ECM ")
-			p.buf.WriteString(p.WV.ECM)
-			p.buf.WriteRune('\n')
+			e.line("#WV-ECM " + p.WV.ECM)
 		}
 		if p.WV.VideoFormat != 0 {
-			p.buf.WriteString("#WV-VIDEO-FORMAT ")
-			p.buf.WriteString(strconv.FormatUint(uint64(p.WV.VideoFormat), 10))
-			p.buf.WriteRune('\n')
+			e.line("#WV-VIDEO-FORMAT " + strconv.FormatUint(uint64(p.WV.VideoFormat), 10))
 		}
 		if p.WV.VideoFrameRate != 0 {
-			p.buf.WriteString("#WV-VIDEO-FRAME-RATE ")
-			p.buf.WriteString(strconv.FormatUint(uint64(p.WV.VideoFrameRate), 10))
-			p.buf.WriteRune('\n')
+			e.line("#WV-VIDEO-FRAME-RATE " + strconv.FormatUint(uint64(p.WV.VideoFrameRate), 10))
 		}
 		if p.WV.VideoLevelIDC != 0 {
-			p.buf.WriteString("#WV-VIDEO-LEVEL-IDC")
-			p.buf.WriteString(strconv.FormatUint(uint64(p.WV.VideoLevelIDC), 10))
-			p.buf.WriteRune('\n')
+			e.line("#WV-VIDEO-LEVEL-IDC" + strconv.FormatUint(uint64(p.WV.VideoLevelIDC), 10))
 		}
 		if p.WV.VideoProfileIDC != 0 {
-			p.buf.WriteString("#WV-VIDEO-PROFILE-IDC ")
-			p.buf.WriteString(strconv.FormatUint(uint64(p.WV.VideoProfileIDC), 10))
-			p.buf.WriteRune('\n')
+			e.line("#WV-VIDEO-PROFILE-IDC " + strconv.FormatUint(uint64(p.WV.VideoProfileIDC), 10))
 		}
 		if p.WV.VideoResolution != "" {
-			p.buf.WriteString("#WV-VIDEO-RESOLUTION ")
-			p.buf.WriteString(p.WV.VideoResolution)
-			p.buf.WriteRune('\n')
+			e.line("#WV-VIDEO-RESOLUTION " + p.WV.VideoResolution)
 		}
 		if p.WV.VideoSAR != "" {
-			p.buf.WriteString("#WV-VIDEO-SAR ")
-			p.buf.WriteString(p.WV.VideoSAR)
-			p.buf.WriteRune('\n')
+			e.line("#WV-VIDEO-SAR " + p.WV.VideoSAR)
 		}
 	}
+	writeUnknownTags(e, p.UnknownTags)
+
+	if p.Skip != nil {
+		e.begin("#EXT-X-SKIP:", nil)
+		e.attr("SKIPPED-SEGMENTS", strconv.FormatUint(p.Skip.SkippedSegments, 10))
+		if p.Skip.SkippedDateRanges || len(p.Skip.RecentlyRemovedDateRanges) > 0 {
+			e.quoted("RECENTLY-REMOVED-DATERANGES", strings.Join(p.Skip.RecentlyRemovedDateRanges, "\t"))
+		}
+		e.end()
+	}
+
+	for _, dr := range p.DateRanges {
+		writeDateRange(e, dr)
+	}
+
+	e.flush()
 
 	var (
 		seg           *MediaSegment
+		bitrate       int64
 		durationCache = make(map[float64]string)
 	)
 
 	head := p.head
 	count := p.count
-	for i := uint(0); (i < p.winsize || p.winsize == 0) && count > 0; count-- {
+	for i := uint(0); (i < p.winsize || p.winsize == 0) && count > 0 && e.err == nil; count-- {
 		seg = p.Segments[head]
 		head = (head + 1) % p.capacity
 		if seg == nil { // protection from badly filled chunklists
@@ -576,139 +901,214 @@ func (p *MediaPlaylist) Encode() *bytes.Buffer {
 		if seg.SCTE != nil {
 			switch seg.SCTE.Syntax {
 			case SCTE35_67_2014:
-				p.buf.WriteString("#EXT-SCTE35:")
-				p.buf.WriteString("CUE=\"")
-				p.buf.WriteString(seg.SCTE.Cue)
-				p.buf.WriteRune('"')
+				e.begin("#EXT-SCTE35:", nil)
+				e.quoted("CUE", seg.SCTE.Cue)
 				if seg.SCTE.ID != "" {
-					p.buf.WriteString(",ID=\"")
-					p.buf.WriteString(seg.SCTE.ID)
-					p.buf.WriteRune('"')
+					e.quoted("ID", seg.SCTE.ID)
 				}
 				if seg.SCTE.Time != 0 {
-					p.buf.WriteString(",TIME=")
-					p.buf.WriteString(strconv.FormatFloat(seg.SCTE.Time, 'f', -1, 64))
+					e.attr("TIME", e.float(seg.SCTE.Time, -1, 64))
 				}
-				p.buf.WriteRune('\n')
+				e.end()
 			case SCTE35_OATCLS:
 				switch seg.SCTE.CueType {
 				case SCTE35Cue_Start:
 					if seg.SCTE.Cue != "" {
-						p.buf.WriteString("#EXT-OATCLS-SCTE35:")
-						p.buf.WriteString(seg.SCTE.Cue)
-						p.buf.WriteRune('\n')
+						e.line("#EXT-OATCLS-SCTE35:" + seg.SCTE.Cue)
 					}
-					p.buf.WriteString("#EXT-X-CUE-OUT:")
-					p.buf.WriteString(strconv.FormatFloat(seg.SCTE.Time, 'f', -1, 64))
-					p.buf.WriteRune('\n')
+					e.line("#EXT-X-CUE-OUT:" + e.float(seg.SCTE.Time, -1, 64))
 				case SCTE35Cue_Mid:
-					p.buf.WriteString("#EXT-X-CUE-OUT-CONT:")
-					p.buf.WriteString("ElapsedTime=")
-					p.buf.WriteString(strconv.FormatFloat(seg.SCTE.Elapsed, 'f', -1, 64))
-					p.buf.WriteString(",Duration=")
-					p.buf.WriteString(strconv.FormatFloat(seg.SCTE.Time, 'f', -1, 64))
-					p.buf.WriteString(",SCTE35=")
-					p.buf.WriteString(seg.SCTE.Cue)
-					p.buf.WriteRune('\n')
+					buf.WriteString("#EXT-X-CUE-OUT-CONT:")
+					buf.WriteString("ElapsedTime=")
+					buf.WriteString(e.float(seg.SCTE.Elapsed, -1, 64))
+					buf.WriteString(",Duration=")
+					buf.WriteString(e.float(seg.SCTE.Time, -1, 64))
+					buf.WriteString(",SCTE35=")
+					buf.WriteString(seg.SCTE.Cue)
+					e.newline()
 				case SCTE35Cue_End:
-					p.buf.WriteString("#EXT-X-CUE-IN")
-					p.buf.WriteRune('\n')
+					e.line("#EXT-X-CUE-IN")
 				}
 			}
 		}
 		// check for key change
 		if seg.Key != nil && p.Key != seg.Key {
-			p.buf.WriteString("#EXT-X-KEY:")
-			p.buf.WriteString("METHOD=")
-			p.buf.WriteString(seg.Key.Method)
-			if seg.Key.Method != "NONE" {
-				p.buf.WriteString(",URI=\"")
-				p.buf.WriteString(seg.Key.URI)
-				p.buf.WriteRune('"')
-				if seg.Key.IV != "" {
-					p.buf.WriteString(",IV=")
-					p.buf.WriteString(seg.Key.IV)
-				}
-				if seg.Key.Keyformat != "" {
-					p.buf.WriteString(",KEYFORMAT=\"")
-					p.buf.WriteString(seg.Key.Keyformat)
-					p.buf.WriteRune('"')
-				}
-				if seg.Key.Keyformatversions != "" {
-					p.buf.WriteString(",KEYFORMATVERSIONS=\"")
-					p.buf.WriteString(seg.Key.Keyformatversions)
-					p.buf.WriteRune('"')
-				}
-			}
-			p.buf.WriteRune('\n')
+			writeKey(e, "#EXT-X-KEY:", seg.Key)
 		}
 		if seg.Discontinuity {
-			p.buf.WriteString("#EXT-X-DISCONTINUITY\n")
+			e.line("#EXT-X-DISCONTINUITY")
 		}
 		// ignore segment Map if default playlist Map is present
 		if p.Map == nil && seg.Map != nil {
-			p.buf.WriteString("#EXT-X-MAP:")
-			p.buf.WriteString("URI=\"")
-			p.buf.WriteString(seg.Map.URI)
-			p.buf.WriteRune('"')
-			if seg.Map.Limit > 0 {
-				p.buf.WriteString(",BYTERANGE=")
-				p.buf.WriteString(strconv.FormatInt(seg.Map.Limit, 10))
-				p.buf.WriteRune('@')
-				p.buf.WriteString(strconv.FormatInt(seg.Map.Offset, 10))
-			}
-			p.buf.WriteRune('\n')
+			writeMap(e, seg.Map)
+		}
+		for _, part := range seg.Parts {
+			writePart(e, part, p.Args)
 		}
 		if !seg.ProgramDateTime.IsZero() {
-			p.buf.WriteString("#EXT-X-PROGRAM-DATE-TIME:")
-			p.buf.WriteString(seg.ProgramDateTime.Format(DATETIME))
-			p.buf.WriteRune('\n')
+			e.line("#EXT-X-PROGRAM-DATE-TIME:" + seg.ProgramDateTime.Format(DATETIME))
+		}
+		for _, dr := range seg.DateRanges {
+			writeDateRange(e, dr)
+		}
+		// EXT-X-BITRATE applies to the following segments so it is
+		// displayed only when the bit rate changes
+		if seg.Bitrate > 0 && seg.Bitrate != bitrate {
+			e.line("#EXT-X-BITRATE:" + strconv.FormatInt(seg.Bitrate, 10))
+			bitrate = seg.Bitrate
+		}
+		if seg.Gap {
+			e.line("#EXT-X-GAP")
 		}
 		if seg.Limit > 0 {
-			p.buf.WriteString("#EXT-X-BYTERANGE:")
-			p.buf.WriteString(strconv.FormatInt(seg.Limit, 10))
-			p.buf.WriteRune('@')
-			p.buf.WriteString(strconv.FormatInt(seg.Offset, 10))
-			p.buf.WriteRune('\n')
+			buf.WriteString("#EXT-X-BYTERANGE:")
+			buf.WriteString(strconv.FormatInt(seg.Limit, 10))
+			buf.WriteRune('@')
+			buf.WriteString(strconv.FormatInt(seg.Offset, 10))
+			e.newline()
 		}
 
 		// Add Custom Segment Tags here
-		if seg.Custom != nil {
-			for _, v := range seg.Custom {
-				if customBuf := v.Encode(); customBuf != nil {
-					p.buf.WriteString(customBuf.String())
-					p.buf.WriteRune('\n')
-				}
+		for _, v := range seg.CustomTags() {
+			if customBuf := v.Encode(); customBuf != nil {
+				e.line(customBuf.String())
 			}
 		}
+		writeUnknownTags(e, seg.UnknownTags)
 
-		p.buf.WriteString("#EXTINF:")
+		buf.WriteString("#EXTINF:")
 		if str, ok := durationCache[seg.Duration]; ok {
-			p.buf.WriteString(str)
+			buf.WriteString(str)
 		} else {
 			if p.durationAsInt {
 				// Old Android players has problems with non integer Duration.
 				durationCache[seg.Duration] = strconv.FormatInt(int64(math.Ceil(seg.Duration)), 10)
 			} else {
 				// Wowza Mediaserver and some others prefer floats.
-				durationCache[seg.Duration] = strconv.FormatFloat(seg.Duration, 'f', 3, 32)
+				durationCache[seg.Duration] = e.float(seg.Duration, 3, 32)
 			}
-			p.buf.WriteString(durationCache[seg.Duration])
+			buf.WriteString(durationCache[seg.Duration])
 		}
-		p.buf.WriteRune(',')
-		p.buf.WriteString(seg.Title)
-		p.buf.WriteRune('\n')
-		p.buf.WriteString(seg.URI)
+		buf.WriteRune(',')
+		buf.WriteString(seg.Title)
+		e.newline()
+		buf.WriteString(e.value(seg.vars, "URI", seg.URI))
 		if p.Args != "" {
-			p.buf.WriteRune('?')
-			p.buf.WriteString(p.Args)
+			buf.WriteRune('?')
+			buf.WriteString(p.Args)
 		}
-		p.buf.WriteRune('\n')
+		e.newline()
+		e.flush()
+	}
+	writeUnknownTags(e, p.TrailingTags)
+	for _, part := range p.PendingParts {
+		writePart(e, part, p.Args)
+	}
+	for _, dr := range p.PendingDateRanges {
+		writeDateRange(e, dr)
+	}
+	for _, hint := range p.PreloadHints {
+		e.begin("#EXT-X-PRELOAD-HINT:", hint.vars)
+		e.attr("TYPE", hint.Type)
+		e.quoted("URI", hint.URI)
+		if hint.Offset > 0 {
+			e.attr("BYTERANGE-START", strconv.FormatInt(hint.Offset, 10))
+		}
+		if hint.Limit > 0 {
+			e.attr("BYTERANGE-LENGTH", strconv.FormatInt(hint.Limit, 10))
+		}
+		e.end()
+	}
+	for _, report := range p.RenditionReports {
+		e.begin("#EXT-X-RENDITION-REPORT:", report.vars)
+		e.quoted("URI", report.URI)
+		e.attr("LAST-MSN", strconv.FormatUint(report.LastMSN, 10))
+		if report.LastPart != nil {
+			e.attr("LAST-PART", strconv.FormatInt(*report.LastPart, 10))
+		}
+		e.end()
 	}
 	if p.Closed {
-		p.buf.WriteString("#EXT-X-ENDLIST\n")
+		e.line("#EXT-X-ENDLIST")
 	}
-	return &p.buf
+	e.flush()
+}
+
+// Delta creates the playlist delta update (Low-Latency HLS) from the
+// segments displayed by Encode. Segments which start more than
+// `skipBoundary` seconds before the end of the playlist are replaced
+// by EXT-X-SKIP tag in the delta update. When the server control
+// allows to skip date ranges (CAN-SKIP-DATERANGES) EXT-X-DATERANGE
+// tags of the header and of the skipped segments are skipped too and
+// IDs of date ranges removed from the playlist may be passed in
+// `removedDateRanges`. Otherwise date ranges of the skipped segments
+// are moved to the header of the delta update. The copy of the
+// playlist without EXT-X-SKIP tag is returned if no segments are
+// skipped. The delta update shares segments with the playlist.
+func (p *MediaPlaylist) Delta(skipBoundary float64, removedDateRanges []string) (*MediaPlaylist, error) {
+	if p.Skip != nil {
+		return nil, errors.New("playlist is a delta update already")
+	}
+	if skipBoundary <= 0 {
+		return nil, errors.New("skip boundary must be positive")
+	}
+	skipDateRanges := p.ServerControl != nil && p.ServerControl.CanSkipDateRanges
+	if len(removedDateRanges) > 0 && !skipDateRanges {
+		return nil, errors.New("removed date ranges require CAN-SKIP-DATERANGES in the server control")
+	}
+
+	var segments []*MediaSegment
+	head := p.head
+	for count := p.count; (uint(len(segments)) < p.winsize || p.winsize == 0) && count > 0; count-- {
+		if seg := p.Segments[head]; seg != nil {
+			segments = append(segments, seg)
+		}
+		head = (head + 1) % p.capacity
+	}
+	var skipped int
+	var distance float64 // from the start of the segment to the end of the playlist
+	for i := len(segments) - 1; i >= 0; i-- {
+		distance += segments[i].Duration
+		if distance > skipBoundary {
+			skipped = i + 1
+			break
+		}
+	}
+
+	d := *p
+	d.buf = bytes.Buffer{}
+	if skipped > 0 {
+		d.Skip = &Skip{SkippedSegments: uint64(skipped)}
+		if skipDateRanges {
+			d.Skip.SkippedDateRanges = true
+			d.Skip.RecentlyRemovedDateRanges = removedDateRanges
+			d.DateRanges = nil
+		} else {
+			d.DateRanges = append([]*DateRange(nil), p.DateRanges...)
+			for _, seg := range segments[:skipped] {
+				d.DateRanges = append(d.DateRanges, seg.DateRanges...)
+			}
+		}
+	}
+	d.count = uint(len(segments) - skipped)
+	d.capacity = d.count
+	if d.capacity == 0 {
+		d.capacity = 1
+	}
+	d.Segments = make([]*MediaSegment, d.capacity)
+	copy(d.Segments, segments[skipped:])
+	d.head = 0
+	d.tail = d.count % d.capacity
+	d.winsize = 0
+	// Playlists with EXT-X-SKIP tag must have version 9 or higher and
+	// with RECENTLY-REMOVED-DATERANGES attribute version 10 or higher.
+	if d.Skip != nil {
+		version(&d.ver, 9)
+		if d.Skip.SkippedDateRanges {
+			version(&d.ver, 10)
+		}
+	}
+	return &d, nil
 }
 
 // String here for compatibility with Stringer interface For example
@@ -718,6 +1118,66 @@ func (p *MediaPlaylist) String() string {
 	return p.Encode().String()
 }
 
+// AppendDefine appends variable definition to the media playlist.
+// Value of IMPORT variable is taken from variables set by
+// ImportVariables and value of QUERYPARAM variable from query
+// parameters set by SetQueryParams if it is empty. This operation does
+// reset playlist cache.
+func (p *MediaPlaylist) AppendDefine(d *Define) error {
+	if err := checkDefine(p.Defines, d); err != nil {
+		return err
+	}
+	switch d.Type {
+	case DefineImport:
+		if d.Value == "" {
+			d.Value = p.importVars[d.Name]
+		}
+	case DefineQueryParam:
+		if d.Value == "" {
+			d.Value = p.query.Get(d.Name)
+		}
+		version(&p.ver, 11)
+	}
+	version(&p.ver, 8)
+	p.Defines = append(p.Defines, d)
+	p.buf.Reset()
+	return nil
+}
+
+// ExpandVariables sets whether variable references are expanded on
+// Encode. By default fields decoded from values with {$name}
+// references are written back as the references together with
+// EXT-X-DEFINE tags unless the fields are changed. With expanding
+// EXT-X-DEFINE tags are omitted and all references are replaced by
+// values of the variables.
+func (p *MediaPlaylist) ExpandVariables(yes bool) {
+	p.expandVars = yes
+	p.buf.Reset()
+}
+
+// Validate checks that the name of the variable consists of allowed
+// characters.
+func (d *Define) Validate() error {
+	if !reVariableName.MatchString(d.Name) {
+		return fmt.Errorf("invalid variable name %q", d.Name)
+	}
+	return nil
+}
+
+// checkDefine validates the definition and checks that the variable is
+// not defined already.
+func checkDefine(defines []*Define, d *Define) error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	for _, v := range defines {
+		if v.Name == d.Name {
+			return fmt.Errorf("variable %q is already defined", d.Name)
+		}
+	}
+	return nil
+}
+
 // DurationAsInt represents the duration as the integer in encoded playlist.
 func (p *MediaPlaylist) DurationAsInt(yes bool) {
 	if yes {
@@ -736,7 +1196,7 @@ func (p *MediaPlaylist) Count() uint {
 // Close sliding playlist and make them fixed.
 func (p *MediaPlaylist) Close() {
 	if p.buf.Len() > 0 {
-		p.buf.WriteString("#EXT-X-ENDLIST\n")
+		p.newEncoder(&p.buf, nil).line("#EXT-X-ENDLIST")
 	}
 	p.Closed = true
 }
@@ -751,7 +1211,7 @@ func (p *MediaPlaylist) SetDefaultKey(method, uri, iv, keyformat, keyformatversi
 	if keyformat != "" || keyformatversions != "" {
 		version(&p.ver, 5)
 	}
-	p.Key = &Key{method, uri, iv, keyformat, keyformatversions}
+	p.Key = &Key{Method: method, URI: uri, IV: iv, Keyformat: keyformat, Keyformatversions: keyformatversions}
 
 	return nil
 }
@@ -761,7 +1221,7 @@ func (p *MediaPlaylist) SetDefaultKey(method, uri, iv, keyformat, keyformatversi
 // whole playlist.
 func (p *MediaPlaylist) SetDefaultMap(uri string, limit, offset int64) {
 	version(&p.ver, 5) // due section 4
-	p.Map = &Map{uri, limit, offset}
+	p.Map = &Map{URI: uri, Limit: limit, Offset: offset}
 }
 
 // SetIframeOnly marks medialist as consists of only I-frames (Intra
@@ -785,7 +1245,7 @@ func (p *MediaPlaylist) SetKey(method, uri, iv, keyformat, keyformatversions str
 		version(&p.ver, 5)
 	}
 
-	p.Segments[p.last()].Key = &Key{method, uri, iv, keyformat, keyformatversions}
+	p.Segments[p.last()].Key = &Key{Method: method, URI: uri, IV: iv, Keyformat: keyformat, Keyformatversions: keyformatversions}
 	return nil
 }
 
@@ -796,7 +1256,7 @@ func (p *MediaPlaylist) SetMap(uri string, limit, offset int64) error {
 		return errors.New("playlist is empty")
 	}
 	version(&p.ver, 5) // due section 4
-	p.Segments[p.last()].Map = &Map{uri, limit, offset}
+	p.Segments[p.last()].Map = &Map{URI: uri, Limit: limit, Offset: offset}
 	return nil
 }
 
@@ -828,6 +1288,57 @@ func (p *MediaPlaylist) SetSCTE35(scte35 *SCTE) error {
 	return nil
 }
 
+// AppendDateRange validates and appends EXT-X-DATERANGE after the
+// last segment of the playlist. The date range is linked to the next
+// appended segment. Several date ranges may have the same ID, for
+// example SCTE35-OUT and SCTE35-IN of the same splice. This operation
+// does reset playlist cache.
+func (p *MediaPlaylist) AppendDateRange(dr *DateRange) error {
+	if err := dr.Validate(); err != nil {
+		return err
+	}
+	p.PendingDateRanges = append(p.PendingDateRanges, dr)
+	p.buf.Reset()
+	return nil
+}
+
+// Validate checks the date range accordingly with the rules of
+// section 4.4.5.1 of the specification.
+func (dr *DateRange) Validate() error {
+	if dr.ID == "" {
+		return errors.New("date range ID is required")
+	}
+	if dr.StartDate.IsZero() {
+		return fmt.Errorf("date range %q: START-DATE is required", dr.ID)
+	}
+	if (dr.Duration != nil && *dr.Duration < 0) || dr.PlannedDuration < 0 {
+		return fmt.Errorf("date range %q: duration must not be negative", dr.ID)
+	}
+	if !dr.EndDate.IsZero() {
+		if dr.EndDate.Before(dr.StartDate) {
+			return fmt.Errorf("date range %q: END-DATE must not be before START-DATE", dr.ID)
+		}
+		// compare with millisecond accuracy of the timestamps
+		if dr.Duration != nil && math.Abs(dr.EndDate.Sub(dr.StartDate).Seconds()-*dr.Duration) >= 0.001 {
+			return fmt.Errorf("date range %q: END-DATE must be equal to START-DATE plus DURATION", dr.ID)
+		}
+	}
+	if dr.EndOnNext {
+		if dr.Class == "" {
+			return fmt.Errorf("date range %q: END-ON-NEXT requires CLASS", dr.ID)
+		}
+		if dr.Duration != nil || !dr.EndDate.IsZero() {
+			return fmt.Errorf("date range %q: END-ON-NEXT must not be used with DURATION or END-DATE", dr.ID)
+		}
+	}
+	for k := range dr.X {
+		if !strings.HasPrefix(k, "X-") {
+			return fmt.Errorf("date range %q: client attribute %s must have X- prefix", dr.ID, k)
+		}
+	}
+	return nil
+}
+
 // SetDiscontinuity sets discontinuity flag for the current media
 // segment. EXT-X-DISCONTINUITY indicates an encoding discontinuity
 // between the media segment that follows it and the one that preceded
@@ -854,18 +1365,42 @@ func (p *MediaPlaylist) SetProgramDateTime(value time.Time) error {
 	return nil
 }
 
+// SetGap marks the current media segment as absent. EXT-X-GAP
+// indicates that the segment URI must not be loaded by clients.
+func (p *MediaPlaylist) SetGap() error {
+	if p.count == 0 {
+		return errors.New("playlist is empty")
+	}
+	p.Segments[p.last()].Gap = true
+	return nil
+}
+
+// SetBitrate sets approximate bit rate in kbit/s for the current media
+// segment. EXT-X-BITRATE applies to all following segments until the
+// next EXT-X-BITRATE so it is displayed on Encode only when the bit
+// rate of a segment differs from the previous one.
+func (p *MediaPlaylist) SetBitrate(kbps int64) error {
+	if p.count == 0 {
+		return errors.New("playlist is empty")
+	}
+	p.Segments[p.last()].Bitrate = kbps
+	return nil
+}
+
 // SetCustomTag sets the provided tag on the media playlist for its
-// TagName.
+// TagName. New tags are encoded after the tags set before, a replaced
+// tag keeps its position.
 func (p *MediaPlaylist) SetCustomTag(tag CustomTag) {
 	if p.Custom == nil {
 		p.Custom = make(map[string]CustomTag)
 	}
 
-	p.Custom[tag.TagName()] = tag
+	p.customOrder.set(p.Custom, tag.TagName(), tag)
 }
 
 // SetCustomSegmentTag sets the provided tag on the current media
-// segment for its TagName.
+// segment for its TagName. New tags are encoded after the tags set
+// before, a replaced tag keeps its position.
 func (p *MediaPlaylist) SetCustomSegmentTag(tag CustomTag) error {
 	if p.count == 0 {
 		return errors.New("playlist is empty")
@@ -877,13 +1412,17 @@ func (p *MediaPlaylist) SetCustomSegmentTag(tag CustomTag) error {
 		last.Custom = make(map[string]CustomTag)
 	}
 
-	last.Custom[tag.TagName()] = tag
+	last.customOrder.set(last.Custom, tag.TagName(), tag)
 
 	return nil
 }
 
-// Version returns the current playlist version number
+// Version returns the current playlist version number or the
+// minimum compatible version if SetAutoVersion is set.
 func (p *MediaPlaylist) Version() uint8 {
+	if p.autoVersion {
+		return p.MinVersion()
+	}
 	return p.ver
 }
 
@@ -893,6 +1432,86 @@ func (p *MediaPlaylist) SetVersion(ver uint8) {
 	p.ver = ver
 }
 
+// SetAutoVersion sets whether Encode writes the minimum protocol
+// version computed by MinVersion instead of the version set by
+// SetVersion and other Set methods.
+func (p *MediaPlaylist) SetAutoVersion(yes bool) {
+	p.autoVersion = yes
+	p.buf.Reset()
+}
+
+// MinVersion computes the minimum protocol version compatible with
+// the features used by the media playlist (section 8 of the HLS
+// specification). Only segments displayed by Encode are checked.
+func (p *MediaPlaylist) MinVersion() uint8 {
+	ver := uint8(1)
+	keyVersion := func(key *Key) {
+		if key == nil {
+			return
+		}
+		if key.IV != "" {
+			version(&ver, 2)
+		}
+		if key.Keyformat != "" || key.Keyformatversions != "" {
+			version(&ver, 5)
+		}
+	}
+	mapVersion := func(m *Map) {
+		if m == nil {
+			return
+		}
+		if p.Iframe {
+			version(&ver, 5)
+		} else {
+			version(&ver, 6)
+		}
+	}
+
+	defineVersion(&ver, p.Defines)
+	if p.Iframe {
+		version(&ver, 4)
+	}
+	keyVersion(p.Key)
+	mapVersion(p.Map)
+	if p.Skip != nil {
+		version(&ver, 9)
+		if p.Skip.SkippedDateRanges || len(p.Skip.RecentlyRemovedDateRanges) > 0 {
+			version(&ver, 10)
+		}
+	}
+	head := p.head
+	count := p.count
+	for i := uint(0); (i < p.winsize || p.winsize == 0) && count > 0; count-- {
+		seg := p.Segments[head]
+		head = (head + 1) % p.capacity
+		if seg == nil {
+			continue
+		}
+		if p.winsize > 0 {
+			i++
+		}
+		if !p.durationAsInt {
+			version(&ver, 3) // floating-point EXTINF durations
+		}
+		if seg.Limit > 0 {
+			version(&ver, 4)
+		}
+		keyVersion(seg.Key)
+		mapVersion(seg.Map)
+	}
+	return ver
+}
+
+// defineVersion raises the version for variable substitution.
+func defineVersion(ver *uint8, defines []*Define) {
+	for _, d := range defines {
+		version(ver, 8)
+		if d.Type == DefineQueryParam {
+			version(ver, 11)
+		}
+	}
+}
+
 // WinSize returns the playlist's window size.
 func (p *MediaPlaylist) WinSize() uint {
 	return p.winsize
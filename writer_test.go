@@ -596,25 +596,442 @@ func TestLargeMediaPlaylistWithParallel(t *testing.T) {
 			defer wg.Done()
 			f, err := os.Open("sample-playlists/media-playlist-large.m3u8")
 			if err != nil {
-				t.Fatal(err)
+				t.Error(err)
+				return
 			}
 			p, err := NewMediaPlaylist(50000, 50000)
 			if err != nil {
-				t.Fatalf("Create media playlist failed: %s", err)
+				t.Errorf("Create media playlist failed: %s", err)
+				return
 			}
 			if err = p.DecodeFrom(bufio.NewReader(f), true); err != nil {
-				t.Fatal(err)
+				t.Error(err)
+				return
 			}
 
 			actual := p.Encode().Bytes() // disregard output
 			if bytes.Compare(expect, actual) != 0 {
-				t.Fatal("not matched")
+				t.Error("not matched")
 			}
 		}()
 		wg.Wait()
 	}
 }
 
+// Create new media playlist
+// Add partial segments before and after the segment
+// Check that parts are linked to the segment and to the live edge
+func TestPartialSegmentsForMediaPlaylist(t *testing.T) {
+	p, e := NewMediaPlaylist(3, 5)
+	if e != nil {
+		t.Fatalf("Create media playlist failed: %s", e)
+	}
+	p.PartTargetDuration = 1.002
+	p.AppendPart(&PartialSegment{URI: "part0.0.mp4", Duration: 1.002, Independent: true})
+	p.AppendPart(&PartialSegment{URI: "part0.1.mp4", Duration: 0.998})
+	if e = p.Append("seg0.mp4", 2.0, ""); e != nil {
+		t.Errorf("Add 1st segment to a media playlist failed: %s", e)
+	}
+	if len(p.Segments[0].Parts) != 2 || len(p.PendingParts) != 0 {
+		t.Fatalf("Pending parts must be linked to the appended segment, got: %v/%v", len(p.Segments[0].Parts), len(p.PendingParts))
+	}
+	p.AppendPart(&PartialSegment{URI: "seg1.mp4", Duration: 1.002, Limit: 1000, Offset: 0, Independent: true, Gap: true})
+	expected := `#EXT-X-TARGETDURATION:2
+#EXT-X-PART-INF:PART-TARGET=1.002
+#EXT-X-PART:DURATION=1.002,URI="part0.0.mp4",INDEPENDENT=YES
+#EXT-X-PART:DURATION=0.998,URI="part0.1.mp4"
+#EXTINF:2.000,
+seg0.mp4
+#EXT-X-PART:DURATION=1.002,URI="seg1.mp4",INDEPENDENT=YES,BYTERANGE="1000@0",GAP=YES
+`
+	if !strings.HasSuffix(p.String(), expected) {
+		t.Fatalf("Media playlist did not contain: %s\nMedia Playlist:\n%v", expected, p.String())
+	}
+}
+
+// Create new media playlist
+// Set server control parameters
+func TestServerControlForMediaPlaylist(t *testing.T) {
+	p, e := NewMediaPlaylist(3, 5)
+	if e != nil {
+		t.Fatalf("Create media playlist failed: %s", e)
+	}
+	p.TargetDuration = 4
+	p.ServerControl = &ServerControl{CanBlockReload: true, CanSkipUntil: 24, CanSkipDateRanges: true, HoldBack: 12, PartHoldBack: 3.012}
+	p.PartTargetDuration = 1.004
+
+	expected := `#EXT-X-TARGETDURATION:4
+#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,CAN-SKIP-UNTIL=24,CAN-SKIP-DATERANGES=YES,HOLD-BACK=12,PART-HOLD-BACK=3.012
+#EXT-X-PART-INF:PART-TARGET=1.004
+`
+	if !strings.Contains(p.String(), expected) {
+		t.Fatalf("Media playlist did not contain: %s\nMedia Playlist:\n%v", expected, p.String())
+	}
+}
+
+// Create new media playlist
+// Set preload hints and rendition reports twice
+// Check they are displayed once after the last segment
+func TestPreloadHintAndRenditionReportForMediaPlaylist(t *testing.T) {
+	p, e := NewMediaPlaylist(3, 5)
+	if e != nil {
+		t.Fatalf("Create media playlist failed: %s", e)
+	}
+	if e = p.Append("seg0.mp4", 4.0, ""); e != nil {
+		t.Errorf("Add 1st segment to a media playlist failed: %s", e)
+	}
+	p.SetPreloadHint("PART", "part1.0.mp4", 0, 0)
+	p.SetPreloadHint("MAP", "init.mp4", 0, 0)
+	p.SetPreloadHint("PART", "seg1.mp4", 1024, 2048)
+	p.SetRenditionReport("../low/index.m3u8", 0, 3)
+	p.SetRenditionReport("../hi/index.m3u8", 0, -1)
+	p.SetRenditionReport("../low/index.m3u8", 1, 0)
+	p.Close()
+
+	expected := `seg0.mp4
+#EXT-X-PRELOAD-HINT:TYPE=PART,URI="seg1.mp4",BYTERANGE-START=1024,BYTERANGE-LENGTH=2048
+#EXT-X-PRELOAD-HINT:TYPE=MAP,URI="init.mp4"
+#EXT-X-RENDITION-REPORT:URI="../low/index.m3u8",LAST-MSN=1,LAST-PART=0
+#EXT-X-RENDITION-REPORT:URI="../hi/index.m3u8",LAST-MSN=0
+#EXT-X-ENDLIST
+`
+	if !strings.HasSuffix(p.String(), expected) {
+		t.Fatalf("Media playlist did not contain: %s\nMedia Playlist:\n%v", expected, p.String())
+	}
+
+	// the zero value of the report has no partial segments
+	p.RenditionReports = []*RenditionReport{{URI: "../mid/index.m3u8", LastMSN: 5}}
+	p.ResetCache()
+	if out := p.String(); !strings.Contains(out, "#EXT-X-RENDITION-REPORT:URI=\"../mid/index.m3u8\",LAST-MSN=5\n") {
+		t.Errorf("Expected report without LAST-PART:\n%s", out)
+	}
+}
+
+// Create new media playlist
+// Make the delta update with skip boundary of 3 segments
+// Check that older segments are skipped
+func TestDeltaForMediaPlaylist(t *testing.T) {
+	p, e := NewMediaPlaylist(0, 10)
+	if e != nil {
+		t.Fatalf("Create media playlist failed: %s", e)
+	}
+	p.SeqNo = 10
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 6; i++ {
+		if i == 1 || i == 4 {
+			p.AppendDateRange(&DateRange{ID: fmt.Sprintf("ad%d", i), StartDate: start.Add(time.Duration(i) * 4 * time.Second)})
+		}
+		if e = p.Append(fmt.Sprintf("test%d.ts", i), 4.0, ""); e != nil {
+			t.Errorf("Add segment #%d to a media playlist failed: %s", i, e)
+		}
+	}
+	if _, e = p.Delta(12, []string{"splice-1"}); e == nil {
+		t.Error("Expected error on removed date ranges without CAN-SKIP-DATERANGES")
+	}
+
+	// date ranges of the skipped segments are moved to the header
+	d, e := p.Delta(12, nil)
+	if e != nil {
+		t.Fatalf("Create delta update failed: %s", e)
+	}
+	expected := `#EXTM3U
+#EXT-X-VERSION:9
+#EXT-X-MEDIA-SEQUENCE:10
+#EXT-X-TARGETDURATION:4
+#EXT-X-SKIP:SKIPPED-SEGMENTS=3
+#EXT-X-DATERANGE:ID="ad1",START-DATE="2020-01-01T00:00:04Z"
+#EXTINF:4.000,
+test3.ts
+#EXT-X-DATERANGE:ID="ad4",START-DATE="2020-01-01T00:00:16Z"
+#EXTINF:4.000,
+test4.ts
+#EXTINF:4.000,
+test5.ts
+`
+	if d.String() != expected {
+		t.Fatalf("Delta update does not match:\n%s\nexpected:\n%s", d.String(), expected)
+	}
+
+	p.ServerControl = &ServerControl{CanSkipUntil: 12, CanSkipDateRanges: true}
+	d, e = p.Delta(12, []string{"splice-1"})
+	if e != nil {
+		t.Fatalf("Create delta update failed: %s", e)
+	}
+	if d.Count() != 3 || p.Count() != 6 {
+		t.Errorf("Excepted segments in delta update and playlist: 3/6, got: %v/%v", d.Count(), p.Count())
+	}
+	expected = `#EXTM3U
+#EXT-X-VERSION:10
+#EXT-X-MEDIA-SEQUENCE:10
+#EXT-X-TARGETDURATION:4
+#EXT-X-SERVER-CONTROL:CAN-SKIP-UNTIL=12,CAN-SKIP-DATERANGES=YES
+#EXT-X-SKIP:SKIPPED-SEGMENTS=3,RECENTLY-REMOVED-DATERANGES="splice-1"
+#EXTINF:4.000,
+test3.ts
+#EXT-X-DATERANGE:ID="ad4",START-DATE="2020-01-01T00:00:16Z"
+#EXTINF:4.000,
+test4.ts
+#EXTINF:4.000,
+test5.ts
+`
+	if d.String() != expected {
+		t.Fatalf("Delta update does not match:\n%s\nexpected:\n%s", d.String(), expected)
+	}
+	if _, e = d.Delta(12, nil); e == nil {
+		t.Error("Expected error on delta update of the delta update")
+	}
+
+	// RECENTLY-REMOVED-DATERANGES is required when date ranges are skipped
+	d, e = p.Delta(12, nil)
+	if e != nil {
+		t.Fatalf("Create delta update failed: %s", e)
+	}
+	if !strings.Contains(d.String(), "#EXT-X-SKIP:SKIPPED-SEGMENTS=3,RECENTLY-REMOVED-DATERANGES=\"\"\n") {
+		t.Errorf("Expected empty RECENTLY-REMOVED-DATERANGES:\n%s", d)
+	}
+
+	// nothing to skip
+	d, e = p.Delta(100, nil)
+	if e != nil {
+		t.Fatalf("Create delta update failed: %s", e)
+	}
+	if d.Skip != nil || d.Count() != 6 || strings.Contains(d.String(), "#EXT-X-SKIP") {
+		t.Errorf("Expected playlist without EXT-X-SKIP:\n%s", d)
+	}
+}
+
+// Create new media playlist
+// Append valid and invalid date ranges
+func TestDateRangeForMediaPlaylist(t *testing.T) {
+	p, e := NewMediaPlaylist(3, 5)
+	if e != nil {
+		t.Fatalf("Create media playlist failed: %s", e)
+	}
+	start := time.Date(2014, 3, 5, 11, 15, 0, 0, time.UTC)
+	zero, duration, wrong := 0.0, 30.5, 2.0
+	invalid := []*DateRange{
+		{StartDate: start},
+		{ID: "no-start"},
+		{ID: "end-on-next", StartDate: start, EndOnNext: true},
+		{ID: "end-on-next-duration", Class: "c", StartDate: start, EndOnNext: true, Duration: &zero},
+		{ID: "end-before-start", StartDate: start, EndDate: start.Add(-time.Second)},
+		{ID: "wrong-duration", StartDate: start, EndDate: start.Add(time.Second), Duration: &wrong},
+		{ID: "client-attribute", StartDate: start, X: map[string]string{"COM-EXAMPLE": "1"}},
+	}
+	for _, dr := range invalid {
+		if e = p.AppendDateRange(dr); e == nil {
+			t.Errorf("Expected error for date range %+v", dr)
+		}
+	}
+	e = p.AppendDateRange(&DateRange{
+		ID:        "ad-1",
+		Class:     "com.example.ad",
+		StartDate: start,
+		EndDate:   start.Add(30500 * time.Millisecond),
+		Duration:  &duration,
+		SCTE35Out: "0xFC002F",
+		X:         map[string]string{"X-TITLE": `"Ad"`, "X-AD-ID": "0x42"},
+	})
+	if e != nil {
+		t.Fatalf("Append date range failed: %s", e)
+	}
+	if len(p.PendingDateRanges) != 1 {
+		t.Fatalf("Excepted date ranges: 1, got: %v", len(p.PendingDateRanges))
+	}
+	expected := `#EXT-X-DATERANGE:ID="ad-1",CLASS="com.example.ad",START-DATE="2014-03-05T11:15:00Z",END-DATE="2014-03-05T11:15:30.5Z",DURATION=30.5,SCTE35-OUT=0xFC002F,X-AD-ID=0x42,X-TITLE="Ad"
+`
+	if !strings.Contains(p.String(), expected) {
+		t.Fatalf("Media playlist did not contain: %s\nMedia Playlist:\n%v", expected, p.String())
+	}
+	// explicit zero duration is kept
+	e = p.AppendDateRange(&DateRange{ID: "ad-2", StartDate: start, Duration: &zero})
+	if e != nil {
+		t.Fatalf("Append date range failed: %s", e)
+	}
+	if !strings.Contains(p.String(), `#EXT-X-DATERANGE:ID="ad-2",START-DATE="2014-03-05T11:15:00Z",DURATION=0`) {
+		t.Errorf("Expected DURATION=0 in:\n%v", p.String())
+	}
+}
+
+// Date ranges are linked to the next appended segment and keep their
+// position after decoding.
+func TestDateRangePositionForMediaPlaylist(t *testing.T) {
+	p, e := NewMediaPlaylist(3, 3)
+	if e != nil {
+		t.Fatalf("Create media playlist failed: %s", e)
+	}
+	start := time.Date(2014, 3, 5, 11, 15, 0, 0, time.UTC)
+	p.Append("test0.ts", 10, "")
+	p.AppendDateRange(&DateRange{ID: "ad-1", StartDate: start})
+	p.Append("test1.ts", 10, "")
+	p.AppendDateRange(&DateRange{ID: "ad-2", StartDate: start})
+	if len(p.Segments[1].DateRanges) != 1 || len(p.PendingDateRanges) != 1 {
+		t.Fatalf("Expected date range linked to the segment, got: %+v", p.Segments[1])
+	}
+	expected := `#EXTINF:10.000,
+test0.ts
+#EXT-X-DATERANGE:ID="ad-1",START-DATE="2014-03-05T11:15:00Z"
+#EXTINF:10.000,
+test1.ts
+#EXT-X-DATERANGE:ID="ad-2",START-DATE="2014-03-05T11:15:00Z"
+`
+	if !strings.HasSuffix(p.String(), expected) {
+		t.Fatalf("Media playlist did not end with:\n%s\nMedia Playlist:\n%v", expected, p.String())
+	}
+	decoded, _ := NewMediaPlaylist(3, 3)
+	if e = decoded.DecodeFrom(strings.NewReader(p.String()), true); e != nil {
+		t.Fatal(e)
+	}
+	if decoded.String() != p.String() {
+		t.Errorf("Playlist differs after decoding:\n%s", decoded)
+	}
+}
+
+func TestGapAndBitrateForMediaPlaylist(t *testing.T) {
+	p, e := NewMediaPlaylist(4, 4)
+	if e != nil {
+		t.Fatalf("Create media playlist failed: %s", e)
+	}
+	if e = p.SetGap(); e == nil {
+		t.Error("Expected error on empty playlist")
+	}
+	for i, bitrate := range []int64{800, 800, 800, 1200} {
+		if e = p.Append(fmt.Sprintf("test%d.ts", i), 6, ""); e != nil {
+			t.Fatalf("Add segment to a media playlist failed: %s", e)
+		}
+		if e = p.SetBitrate(bitrate); e != nil {
+			t.Fatalf("Set bitrate failed: %s", e)
+		}
+		if i == 2 {
+			if e = p.SetGap(); e != nil {
+				t.Fatalf("Set gap failed: %s", e)
+			}
+		}
+	}
+	expected := `#EXT-X-BITRATE:800
+#EXTINF:6.000,
+test0.ts
+#EXTINF:6.000,
+test1.ts
+#EXT-X-GAP
+#EXTINF:6.000,
+test2.ts
+#EXT-X-BITRATE:1200
+#EXTINF:6.000,
+test3.ts
+`
+	if !strings.HasSuffix(p.String(), expected) {
+		t.Fatalf("Media playlist did not end with: %s\nMedia Playlist:\n%v", expected, p.String())
+	}
+	// the first segment of the window must repeat the inherited bit rate
+	p.Slide("test4.ts", 6, "")
+	if !strings.Contains(p.String(), "#EXT-X-BITRATE:800\n#EXTINF:6.000,\ntest1.ts") {
+		t.Errorf("Expected bitrate before the first segment of the window:\n%v", p.String())
+	}
+}
+
+func TestEncodeMediaPlaylistWithDefine(t *testing.T) {
+	playlist := `#EXTM3U
+#EXT-X-VERSION:8
+#EXT-X-DEFINE:NAME="host",VALUE="https://cdn.example.com"
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-TARGETDURATION:10
+#EXTINF:10.000,
+{$host}/segment0.ts
+#EXT-X-ENDLIST
+`
+	p, _ := NewMediaPlaylist(1, 1)
+	if err := p.DecodeFrom(strings.NewReader(playlist), true); err != nil {
+		t.Fatal(err)
+	}
+	if p.Segments[0].URI != "https://cdn.example.com/segment0.ts" {
+		t.Fatalf("Segment URI is not expanded: %s", p.Segments[0].URI)
+	}
+	if p.String() != playlist {
+		t.Errorf("Expected variables to be kept symbolic\ngot:\n%s\nexp:\n%s", p.String(), playlist)
+	}
+	p.ExpandVariables(true)
+	if strings.Contains(p.String(), "EXT-X-DEFINE") || !strings.Contains(p.String(), "\nhttps://cdn.example.com/segment0.ts\n") {
+		t.Errorf("Expected variables to be expanded:\n%s", p.String())
+	}
+	if err := p.AppendDefine(&Define{Name: "host", Value: "other"}); err == nil {
+		t.Error("Expected error on duplicate variable")
+	}
+	if err := p.AppendDefine(&Define{Name: "bad name", Value: "v"}); err == nil {
+		t.Error("Expected error on invalid variable name")
+	}
+}
+
+func TestEncodeMediaPlaylistWithVariableReferences(t *testing.T) {
+	playlist := `#EXTM3U
+#EXT-X-VERSION:8
+#EXT-X-DEFINE:NAME="host",VALUE="https://cdn.example.com"
+#EXT-X-DEFINE:NAME="iv",VALUE="0x00000000000000000000000000000001"
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-TARGETDURATION:10
+#EXTINF:10.000,
+{$host}/segment0.ts
+#EXT-X-KEY:METHOD=AES-128,URI="{$host}/key",IV={$iv}
+#EXTINF:10.000,
+https://cdn.example.com/segment1.ts
+#EXTINF:10.000,
+{$host}/segment2.ts
+#EXT-X-ENDLIST
+`
+	p, _ := NewMediaPlaylist(3, 3)
+	if err := p.DecodeFrom(strings.NewReader(playlist), true); err != nil {
+		t.Fatal(err)
+	}
+	if key := p.Segments[1].Key; key.IV != "0x00000000000000000000000000000001" || key.URI != "https://cdn.example.com/key" {
+		t.Fatalf("Key attributes are not expanded: %+v", key)
+	}
+	for _, line := range []string{
+		"\n#EXT-X-KEY:METHOD=AES-128,URI=\"{$host}/key\",IV={$iv}\n",
+		"\n{$host}/segment0.ts\n",
+		"\nhttps://cdn.example.com/segment1.ts\n", // literal value is not replaced by the reference
+		"\n{$host}/segment2.ts\n",
+	} {
+		if !strings.Contains(p.String(), line) {
+			t.Errorf("Expected line %q to be kept:\n%s", line, p.String())
+		}
+	}
+	// edited value is written as is
+	p.Segments[2].URI = "https://cdn.example.com/edited.ts"
+	p.ResetCache()
+	if !strings.Contains(p.String(), "\nhttps://cdn.example.com/edited.ts\n") {
+		t.Errorf("Expected edited value to be written as is:\n%s", p.String())
+	}
+	p.ExpandVariables(true)
+	if strings.Contains(p.String(), "{$") || !strings.Contains(p.String(), "IV=0x00000000000000000000000000000001") {
+		t.Errorf("Expected variables to be expanded:\n%s", p.String())
+	}
+}
+
+func TestEncodeMasterPlaylistWithDefine(t *testing.T) {
+	m := NewMasterPlaylist()
+	if err := m.AppendDefine(&Define{Name: "token", Type: DefineImport}); err == nil {
+		t.Error("Expected error on IMPORT in master playlist")
+	}
+	if err := m.AppendDefine(&Define{Name: "host", Value: "https://cdn.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AppendDefine(&Define{Name: "token", Type: DefineQueryParam}); err != nil {
+		t.Fatal(err)
+	}
+	m.Append("{$host}/low.m3u8?token={$token}", nil, VariantParams{Bandwidth: 1280000})
+	expected := `#EXT-X-DEFINE:NAME="host",VALUE="https://cdn.example.com"
+#EXT-X-DEFINE:QUERYPARAM="token"
+#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1280000
+{$host}/low.m3u8?token={$token}
+`
+	if !strings.HasSuffix(m.String(), expected) {
+		t.Errorf("Master playlist did not end with: %s\nMaster Playlist:\n%v", expected, m.String())
+	}
+	if m.Version() != 11 {
+		t.Errorf("Expected version 11, got %d", m.Version())
+	}
+}
+
 func TestMediaVersion(t *testing.T) {
 	m, _ := NewMediaPlaylist(3, 3)
 	m.ver = 5
@@ -632,6 +1049,60 @@ func TestMediaSetVersion(t *testing.T) {
 	}
 }
 
+func TestMediaMinVersion(t *testing.T) {
+	m, _ := NewMediaPlaylist(3, 5)
+	m.DurationAsInt(true)
+	if v := m.MinVersion(); v != 1 {
+		t.Errorf("Expected min version of empty playlist: 1, got: %v", v)
+	}
+	m.Append("test01.ts", 10, "")
+	if v := m.MinVersion(); v != 1 {
+		t.Errorf("Expected min version with integer durations: 1, got: %v", v)
+	}
+	m.DurationAsInt(false)
+	if v := m.MinVersion(); v != 3 {
+		t.Errorf("Expected min version with float durations: 3, got: %v", v)
+	}
+	m.SetRange(100, 0)
+	if v := m.MinVersion(); v != 4 {
+		t.Errorf("Expected min version with byte range: 4, got: %v", v)
+	}
+	m.SetKey("AES-128", "key.bin", "0x1", "com.example", "1")
+	if v := m.MinVersion(); v != 5 {
+		t.Errorf("Expected min version with KEYFORMAT: 5, got: %v", v)
+	}
+	m.SetMap("init.mp4", 0, 0)
+	if v := m.MinVersion(); v != 6 {
+		t.Errorf("Expected min version with EXT-X-MAP: 6, got: %v", v)
+	}
+	m.AppendDefine(&Define{Name: "host", Value: "example.com"})
+	if v := m.MinVersion(); v != 8 {
+		t.Errorf("Expected min version with EXT-X-DEFINE: 8, got: %v", v)
+	}
+	m.AppendDefine(&Define{Name: "token", Type: DefineQueryParam})
+	if v := m.MinVersion(); v != 11 {
+		t.Errorf("Expected min version with QUERYPARAM: 11, got: %v", v)
+	}
+
+	// segments outside of the window are not taken into account
+	m, _ = NewMediaPlaylist(1, 2)
+	m.Append("test01.ts", 10, "")
+	m.SetRange(100, 0)
+	m.Append("test02.ts", 10, "")
+	m.Remove()
+	if v := m.MinVersion(); v != 3 {
+		t.Errorf("Expected min version of the window: 3, got: %v", v)
+	}
+	m.SetVersion(7)
+	m.SetAutoVersion(true)
+	if !strings.HasPrefix(m.String(), "#EXTM3U\n#EXT-X-VERSION:3\n") {
+		t.Errorf("Expected auto version 3 on encode:\n%v", m.String())
+	}
+	if m.Version() != 3 {
+		t.Errorf("Expected version: 3, got: %v", m.Version())
+	}
+}
+
 func TestMediaWinSize(t *testing.T) {
 	m, _ := NewMediaPlaylist(3, 3)
 	if m.WinSize() != m.winsize {
@@ -930,6 +1401,91 @@ func TestEncodeMasterPlaylistWithCustomTags(t *testing.T) {
 	}
 }
 
+func TestEncodeMasterPlaylistWithSessionData(t *testing.T) {
+	m := NewMasterPlaylist()
+	invalid := []*SessionData{
+		{Value: "no id"},
+		{DataID: "com.example.empty"},
+		{DataID: "com.example.both", Value: "v", URI: "data.json"},
+		{DataID: "com.example.format", Value: "v", Format: "RAW"},
+	}
+	for _, sd := range invalid {
+		if err := m.AppendSessionData(sd); err == nil {
+			t.Errorf("Expected error for session data %+v", sd)
+		}
+	}
+	if err := m.AppendSessionKey("NONE", "", "", "", ""); err == nil {
+		t.Error("Expected error for session key with METHOD=NONE")
+	}
+	if err := m.AppendSessionData(&SessionData{DataID: "com.example.title", Value: "Example", Language: "en"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AppendSessionData(&SessionData{DataID: "com.example.lyrics", URI: "lyrics.bin", Format: "RAW"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AppendSessionKey("AES-128", "https://example.com/key", "0x1234", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	m.Append("low/video.m3u8", nil, VariantParams{Bandwidth: 1280000})
+
+	expected := `#EXT-X-SESSION-DATA:DATA-ID="com.example.title",VALUE="Example",LANGUAGE="en"
+#EXT-X-SESSION-DATA:DATA-ID="com.example.lyrics",URI="lyrics.bin",FORMAT=RAW
+#EXT-X-SESSION-KEY:METHOD=AES-128,URI="https://example.com/key",IV=0x1234
+#EXT-X-STREAM-INF:`
+	if !strings.Contains(m.String(), expected) {
+		t.Fatalf("Master playlist did not contain: %s\nMaster Playlist:\n%v", expected, m.String())
+	}
+}
+
+func TestEncodeMasterPlaylistWithContentSteering(t *testing.T) {
+	m := NewMasterPlaylist()
+	m.SetContentSteering("https://example.com/steering", "CDN-A")
+	audio := []*Alternative{{Type: "AUDIO", GroupId: "aac", Name: "English", URI: "en.m3u8", StableRenditionID: "en"}}
+	m.Append("https://cdn-a.example.com/low.m3u8", nil, VariantParams{Bandwidth: 1280000, Audio: "aac", Alternatives: audio, PathwayID: "CDN-A", StableVariantID: "low"})
+	m.Append("https://cdn-a.example.com/iframe.m3u8", nil, VariantParams{Bandwidth: 86000, Iframe: true, PathwayID: "CDN-A", StableVariantID: "low-iframe"})
+
+	for _, expected := range []string{
+		`#EXT-X-CONTENT-STEERING:SERVER-URI="https://example.com/steering",PATHWAY-ID="CDN-A"`,
+		`#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=NO,URI="en.m3u8",STABLE-RENDITION-ID="en"`,
+		`#EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=1280000,AUDIO="aac",PATHWAY-ID="CDN-A",STABLE-VARIANT-ID="low"`,
+		`#EXT-X-I-FRAME-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=86000,PATHWAY-ID="CDN-A",STABLE-VARIANT-ID="low-iframe",URI=`,
+	} {
+		if !strings.Contains(m.String(), expected) {
+			t.Errorf("Master playlist did not contain: %s\nMaster Playlist:\n%v", expected, m.String())
+		}
+	}
+}
+
+func TestEncodeMasterPlaylistWithMediaAttributes(t *testing.T) {
+	data, err := ioutil.ReadFile("sample-playlists/master-with-media-attributes.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewMasterPlaylist()
+	if err = p.Decode(*bytes.NewBuffer(data), true); err != nil {
+		t.Fatal(err)
+	}
+	// PROGRAM-ID is always displayed by the encoder
+	expected := strings.Replace(string(data), "#EXT-X-STREAM-INF:", "#EXT-X-STREAM-INF:PROGRAM-ID=0,", 1)
+	if p.String() != expected {
+		t.Errorf("Master playlist did not match the source\ngot:\n%v\nexp:\n%v", p.String(), expected)
+	}
+}
+
+func TestEncodeMasterPlaylistWithStreamInfV12Attributes(t *testing.T) {
+	data, err := ioutil.ReadFile("sample-playlists/master-with-stream-inf-v12.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewMasterPlaylist()
+	if err = p.Decode(*bytes.NewBuffer(data), true); err != nil {
+		t.Fatal(err)
+	}
+	if p.String() != string(data) {
+		t.Errorf("Master playlist did not match the source\ngot:\n%v\nexp:\n%v", p.String(), string(data))
+	}
+}
+
 func TestMasterVersion(t *testing.T) {
 	m := NewMasterPlaylist()
 	m.ver = 5
@@ -947,6 +1503,31 @@ func TestMasterSetVersion(t *testing.T) {
 	}
 }
 
+func TestMasterMinVersion(t *testing.T) {
+	m := NewMasterPlaylist()
+	m.Append("low.m3u8", nil, VariantParams{Bandwidth: 1280000})
+	if v := m.MinVersion(); v != 1 {
+		t.Errorf("Expected min version: 1, got: %v", v)
+	}
+	m.Append("iframe.m3u8", nil, VariantParams{Bandwidth: 86000, Iframe: true})
+	if v := m.MinVersion(); v != 4 {
+		t.Errorf("Expected min version with I-frame variant: 4, got: %v", v)
+	}
+	cc := []*Alternative{{Type: "CLOSED-CAPTIONS", GroupId: "cc", Name: "English", InstreamId: "SERVICE1"}}
+	m.Append("mid.m3u8", nil, VariantParams{Bandwidth: 2560000, Captions: "cc", Alternatives: cc})
+	if v := m.MinVersion(); v != 7 {
+		t.Errorf("Expected min version with INSTREAM-ID SERVICE: 7, got: %v", v)
+	}
+	m.Append("3d.m3u8", nil, VariantParams{Bandwidth: 5120000, ReqVideoLayout: "CH-STEREO"})
+	if v := m.MinVersion(); v != 12 {
+		t.Errorf("Expected min version with REQ-VIDEO-LAYOUT: 12, got: %v", v)
+	}
+	m.SetAutoVersion(true)
+	if !strings.HasPrefix(m.String(), "#EXTM3U\n#EXT-X-VERSION:12\n") {
+		t.Errorf("Expected auto version 12 on encode:\n%v", m.String())
+	}
+}
+
 /******************************
  *  Code generation examples  *
  ******************************/
@@ -971,7 +1552,7 @@ func ExampleMediaPlaylist_String() {
 // Create new media playlist
 // Add two segments to media playlist
 // Print it
-func ExampleMediaPlaylist_String_Winsize0() {
+func ExampleMediaPlaylist_String_winsize0() {
 	p, _ := NewMediaPlaylist(0, 2)
 	p.Append("test01.ts", 5.0, "")
 	p.Append("test02.ts", 6.0, "")
@@ -990,7 +1571,7 @@ func ExampleMediaPlaylist_String_Winsize0() {
 // Create new media playlist
 // Add two segments to media playlist
 // Print it
-func ExampleMediaPlaylist_String_Winsize0_VOD() {
+func ExampleMediaPlaylist_String_winsize0VOD() {
 	p, _ := NewMediaPlaylist(0, 2)
 	p.Append("test01.ts", 5.0, "")
 	p.Append("test02.ts", 6.0, "")
@@ -1089,7 +1670,7 @@ func ExampleMediaPlaylist_Segments_scte35_67_2014() {
 
 // Range over segments of media playlist. Check for ring buffer corner
 // cases.
-func ExampleMediaPlaylistGetAllSegments() {
+func ExampleMediaPlaylist_GetAllSegments() {
 	m, _ := NewMediaPlaylist(3, 3)
 	_ = m.Append("t00.ts", 10, "")
 	_ = m.Append("t01.ts", 10, "")